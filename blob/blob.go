@@ -0,0 +1,88 @@
+//Package blob stores immutable contents on disk, addressed by their SHA-256
+//digest.
+package blob
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+//ErrNotFound is returned when there is no blob with given digest.
+var ErrNotFound = errors.New("blob not found")
+
+//ErrInvalidDigest is returned for digests which aren't hex encoded SHA-256.
+var ErrInvalidDigest = errors.New("invalid digest")
+
+//Store keeps blobs in a directory. Blob is stored in a file named by its
+//digest, in a subdirectory named by the first two characters of the digest.
+//Equal contents are stored once.
+type Store struct {
+	dir string
+}
+
+//Open returns store of blobs in the directory, which is created if needed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir}, nil
+}
+
+//Put stores content read from r and returns its digest and size.
+func (s *Store) Put(r io.Reader) (string, int64, error) {
+	//Content is written to a temporary file first, so blob file is complete
+	//once it exists.
+	tmp, err := ioutil.TempFile(s.dir, ".put-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	h := sha256.New()
+	size, err := io.Copy(tmp, io.TeeReader(r, h))
+	if err != nil {
+		tmp.Close()
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	digest := hex.EncodeToString(h.Sum(nil))
+	path := s.path(digest)
+	if _, err := os.Stat(path); err == nil {
+		return digest, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, err
+	}
+	return digest, size, nil
+}
+
+//Open returns content of the blob.
+func (s *Store) Open(digest string) (io.ReadCloser, error) {
+	if !validDigest(digest) {
+		return nil, ErrInvalidDigest
+	}
+	f, err := os.Open(s.path(digest))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *Store) path(digest string) string {
+	return filepath.Join(s.dir, digest[:2], digest)
+}
+
+func validDigest(digest string) bool {
+	b, err := hex.DecodeString(digest)
+	return err == nil && len(b) == sha256.Size
+}
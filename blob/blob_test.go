@@ -0,0 +1,45 @@
+package blob_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/akruszewski/librarian/blob"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_PutAndOpenBlob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "librarian_blobs_*")
+	if err != nil {
+		t.Fatalf("cannot create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := require.New(t)
+	s, err := blob.Open(dir)
+	r.NoError(err)
+
+	digest, size, err := s.Put(strings.NewReader("content"))
+	r.NoError(err)
+	r.Equal("ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73", digest)
+	r.EqualValues(7, size)
+
+	//Equal content is stored once.
+	again, _, err := s.Put(strings.NewReader("content"))
+	r.NoError(err)
+	r.Equal(digest, again)
+
+	rc, err := s.Open(digest)
+	r.NoError(err)
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	r.NoError(err)
+	r.Equal("content", string(content))
+
+	_, err = s.Open(strings.Repeat("0", 64))
+	r.Equal(blob.ErrNotFound, err)
+	_, err = s.Open("../data.db")
+	r.Equal(blob.ErrInvalidDigest, err)
+}
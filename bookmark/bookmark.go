@@ -1,17 +1,14 @@
 //TODO:
 // - write tests for repository
-// - implement update method and query method
 // - implement proper error handling
-// - implement export/import methods from/to CSV
-// - add woosh as search engine for advenced quering.
 package bookmark
 
 import (
 	"context"
 	"encoding/csv"
 	"errors"
+	"fmt"
 	"io"
-	"log"
 	"strings"
 	"time"
 
@@ -23,6 +20,14 @@ const csvComma = '|'
 
 var ErrNotFound = errors.New("bookmark not found")
 
+//ErrUnknownField is returned when Update is asked to change a field which
+//doesn't exist or can't be updated.
+var ErrUnknownField = errors.New("unknown bookmark field")
+
+//UpdatableFields lists names of Bookmark fields which can be passed to Update
+//as onlyFields.
+var UpdatableFields = []string{"Kind", "Title", "URL", "Content", "Tags", "Collections", "Notes", "Document"}
+
 var csvHeader = []string{
 	"title",
 	"url",
@@ -31,102 +36,288 @@ var csvHeader = []string{
 	"document",
 	"created_at",
 	"updated_at",
+	"kind",
+	"content",
+	"collections",
 }
 
-//NewBookmark represents new bookmark.
+//legacyCSVHeaderSize is the number of columns of files exported before kinds
+//of bookmarks were introduced, they contain only web pages.
+const legacyCSVHeaderSize = 7
+
+//kindsCSVHeaderSize is the number of columns of files exported before
+//collections were introduced.
+const kindsCSVHeaderSize = 9
+
+//NewBookmark represents new bookmark. Title is optional, see Add. Web pages
+//have URL, other kinds have Content instead.
 type NewBookmark struct {
-	Title string   `json:"title" validate:"required"`
-	URL   string   `json:"url" validate:"required"`
-	Tags  []string `json:"tags"`
-	Notes string   `json:"notes"`
+	Kind        string   `json:"kind" validate:"omitempty,oneof=url cmd snippet"`
+	Title       string   `json:"title"`
+	URL         string   `json:"url"`
+	Content     string   `json:"content"`
+	Tags        []string `json:"tags"`
+	Collections []string `json:"collections"`
+	Notes       string   `json:"notes"`
 }
 
 //BookmarkSummary structure represents summary of bookmark.
 type BookmarkSummary struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	URL       string    `json:"url"`
-	Tags      []string  `json:"tags"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Tags        []string  `json:"tags"`
+	Collections []string  `json:"collections"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Health      string    `json:"health"`
+	Kind        string    `json:"kind"`
+	Visits      int       `json:"visits"`
+	Frecency    float64   `json:"frecency"`
 }
 
-//Bookmark structure represents single bookmark in repository. For now it repre
-//sents just url object, but it's worth considering to be able to bookmark also
-//other things, like terminal commands or similar entries. In that case type
-//field should be introduced which would describe resource type (URL,CMD,OTHER).
-//It's also worth considering some kind of rank, based on frequency of searches.
+//Bookmark structure represents single bookmark in repository. Kind describes
+//the bookmarked resource: web page (KindURL) with URL, or shell command
+//(KindCmd) or text snippet (KindSnippet) kept in Content. Only URLs of web
+//pages have to be unique.
 type Bookmark struct {
-	ID    int      `json:"id" validate:"required" storm:"id,increment"`
-	Title string   `json:"title" validate:"required" storm:"unique"`
-	URL   string   `json:"url" validate:"required" storm:"unique"`
-	Tags  []string `json:"tags" storm:"index"`
-	Notes string   `json:"notes"`
+	ID      int      `json:"id" validate:"required" storm:"id,increment"`
+	Kind    string   `json:"kind" validate:"omitempty,oneof=url cmd snippet" storm:"index"`
+	Title   string   `json:"title" validate:"required" storm:"unique"`
+	URL     string   `json:"url" storm:"unique"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags" storm:"index"`
+	//Collections are paths of collections containing the bookmark, see
+	//Collection. Missing collections are created when bookmark is saved.
+	Collections []string `json:"collections"`
+	Notes       string   `json:"notes"`
+	//CanonicalURL is the canonical form of URL (see CanonicalURL), set by
+	//the store. Bookmarks are looked up and compared by it.
+	CanonicalURL string `json:"canonical_url" storm:"unique"`
+	//CanonicalLink and FaviconURL are read from the page, see
+	//WithMetadataResolver.
+	CanonicalLink string `json:"canonical_link"`
+	FaviconURL    string `json:"favicon_url"`
 
 	Document  string    `json:"document"`
 	CreatedAt time.Time `json:"created_at" storm:"index"`
 	UpdatedAt time.Time `json:"updated_at" storm:"index"`
+
+	//FetchStatus is one of FetchPending, FetchDone or FetchFailed, see
+	//WithFetcher. FetchError describes the last failure.
+	FetchStatus string    `json:"fetch_status" storm:"index"`
+	FetchError  string    `json:"fetch_error"`
+	FetchedAt   time.Time `json:"fetched_at"`
+
+	//Health is one of HealthOK, HealthRedirected or HealthBroken, see
+	//CheckLinks. StatusCode and RedirectURL come from the last check,
+	//CheckError describes its failure and CheckFailures counts consecutive
+	//failed checks.
+	Health        string    `json:"health" storm:"index"`
+	StatusCode    int       `json:"status_code"`
+	RedirectURL   string    `json:"redirect_url"`
+	CheckError    string    `json:"check_error"`
+	CheckedAt     time.Time `json:"checked_at"`
+	CheckFailures int       `json:"check_failures"`
+
+	//Visits counts accesses to the bookmark, see Visit. Rank orders
+	//bookmarks by frecency, see Frecency.
+	Visits    int       `json:"visits"`
+	VisitedAt time.Time `json:"visited_at"`
+	Rank      float64   `json:"rank"`
+
+	//DeletedAt is set on bookmarks in the trash, see Trash.
+	DeletedAt time.Time `json:"deleted_at"`
 }
 
 type Storager interface {
-	Add(context.Context, *NewBookmark) (*Bookmark, error)
+	Add(context.Context, *NewBookmark, ...ConflictPolicy) (*Bookmark, error)
 	Update(context.Context, *Bookmark, ...string) (*Bookmark, error)
 	Delete(context.Context, int) error
 	Get(context.Context, int) (*Bookmark, error)
+	Visit(context.Context, int) (*Bookmark, error)
 	GetByURL(context.Context, string) (*Bookmark, error)
-	List(context.Context) ([]*BookmarkSummary, error)
+	List(context.Context, ListOptions) ([]*BookmarkSummary, string, error)
+	Query(context.Context, Query) ([]*BookmarkSummary, error)
+	Search(context.Context, string, int) ([]*SearchHit, error)
+	Reindex(context.Context) error
+	Refetch(context.Context, int) (*Bookmark, error)
+	Snapshot(context.Context, int, string) (*Snapshot, error)
+	Snapshots(context.Context, int) ([]*Snapshot, error)
+	OpenSnapshot(context.Context, int, int) (*Snapshot, io.ReadCloser, error)
+	Collections(context.Context) ([]*Collection, error)
+	CreateCollection(context.Context, string) (*Collection, error)
+	MoveCollection(context.Context, string, string) (*Collection, error)
+	DeleteCollection(context.Context, string, string) (int, error)
+	History(context.Context, int) ([]*Revision, error)
+	Restore(context.Context, int, int) (*Bookmark, error)
+	Trash(context.Context) ([]*Bookmark, error)
+	RestoreFromTrash(context.Context, int) (*Bookmark, error)
+	EmptyTrash(context.Context, time.Time) (int, error)
+	Tags(context.Context) ([]*TagCount, error)
+	RenameTag(context.Context, string, string) (int, error)
+	MergeTags(context.Context, []string, string) (int, error)
+	DeleteTag(context.Context, string) (int, error)
 	//TODO: List is not necessary, remove it.
-	ImportCSV(context.Context, io.Reader) error
+	ImportCSV(context.Context, io.Reader, ImportOptions) (*ImportReport, error)
+	ExportCSV(context.Context, io.Writer) error
+	ImportHTML(context.Context, io.Reader, ImportOptions) (*ImportReport, error)
+	ExportHTML(context.Context, io.Writer) error
 }
 
 //Store structure represents bookmark repository.
 type Store struct {
 	db       *storm.DB
 	validate *validator.Validate
+	//trackingParams are removed from canonical URLs.
+	trackingParams []string
+	fetcher        Fetcher
+	fetchQueue     chan int
+	resolver       MetadataResolver
+	checker        LinkChecker
+	archiver       Archiver
+	blobs          BlobStore
+	//autoSnapshot is format of snapshots saved by RunFetcher.
+	autoSnapshot string
 }
 
-//Add bookmark to repository.
-func (r *Store) Add(ctx context.Context, nbm *NewBookmark) (*Bookmark, error) {
-	if err := r.validate.Struct(nbm); err != nil {
+//Add bookmark to repository. Title, notes, canonical link and favicon of web
+//page which weren't given are resolved from the page metadata, see
+//WithMetadataResolver. Bookmark of other kind gets the first line of its
+//content as title, when it has none.
+//When bookmark with the same URL is already stored, ErrDuplicate is returned,
+//unless other conflict policy is passed. In that case the saved or the kept
+//stored bookmark is returned. Invalid bookmark is reported with
+//ErrInvalidBookmark.
+func (r *Store) Add(ctx context.Context, nbm *NewBookmark, policy ...ConflictPolicy) (*Bookmark, error) {
+	p := ConflictFail
+	if len(policy) != 0 {
+		p = policy[0]
+	}
+	if err := p.validate(); err != nil {
 		return nil, err
 	}
+	if err := r.validate.Struct(nbm); err != nil {
+		return nil, invalidBookmark(err)
+	}
+	if nbm.Kind == "" {
+		nbm.Kind = KindURL
+	}
 	bm := &Bookmark{
-		Title:     nbm.Title,
-		URL:       nbm.URL,
-		Tags:      nbm.Tags,
-		Notes:     nbm.Notes,
-		CreatedAt: time.Now().UTC(),
-		UpdatedAt: time.Now().UTC(),
-	}
-	if err := r.db.Save(bm); err != nil {
+		Kind:        nbm.Kind,
+		Title:       nbm.Title,
+		URL:         nbm.URL,
+		Content:     nbm.Content,
+		Tags:        nbm.Tags,
+		Collections: nbm.Collections,
+		Notes:       nbm.Notes,
+		CreatedAt:   time.Now().UTC(),
+		UpdatedAt:   time.Now().UTC(),
+	}
+	bm.CanonicalURL = r.canonicalURL(bm.URL)
+	if err := r.populate(ctx, bm); err != nil {
+		return nil, err
+	}
+	if err := r.withTx(func(tx storm.Node) error {
+		var err error
+		bm, _, err = r.saveWithPolicy(ctx, tx, bm, p)
+		return err
+	}); err != nil {
 		return nil, err
 	}
+	r.enqueueFetch(bm)
 	return bm, nil
 }
 
-//Update updates bookmark in database, all fields passed in bookmark
-//structure will be updated.
-//TODO: partial update shpuld be possible. In this case, function should get
-//optional arguments onlyFields ...string which contains arguments to update.
+//Update updates bookmark in database. When onlyFields are passed, only those
+//fields are validated and copied from bm to the stored bookmark, other fields
+//are kept untouched. Otherwise all fields passed in bookmark structure will be
+//updated. ErrDuplicate is returned when other bookmark has the same URL or
+//title, ErrInvalidBookmark when the bookmark fails validation.
 func (r *Store) Update(ctx context.Context, bm *Bookmark, onlyFields ...string) (*Bookmark, error) {
 	if len(onlyFields) != 0 {
-		return nil, errors.New("Not implemented")
+		return r.updateFields(ctx, bm, onlyFields)
 	}
 	if err := r.validate.Struct(bm); err != nil {
+		return nil, invalidBookmark(err)
+	}
+	bm.UpdatedAt = time.Now().UTC()
+	bm.CanonicalURL = r.canonicalURL(bm.URL)
+	stored := &Bookmark{}
+	if err := r.withTx(func(tx storm.Node) error {
+		old := &Bookmark{}
+		if err := tx.One("ID", bm.ID, old); err != nil {
+			return err
+		}
+		if err := checkUnique(tx, bm); err != nil {
+			return err
+		}
+		if err := tx.Update(bm); err != nil {
+			return err
+		}
+		if err := tx.One("ID", bm.ID, stored); err != nil {
+			return err
+		}
+		if stored.URL != old.URL {
+			r.markPending(stored)
+		}
+		return r.save(ctx, tx, stored)
+	}); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, ErrNotFound
+		}
 		return nil, err
 	}
-	if err := r.db.Update(bm); err != nil {
+	r.enqueueFetch(stored)
+	return stored, nil
+}
+
+func (r *Store) updateFields(ctx context.Context, bm *Bookmark, fields []string) (*Bookmark, error) {
+	for _, f := range fields {
+		if !isUpdatableField(f) {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownField, f)
+		}
+	}
+	stored := &Bookmark{}
+	if err := r.withTx(func(tx storm.Node) error {
+		if err := tx.One("ID", bm.ID, stored); err != nil {
+			return err
+		}
+		oldURL := stored.URL
+		for _, f := range fields {
+			copyField(stored, bm, f)
+		}
+		//Whole bookmark is validated, because kind decides which fields
+		//are required.
+		if err := r.validate.Struct(stored); err != nil {
+			return invalidBookmark(err)
+		}
+		if stored.URL != oldURL {
+			r.markPending(stored)
+		}
+		stored.UpdatedAt = time.Now().UTC()
+		stored.CanonicalURL = r.canonicalURL(stored.URL)
+		if err := checkUnique(tx, stored); err != nil {
+			return err
+		}
+		//Save is used instead of Update, because Update skips zero values,
+		//so fields couldn't be cleared.
+		return r.save(ctx, tx, stored)
+	}); err != nil {
 		if err == storm.ErrNotFound {
 			return nil, ErrNotFound
 		}
 		return nil, err
 	}
-	return bm, nil
+	r.enqueueFetch(stored)
+	return stored, nil
 }
 
-//Delete bookmark from repository.
+//Delete moves bookmark to the trash, see Trash.
 func (r *Store) Delete(ctx context.Context, id int) error {
-	if err := r.db.DeleteStruct(&Bookmark{ID: id}); err != nil {
+	if err := r.withTx(func(tx storm.Node) error {
+		return r.delete(tx, id)
+	}); err != nil {
 		if err == storm.ErrNotFound {
 			return ErrNotFound
 		}
@@ -135,6 +326,26 @@ func (r *Store) Delete(ctx context.Context, id int) error {
 	return nil
 }
 
+//delete moves bookmark to the trash and removes it from sort and search
+//indexes. Its snapshots are kept until the trash is emptied, see EmptyTrash.
+func (r *Store) delete(n storm.Node, id int) error {
+	bm := &Bookmark{}
+	if err := n.One("ID", id, bm); err != nil {
+		return err
+	}
+	if err := n.DeleteStruct(bm); err != nil {
+		return err
+	}
+	if err := removeSortKeys(n, id); err != nil {
+		return err
+	}
+	bm.DeletedAt = time.Now().UTC()
+	if err := n.From(trashBucket).Save(&trashedBookmark{ID: bm.ID, DeletedAt: bm.DeletedAt, Bookmark: bm}); err != nil {
+		return err
+	}
+	return r.index(n).Remove(id)
+}
+
 //Get retrieves bookmark from repository
 func (r *Store) Get(ctx context.Context, id int) (*Bookmark, error) {
 	bm := &Bookmark{}
@@ -147,9 +358,16 @@ func (r *Store) Get(ctx context.Context, id int) (*Bookmark, error) {
 	return bm, nil
 }
 
+//GetByURL retrieves bookmark with the same canonical URL, see CanonicalURL.
 func (r *Store) GetByURL(ctx context.Context, url string) (*Bookmark, error) {
 	bm := &Bookmark{}
-	if err := r.db.One("URL", url, bm); err != nil {
+	err := r.db.One("CanonicalURL", r.canonicalURL(url), bm)
+	if err == storm.ErrNotFound {
+		//Bookmarks stored before canonicalization have only original URL,
+		//until the store is reindexed.
+		err = r.db.One("URL", url, bm)
+	}
+	if err != nil {
 		if err == storm.ErrNotFound {
 			return nil, ErrNotFound
 		}
@@ -158,53 +376,66 @@ func (r *Store) GetByURL(ctx context.Context, url string) (*Bookmark, error) {
 	return bm, nil
 }
 
-//List all bookmarks
-func (r *Store) List(ctx context.Context) ([]*BookmarkSummary, error) {
-	bms := []Bookmark{}
-	if err := r.db.All(&bms); err != nil {
+//ImportCSV imports bookmarks from CSV file written by ExportCSV. All rows are
+//imported in a single transaction, see ImportMode for handling of invalid and
+//duplicate rows.
+func (rep *Store) ImportCSV(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	mode, err := opts.mode()
+	if err != nil {
 		return nil, err
 	}
-	bs := []*BookmarkSummary{}
-	for _, bm := range bms {
-		bs = append(bs, &BookmarkSummary{
-			ID:        bm.ID,
-			Title:     bm.Title,
-			URL:       bm.URL,
-			Tags:      bm.Tags,
-			CreatedAt: bm.CreatedAt,
-			UpdatedAt: bm.UpdatedAt,
-		})
-	}
-	return bs, nil
-}
-
-func (rep *Store) ImportCSV(ctx context.Context, r io.Reader) error {
+	//Number of fields is set by the header.
 	csvReader := newCSVReader(r)
 
 	header, err := csvReader.Read()
 	if err != nil {
-		return err
+		if _, ok := err.(*csv.ParseError); ok || err == io.EOF {
+			return nil, ErrInvalidCSV
+		}
+		return nil, err
 	}
 	if !validateCSVHeader(header) {
-		return errors.New("invalid csv file")
+		return nil, ErrInvalidCSV
 	}
+	recs := []importRecord{}
 	for {
 		record, err := csvReader.Read()
 		if err == io.EOF {
 			break
 		}
-		bm, err := parseBookmark(record)
-		if err != nil {
-			return err
+		rec := importRecord{}
+		if len(record) > 1 {
+			rec.title, rec.url = record[0], record[1]
 		}
-
-		if err = rep.db.Save(bm); err != nil {
-			return err
+		//Parse errors are limited to the row, reading can be continued.
+		if perr, ok := err.(*csv.ParseError); ok {
+			rec.line, rec.err = perr.StartLine, perr.Err
+		} else if err != nil {
+			return nil, err
+		} else {
+			rec.line, _ = csvReader.FieldPos(0)
+			rec.bm, rec.err = parseBookmark(record)
 		}
-		log.Printf("Bookmark %+v added to database", bm)
+		recs = append(recs, rec)
 	}
 
-	return nil
+	return rep.importRecords(ctx, recs, mode, opts.Conflict)
+}
+
+//ExportCSV writes all bookmarks, ordered by ID, in the format read by
+//ImportCSV.
+func (r *Store) ExportCSV(ctx context.Context, w io.Writer) error {
+	csvWriter := newCSVWriter(w)
+	if err := csvWriter.Write(csvHeader); err != nil {
+		return err
+	}
+	if err := r.db.Select().Each(&Bookmark{}, func(record interface{}) error {
+		return csvWriter.Write(formatBookmark(record.(*Bookmark)))
+	}); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
 }
 
 //Init inits bookmark repository.
@@ -215,33 +446,124 @@ func (r *Store) Init(ctx context.Context) error {
 	return nil
 }
 
+//withTx runs f in a read-write transaction, which is committed when f
+//succeeds.
+func (r *Store) withTx(f func(tx storm.Node) error) error {
+	tx, err := r.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//save saves bookmark with normalized tags and collections, which are created
+//when missing, records its revision and updates sort and search indexes.
+func (r *Store) save(ctx context.Context, n storm.Node, bm *Bookmark) error {
+	bm.Tags = NormalizeTags(bm.Tags)
+	bm.Collections = NormalizeCollections(bm.Collections)
+	for _, p := range bm.Collections {
+		if _, err := ensureCollection(n, p); err != nil {
+			return err
+		}
+	}
+	stored := &Bookmark{}
+	if bm.ID != 0 {
+		if err := n.One("ID", bm.ID, stored); err != nil && err != storm.ErrNotFound {
+			return err
+		}
+	}
+	if err := n.Save(bm); err != nil {
+		return err
+	}
+	if err := updateSortKeys(n, bm); err != nil {
+		return err
+	}
+	if err := addRevision(ctx, n, bm, stored); err != nil {
+		return err
+	}
+	return r.index(n).Add(document(bm))
+}
+
 //NewStore initialisate repository structure with given database.
-func NewStore(db *storm.DB) *Store {
-	return &Store{
-		db:       db,
-		validate: validator.New(),
+func NewStore(db *storm.DB, opts ...StoreOption) *Store {
+	r := &Store{
+		db:             db,
+		validate:       validator.New(),
+		trackingParams: DefaultTrackingParams,
+	}
+	r.validate.RegisterStructValidation(validateKind, NewBookmark{}, Bookmark{})
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func summary(bm *Bookmark) *BookmarkSummary {
+	return &BookmarkSummary{
+		ID:          bm.ID,
+		Title:       bm.Title,
+		URL:         bm.URL,
+		Tags:        bm.Tags,
+		Collections: bm.Collections,
+		CreatedAt:   bm.CreatedAt,
+		UpdatedAt:   bm.UpdatedAt,
+		Health:      bm.Health,
+		Kind:        bm.Kind,
+		Visits:      bm.Visits,
+		Frecency:    bm.Frecency(time.Now()),
 	}
 }
 
 func parseBookmark(data []string) (*Bookmark, error) {
-	tags := strings.Split(data[2], ";")
+	var tags []string
+	if data[2] != "" {
+		tags = strings.Split(data[2], ";")
+	}
 	cr, err := time.Parse(time.RFC3339, data[5])
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid created_at: %w", err)
 	}
 	up, err := time.Parse(time.RFC3339, data[6])
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid updated_at: %w", err)
 	}
-	return &Bookmark{
+	bm := &Bookmark{
+		Kind:      KindURL,
 		Title:     data[0],
 		URL:       data[1],
 		Tags:      tags,
 		Notes:     data[3],
 		Document:  data[4],
-		CreatedAt: cr,
-		UpdatedAt: up,
-	}, nil
+		CreatedAt: cr.UTC(),
+		UpdatedAt: up.UTC(),
+	}
+	if len(data) > legacyCSVHeaderSize {
+		bm.Kind, bm.Content = data[7], data[8]
+	}
+	if len(data) > kindsCSVHeaderSize && data[9] != "" {
+		bm.Collections = strings.Split(data[9], ";")
+	}
+	return bm, nil
+}
+
+//formatBookmark is the inverse of parseBookmark.
+func formatBookmark(bm *Bookmark) []string {
+	return []string{
+		bm.Title,
+		bm.URL,
+		strings.Join(bm.Tags, ";"),
+		bm.Notes,
+		bm.Document,
+		bm.CreatedAt.UTC().Format(time.RFC3339Nano),
+		bm.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		bm.Kind,
+		bm.Content,
+		strings.Join(bm.Collections, ";"),
+	}
 }
 
 func newCSVReader(r io.Reader) *csv.Reader {
@@ -250,7 +572,50 @@ func newCSVReader(r io.Reader) *csv.Reader {
 	return w
 }
 
+func newCSVWriter(w io.Writer) *csv.Writer {
+	cw := csv.NewWriter(w)
+	cw.Comma = csvComma
+	return cw
+}
+
+func isUpdatableField(field string) bool {
+	for _, f := range UpdatableFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func copyField(dst, src *Bookmark, field string) {
+	switch field {
+	case "Kind":
+		dst.Kind = src.Kind
+	case "Title":
+		dst.Title = src.Title
+	case "URL":
+		dst.URL = src.URL
+	case "Content":
+		dst.Content = src.Content
+	case "Tags":
+		dst.Tags = src.Tags
+	case "Collections":
+		dst.Collections = src.Collections
+	case "Notes":
+		dst.Notes = src.Notes
+	case "Document":
+		dst.Document = src.Document
+	}
+}
+
+//validateCSVHeader accepts also header of files without kinds or collections,
+//see legacyCSVHeaderSize and kindsCSVHeaderSize.
 func validateCSVHeader(header []string) bool {
+	switch len(header) {
+	case len(csvHeader), kindsCSVHeaderSize, legacyCSVHeaderSize:
+	default:
+		return false
+	}
 	for i, h := range header {
 		if h != csvHeader[i] {
 			return false
@@ -5,15 +5,23 @@ TODO:
 package bookmark_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/akruszewski/librarian/blob"
 	"github.com/akruszewski/librarian/bookmark"
+	"github.com/akruszewski/librarian/bookmark/storagertest"
+	"github.com/akruszewski/librarian/fetch"
 	"github.com/asdine/storm/v3"
 	validator "github.com/go-playground/validator/v10"
 	"github.com/stretchr/testify/require"
@@ -67,10 +75,289 @@ func Test_CannotCreateBookmarkWithoutRequiredFields(t *testing.T) {
 
 		r.True(errors.As(err, &ve))
 
-		r.Len(ve, 2)
+		//Title is optional, it's resolved from the page or set to URL.
+		r.Len(ve, 1)
+	})
+}
+
+func Test_CanAddBookmarksOfOtherKinds(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		page, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "page", URL: "https://test.com"})
+		r.NoError(err)
+		r.Equal(bookmark.KindURL, page.Kind)
+
+		//Commands have no URL, so the unique URL doesn't apply to them.
+		cmd, err := repo.Add(ctx, &bookmark.NewBookmark{
+			Kind:    bookmark.KindCmd,
+			Content: "kubectl get pods -A\n",
+			Tags:    []string{"k8s"},
+		})
+		r.NoError(err)
+		r.Equal("kubectl get pods -A", cmd.Title)
+		r.Empty(cmd.URL)
+		r.Empty(cmd.FetchStatus)
+		snippet, err := repo.Add(ctx, &bookmark.NewBookmark{
+			Kind:    bookmark.KindSnippet,
+			Title:   "greeting",
+			Content: "Hello,\nWorld",
+		})
+		r.NoError(err)
+
+		for _, c := range []struct {
+			nbm    *bookmark.NewBookmark
+			fields []string
+		}{
+			{&bookmark.NewBookmark{Kind: bookmark.KindCmd}, []string{"Content"}},
+			{&bookmark.NewBookmark{Kind: bookmark.KindCmd, Content: "ls", URL: "https://ls.com"}, []string{"URL"}},
+			{&bookmark.NewBookmark{Kind: bookmark.KindURL, Content: "ls"}, []string{"URL", "Content"}},
+			{&bookmark.NewBookmark{Kind: bookmark.KindURL, Content: "ls", URL: "https://ls.com"}, []string{"Content"}},
+			{&bookmark.NewBookmark{Kind: "other", URL: "https://other.com"}, []string{"Kind"}},
+		} {
+			_, err := repo.Add(ctx, c.nbm)
+			var ve validator.ValidationErrors
+			r.True(errors.As(err, &ve), "%+v", c.nbm)
+			fields := []string{}
+			for _, fe := range ve {
+				fields = append(fields, fe.Field())
+			}
+			r.Equal(c.fields, fields)
+		}
+
+		_, err = repo.Update(ctx, &bookmark.Bookmark{ID: cmd.ID, Content: ""}, "Content")
+		var ve validator.ValidationErrors
+		r.True(errors.As(err, &ve))
+		updated, err := repo.Update(ctx, &bookmark.Bookmark{ID: cmd.ID, Content: "kubectl get pods"}, "Content")
+		r.NoError(err)
+		r.Equal("kubectl get pods", updated.Content)
+
+		bms, err := repo.Query(ctx, bookmark.Query{Kind: bookmark.KindCmd})
+		r.NoError(err)
+		r.Len(bms, 1)
+		r.Equal(cmd.ID, bms[0].ID)
+		bms, _, err = repo.List(ctx, bookmark.ListOptions{Kind: bookmark.KindSnippet, Limit: 1})
+		r.NoError(err)
+		r.Len(bms, 1)
+		r.Equal(snippet.ID, bms[0].ID)
+		bms, _, err = repo.List(ctx, bookmark.ListOptions{Kind: bookmark.KindURL})
+		r.NoError(err)
+		r.Len(bms, 1)
+		r.Equal(page.ID, bms[0].ID)
+
+		hits, err := repo.Search(ctx, "content:kubectl", 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+		r.Equal(cmd.ID, hits[0].Bookmark.ID)
+	})
+}
+
+func Test_AddReturnsErrDuplicateWhenURLExists(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		stored, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "test title", URL: "https://test.com"})
+		r.NoError(err)
+
+		_, err = repo.Add(ctx, &bookmark.NewBookmark{Title: "other title", URL: "https://test.com"})
+		var dupErr *bookmark.ErrDuplicate
+		r.True(errors.As(err, &dupErr))
+		r.Equal(stored.ID, dupErr.ID)
+		r.Equal("url", dupErr.Field)
+
+		//Title conflict can't be resolved by the policy.
+		_, err = repo.Add(
+			ctx,
+			&bookmark.NewBookmark{Title: "test title", URL: "https://other.com"},
+			bookmark.ConflictOverwrite,
+		)
+		r.True(errors.As(err, &dupErr))
+		r.Equal("title", dupErr.Field)
+
+		_, err = repo.Add(ctx, &bookmark.NewBookmark{Title: "t", URL: "https://t.com"}, "unknown")
+		r.True(errors.Is(err, bookmark.ErrInvalidConflictPolicy))
+	})
+}
+
+func Test_AddResolvesConflictsByPolicy(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		stored, err := repo.Add(ctx, &bookmark.NewBookmark{
+			Title:       "test title",
+			URL:         "https://test.com",
+			Tags:        []string{"a", "b"},
+			Collections: []string{"work"},
+			Notes:       "note",
+		})
+		r.NoError(err)
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{
+			Title: "skipped",
+			URL:   "https://test.com",
+		}, bookmark.ConflictSkip)
+		r.NoError(err)
+		r.Equal(stored.ID, bm.ID)
+		r.Equal("test title", bm.Title)
+
+		bm, err = repo.Add(ctx, &bookmark.NewBookmark{
+			Title: "merged",
+			URL:   "https://test.com",
+			Tags:  []string{"b", "c"},
+		}, bookmark.ConflictMergeTags)
+		r.NoError(err)
+		r.Equal(stored.ID, bm.ID)
+		r.Equal("test title", bm.Title)
+		r.Equal([]string{"a", "b", "c"}, bm.Tags)
+		r.Equal("note", bm.Notes)
+
+		for _, policy := range []bookmark.ConflictPolicy{bookmark.ConflictOverwrite, bookmark.ConflictKeepNewer} {
+			bm, err = repo.Add(ctx, &bookmark.NewBookmark{
+				Title:       string(policy),
+				URL:         "https://test.com",
+				Tags:        []string{"d"},
+				Collections: []string{"reading/" + string(policy)},
+			}, policy)
+			r.NoError(err)
+			r.Equal(stored.ID, bm.ID)
+			r.Equal(string(policy), bm.Title)
+			r.Equal(bookmark.KindURL, bm.Kind)
+			r.Empty(bm.Content)
+			r.Equal([]string{"d"}, bm.Tags)
+			r.Equal([]string{"reading/" + string(policy)}, bm.Collections)
+			r.Empty(bm.Notes)
+			r.True(stored.CreatedAt.Equal(bm.CreatedAt))
+		}
+
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+		r.Len(bms, 1)
+		hits, err := repo.Search(ctx, "newer", 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+	})
+}
+
+func Test_UpdateReturnsErrDuplicateWhenURLExists(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		first, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "first", URL: "https://first.com"})
+		r.NoError(err)
+		second, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "second", URL: "https://second.com"})
+		r.NoError(err)
+
+		second.URL = first.URL
+		_, err = repo.Update(ctx, second)
+		var dupErr *bookmark.ErrDuplicate
+		r.True(errors.As(err, &dupErr))
+		r.Equal(first.ID, dupErr.ID)
+
+		_, err = repo.Update(ctx, &bookmark.Bookmark{ID: second.ID, Title: "first"}, "Title")
+		r.True(errors.As(err, &dupErr))
+		r.Equal(first.ID, dupErr.ID)
+		r.Equal("title", dupErr.Field)
+	})
+}
+
+func Test_CanonicalURLNormalizesURLs(t *testing.T) {
+	r := require.New(t)
+
+	cases := map[string]string{
+		"http://Example.COM/a/":                           "https://example.com/a",
+		"https://example.com/a":                           "https://example.com/a",
+		"https://example.com/a?utm_source=x&utm_medium=y": "https://example.com/a",
+		"https://example.com:443/a#section":               "https://example.com/a",
+		"http://example.com:80":                           "https://example.com/",
+		"http://example.com:8080/":                        "http://example.com:8080/",
+		"https://example.com/?b=2&fbclid=x&a=1&a=0":       "https://example.com/?a=1&a=0&b=2",
+		"https://example.com/a%2Fb/":                      "https://example.com/a%2Fb",
+		"ftp://Example.com/file.txt":                      "ftp://example.com/file.txt",
+		"not a url":                                       "not a url",
+	}
+	for raw, canonical := range cases {
+		r.Equal(canonical, bookmark.CanonicalURL(raw, bookmark.DefaultTrackingParams), raw)
+	}
+	r.Equal(
+		"https://example.com/?utm_source=x",
+		bookmark.CanonicalURL("https://example.com/?utm_source=x&ref=y", []string{"ref"}),
+	)
+}
+
+func Test_NearIdenticalURLsAreTheSameBookmark(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		stored, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "first", URL: "http://Example.com/a/"})
+		r.NoError(err)
+		r.Equal("http://Example.com/a/", stored.URL)
+		r.Equal("https://example.com/a", stored.CanonicalURL)
+
+		for _, u := range []string{"https://example.com/a", "https://example.com/a?utm_source=x"} {
+			_, err = repo.Add(ctx, &bookmark.NewBookmark{Title: u, URL: u})
+			var dupErr *bookmark.ErrDuplicate
+			r.True(errors.As(err, &dupErr), u)
+			r.Equal(stored.ID, dupErr.ID)
+
+			bm, err := repo.GetByURL(ctx, u)
+			r.NoError(err)
+			r.Equal(stored.ID, bm.ID)
+		}
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{
+			Title: "second",
+			URL:   "https://example.com/a#top",
+		}, bookmark.ConflictOverwrite)
+		r.NoError(err)
+		r.Equal(stored.ID, bm.ID)
+		r.Equal("https://example.com/a#top", bm.URL)
+
+		other, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "other", URL: "https://example.com/b"})
+		r.NoError(err)
+		_, err = repo.Update(ctx, &bookmark.Bookmark{ID: other.ID, URL: "https://EXAMPLE.com/a/"}, "URL")
+		var dupErr *bookmark.ErrDuplicate
+		r.True(errors.As(err, &dupErr))
+		r.Equal(stored.ID, dupErr.ID)
 	})
 }
 
+func Test_ReindexUpdatesCanonicalURLs(t *testing.T) {
+	dbFile, err := ioutil.TempFile("", "librarian_*.db")
+	require.NoError(t, err)
+	require.NoError(t, dbFile.Close())
+	defer os.Remove(dbFile.Name())
+	db, err := storm.Open(dbFile.Name())
+	require.NoError(t, err)
+	defer db.Close()
+
+	r := require.New(t)
+	ctx := context.Background()
+
+	repo := bookmark.NewStore(db, bookmark.WithTrackingParams())
+	first, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "first", URL: "https://test.com/?ref=a"})
+	r.NoError(err)
+	second, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "second", URL: "https://test.com/?ref=b"})
+	r.NoError(err)
+
+	repo = bookmark.NewStore(db, bookmark.WithTrackingParams("ref"))
+	r.NoError(repo.Reindex(ctx))
+
+	bm, err := repo.GetByURL(ctx, "https://test.com/")
+	r.NoError(err)
+	r.Equal(first.ID, bm.ID)
+	bm, err = repo.Get(ctx, second.ID)
+	r.NoError(err)
+	r.Empty(bm.CanonicalURL)
+	bm, err = repo.GetByURL(ctx, "https://test.com/?ref=b")
+	r.NoError(err)
+	r.Equal(first.ID, bm.ID)
+}
+
 func Test_CanGetBookmark(t *testing.T) {
 	withTestStore(func(repo *bookmark.Store) {
 		r := require.New(t)
@@ -222,6 +509,100 @@ func Test_CannotUpdateBookmarkWhichDoesntExist(t *testing.T) {
 	})
 }
 
+func Test_CanUpdateOnlyGivenFields(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+
+		expectedBm, err := repo.Add(context.Background(), &bookmark.NewBookmark{
+			Title: "test title",
+			URL:   "https://test.com",
+			Tags:  []string{"tag"},
+			Notes: "test Note",
+		})
+		r.NoError(err)
+		r.NotNil(expectedBm)
+
+		bm, err := repo.Update(
+			context.Background(),
+			&bookmark.Bookmark{ID: expectedBm.ID, Notes: ""},
+			"Notes",
+		)
+		r.NoError(err)
+		r.NotNil(bm)
+
+		r.Equal(expectedBm.Title, bm.Title)
+		r.Equal(expectedBm.URL, bm.URL)
+		r.Equal(expectedBm.Tags, bm.Tags)
+		r.Empty(bm.Notes)
+		r.Equal(expectedBm.CreatedAt.Unix(), bm.CreatedAt.Unix())
+		r.True(bm.UpdatedAt.After(expectedBm.UpdatedAt))
+
+		bm, err = repo.Get(context.Background(), expectedBm.ID)
+		r.NoError(err)
+		r.Equal(expectedBm.Title, bm.Title)
+		r.Empty(bm.Notes)
+	})
+}
+
+func Test_CannotUpdateOnlyGivenFieldsWithInvalidData(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+
+		expectedBm, err := repo.Add(context.Background(), &bookmark.NewBookmark{
+			Title: "test title",
+			URL:   "https://test.com",
+		})
+		r.NoError(err)
+		r.NotNil(expectedBm)
+
+		bm, err := repo.Update(
+			context.Background(),
+			&bookmark.Bookmark{ID: expectedBm.ID},
+			"Title",
+		)
+		r.Error(err)
+		r.Nil(bm)
+
+		var ve validator.ValidationErrors
+		r.True(errors.As(err, &ve))
+		r.Len(ve, 1)
+	})
+}
+
+func Test_CannotUpdateUnknownField(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+
+		expectedBm, err := repo.Add(context.Background(), &bookmark.NewBookmark{
+			Title: "test title",
+			URL:   "https://test.com",
+		})
+		r.NoError(err)
+
+		bm, err := repo.Update(
+			context.Background(),
+			&bookmark.Bookmark{ID: expectedBm.ID},
+			"CreatedAt",
+		)
+		r.Nil(bm)
+		r.True(errors.Is(err, bookmark.ErrUnknownField))
+	})
+}
+
+func Test_CannotUpdateOnlyGivenFieldsOfBookmarkWhichDoesntExist(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+
+		bm, err := repo.Update(
+			context.Background(),
+			&bookmark.Bookmark{ID: 1, Notes: "note"},
+			"Notes",
+		)
+		r.Nil(bm)
+		r.Equal(bookmark.ErrNotFound, err)
+	})
+}
+
 func Test_CanDeleteBookmark(t *testing.T) {
 	withTestStore(func(repo *bookmark.Store) {
 		r := require.New(t)
@@ -270,13 +651,284 @@ func Test_CanListBookmark(t *testing.T) {
 			r.NotNil(bm)
 		}
 
-		bms, err := repo.List(context.Background())
+		bms, _, err := repo.List(context.Background(), bookmark.ListOptions{})
 		r.NoError(err)
 		r.NotNil(bms)
 		r.Len(bms, len(expectedBms))
 	})
 }
 
+func Test_CanQueryBookmarks(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		nbms := []*bookmark.NewBookmark{{
+			Title: "Go documentation",
+			URL:   "https://golang.org/doc",
+			Tags:  []string{"go", "docs"},
+		}, {
+			Title: "Go blog",
+			URL:   "https://blog.golang.org",
+			Tags:  []string{"go", "blog"},
+			Notes: "Read about generics",
+		}, {
+			Title: "Storm",
+			URL:   "https://github.com/asdine/storm",
+			Tags:  []string{"db"},
+		}}
+		for _, nbm := range nbms {
+			_, err := repo.Add(ctx, nbm)
+			r.NoError(err)
+		}
+
+		cases := []struct {
+			name     string
+			query    bookmark.Query
+			expected []string
+		}{
+			{"empty", bookmark.Query{}, []string{"Go documentation", "Go blog", "Storm"}},
+			{"any tags", bookmark.Query{AnyTags: []string{"docs", "db"}}, []string{"Go documentation", "Storm"}},
+			{"all tags", bookmark.Query{AllTags: []string{"go", "blog"}}, []string{"Go blog"}},
+			{"host", bookmark.Query{Host: "GOLANG.org"}, []string{"Go documentation"}},
+			{"prefix", bookmark.Query{URLPrefix: "https://github.com/"}, []string{"Storm"}},
+			{"title", bookmark.Query{Text: "go"}, []string{"Go documentation", "Go blog"}},
+			{"notes", bookmark.Query{Text: "GENERICS"}, []string{"Go blog"}},
+			{"combined", bookmark.Query{AnyTags: []string{"go"}, Text: "doc"}, []string{"Go documentation"}},
+		}
+		for _, c := range cases {
+			bms, err := repo.Query(ctx, c.query)
+			r.NoError(err, c.name)
+			titles := []string{}
+			for _, bm := range bms {
+				titles = append(titles, bm.Title)
+			}
+			r.Equal(c.expected, titles, c.name)
+		}
+	})
+}
+
+func Test_CanQueryBookmarksByDateRange(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		testCSV := `title|url|tags|notes|document|created_at|updated_at
+old|https://old.com|tag|||2019-01-01T10:00:00Z|2020-03-01T10:00:00Z
+middle|https://middle.com|tag|||2019-06-01T10:00:00.5Z|2019-06-01T10:00:00Z
+new|https://new.com|tag|||2020-01-01T10:00:00+02:00|2020-01-01T10:00:00Z
+`
+		_, err := repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{})
+		r.NoError(err)
+
+		cases := []struct {
+			name     string
+			query    bookmark.Query
+			expected []string
+		}{
+			{
+				"created after",
+				bookmark.Query{CreatedAfter: time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)},
+				[]string{"middle", "new"},
+			},
+			{
+				"created before",
+				bookmark.Query{CreatedBefore: time.Date(2019, 6, 1, 10, 0, 0, 0, time.UTC)},
+				[]string{"old"},
+			},
+			{
+				"created between",
+				bookmark.Query{
+					CreatedAfter:  time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC),
+					CreatedBefore: time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC),
+				},
+				[]string{"middle"},
+			},
+			{
+				"updated after",
+				bookmark.Query{UpdatedAfter: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+				[]string{"old"},
+			},
+		}
+		for _, c := range cases {
+			bms, err := repo.Query(ctx, c.query)
+			r.NoError(err, c.name)
+			titles := []string{}
+			for _, bm := range bms {
+				titles = append(titles, bm.Title)
+			}
+			r.Equal(c.expected, titles, c.name)
+		}
+	})
+}
+
+func Test_CanListBookmarksPageByPage(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		testCSV := `title|url|tags|notes|document|created_at|updated_at
+c|https://c.com|tag|||2020-01-02T00:00:00Z|2020-01-05T00:00:00Z
+a|https://a.com|tag|||2020-01-01T00:00:00Z|2020-01-05T00:00:00Z
+e|https://e.com|tag|||2020-01-03T00:00:00.5Z|2020-01-01T00:00:00Z
+b|https://b.com|tag|||2020-01-03T00:00:00Z|2020-01-02T00:00:00Z
+d|https://d.com|tag|||2020-01-02T00:00:00Z|2020-01-03T00:00:00Z
+`
+		_, err := repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{})
+		r.NoError(err)
+
+		cases := []struct {
+			sort     string
+			order    string
+			expected string
+		}{
+			{"", "", "caebd"},
+			{bookmark.SortID, bookmark.OrderDesc, "dbeac"},
+			{bookmark.SortTitle, bookmark.OrderAsc, "abcde"},
+			{bookmark.SortTitle, bookmark.OrderDesc, "edcba"},
+			{bookmark.SortCreatedAt, bookmark.OrderAsc, "acdbe"},
+			{bookmark.SortCreatedAt, bookmark.OrderDesc, "ebdca"},
+			{bookmark.SortUpdatedAt, bookmark.OrderAsc, "ebdca"},
+		}
+		for _, c := range cases {
+			for _, limit := range []int{0, 1, 2, 5} {
+				opts := bookmark.ListOptions{Limit: limit, Sort: c.sort, Order: c.order}
+				titles := ""
+				pages := 0
+				for {
+					bms, next, err := repo.List(ctx, opts)
+					r.NoError(err)
+					if limit > 0 {
+						r.True(len(bms) <= limit)
+					}
+					for _, bm := range bms {
+						titles += bm.Title
+					}
+					pages++
+					if next == "" {
+						break
+					}
+					opts.Cursor = next
+				}
+				r.Equal(c.expected, titles, "%s %s %d", c.sort, c.order, limit)
+				if limit > 0 {
+					r.Equal((5+limit-1)/limit, pages, "%s %s %d", c.sort, c.order, limit)
+				}
+			}
+		}
+	})
+}
+
+func Test_ListFollowsChangesOfSortedBookmarks(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		testCSV := `title|url|tags|notes|document|created_at|updated_at
+h|https://h.com|tag|||2020-01-02T00:00:00Z|2020-01-05T00:00:00Z
+c|https://c.com|tag|||2020-01-01T00:00:00Z|2020-01-05T00:00:00Z
+k|https://k.com|tag|||2020-01-02T00:00:00Z|2020-01-05T00:00:00Z
+a|https://a.com|tag|||2020-01-03T00:00:00Z|2020-01-05T00:00:00Z
+f|https://f.com|tag|||2020-01-01T00:00:00Z|2020-01-05T00:00:00Z
+l|https://l.com|tag|||2020-01-02T00:00:00Z|2020-01-05T00:00:00Z
+b|https://b.com|tag|||2019-12-31T00:00:00Z|2020-01-05T00:00:00Z
+j|https://j.com|tag|||2020-01-03T00:00:00Z|2020-01-05T00:00:00Z
+e|https://e.com|tag|||2020-01-01T00:00:00Z|2020-01-05T00:00:00Z
+g|https://g.com|tag|||1969-07-20T20:17:00Z|2020-01-05T00:00:00Z
+d|https://d.com|tag|||2020-01-02T00:00:00Z|2020-01-05T00:00:00Z
+i|https://i.com|tag|||2020-01-01T00:00:00Z|2020-01-05T00:00:00Z
+`
+		_, err := repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{})
+		r.NoError(err)
+		//Changes of sort values move bookmarks in the list.
+		_, err = repo.Update(ctx, &bookmark.Bookmark{ID: 4, Title: "m"}, "Title")
+		r.NoError(err)
+		r.NoError(repo.Delete(ctx, 9))
+		for _, id := range []int{8, 2, 8} {
+			_, err := repo.Visit(ctx, id)
+			r.NoError(err)
+		}
+
+		cases := []struct {
+			sort     string
+			order    string
+			expected string
+		}{
+			{bookmark.SortTitle, bookmark.OrderAsc, "bcdfghijklm"},
+			{bookmark.SortTitle, bookmark.OrderDesc, "mlkjihgfdcb"},
+			{bookmark.SortCreatedAt, bookmark.OrderAsc, "gbcfihkldmj"},
+			{bookmark.SortCreatedAt, bookmark.OrderDesc, "jmdlkhifcbg"},
+			{bookmark.SortUpdatedAt, bookmark.OrderAsc, "hckflbjgdim"},
+			{bookmark.SortUpdatedAt, bookmark.OrderDesc, "midgjblfkch"},
+			{bookmark.SortFrecency, bookmark.OrderAsc, "hkmflbgdicj"},
+			{bookmark.SortFrecency, bookmark.OrderDesc, "jcidgblfmkh"},
+		}
+		list := func(sort, order string, limit int) string {
+			opts := bookmark.ListOptions{Limit: limit, Sort: sort, Order: order}
+			titles := ""
+			for {
+				bms, next, err := repo.List(ctx, opts)
+				r.NoError(err)
+				r.True(len(bms) <= limit)
+				for _, bm := range bms {
+					titles += bm.Title
+				}
+				if next == "" {
+					return titles
+				}
+				opts.Cursor = next
+			}
+		}
+		for _, c := range cases {
+			for _, limit := range []int{1, 3, 4, 10} {
+				r.Equal(c.expected, list(c.sort, c.order, limit), "%s %s %d", c.sort, c.order, limit)
+			}
+		}
+
+		//Cursor stays valid when bookmarks of the previous page change.
+		bms, next, err := repo.List(ctx, bookmark.ListOptions{Limit: 3, Sort: bookmark.SortTitle})
+		r.NoError(err)
+		r.Len(bms, 3)
+		r.NoError(repo.Delete(ctx, bms[2].ID))
+		_, err = repo.Update(ctx, &bookmark.Bookmark{ID: bms[0].ID, Title: "n"}, "Title")
+		r.NoError(err)
+		bms, _, err = repo.List(ctx, bookmark.ListOptions{Limit: 3, Sort: bookmark.SortTitle, Cursor: next})
+		r.NoError(err)
+		r.Equal([]string{"f", "g", "h"}, []string{bms[0].Title, bms[1].Title, bms[2].Title})
+
+		r.NoError(repo.Reindex(ctx))
+		r.Equal("cfghijklmn", list(bookmark.SortTitle, bookmark.OrderAsc, 4))
+		r.Equal("hckfljgimn", list(bookmark.SortUpdatedAt, bookmark.OrderAsc, 4))
+	})
+}
+
+func Test_CannotListBookmarksWithInvalidOptions(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		for i := 0; i < 3; i++ {
+			_, err := repo.Add(ctx, &bookmark.NewBookmark{
+				Title: fmt.Sprintf("title %d", i),
+				URL:   fmt.Sprintf("https://test.com/%d", i),
+			})
+			r.NoError(err)
+		}
+		_, next, err := repo.List(ctx, bookmark.ListOptions{Limit: 1})
+		r.NoError(err)
+		r.NotEmpty(next)
+
+		_, _, err = repo.List(ctx, bookmark.ListOptions{Limit: 1, Cursor: next, Sort: bookmark.SortTitle})
+		r.True(errors.Is(err, bookmark.ErrInvalidCursor))
+		_, _, err = repo.List(ctx, bookmark.ListOptions{Cursor: "garbage"})
+		r.True(errors.Is(err, bookmark.ErrInvalidCursor))
+		_, _, err = repo.List(ctx, bookmark.ListOptions{Sort: "notes"})
+		r.True(errors.Is(err, bookmark.ErrInvalidSort))
+		_, _, err = repo.List(ctx, bookmark.ListOptions{Order: "up"})
+		r.True(errors.Is(err, bookmark.ErrInvalidSort))
+	})
+}
+
 func Test_CanImportCSV(t *testing.T) {
 	withTestStore(func(repo *bookmark.Store) {
 		r := require.New(t)
@@ -290,10 +942,10 @@ test title|https://test.com|tag|test Note||2020-03-04T18:23:43Z|2020-03-04T18:23
 			Tags:  []string{"tag"},
 		}}
 
-		err := repo.ImportCSV(context.Background(), strings.NewReader(testCSV))
+		_, err := repo.ImportCSV(context.Background(), strings.NewReader(testCSV), bookmark.ImportOptions{})
 		r.NoError(err)
 
-		bms, err := repo.List(context.Background())
+		bms, _, err := repo.List(context.Background(), bookmark.ListOptions{})
 		r.NoError(err)
 		r.NotNil(bms)
 		r.Len(bms, 1)
@@ -304,24 +956,1011 @@ test title|https://test.com|tag|test Note||2020-03-04T18:23:43Z|2020-03-04T18:23
 	})
 }
 
-func withTestStore(f func(repo *bookmark.Store)) {
-	dbFile, err := ioutil.TempFile("", "librarian_*.db")
-	if err != nil {
-		log.Fatalf("cannot create temp database file: %s", err)
-	}
-	dbPath := dbFile.Name()
-	if err := dbFile.Close(); err != nil {
-		log.Fatalf("cannot close temp database file: %s", err)
-	}
+const importModesCSV = `title|url|tags|notes|document|created_at|updated_at
+first|https://first.com||"multi
+line"||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+stored|https://stored.com||||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+invalid time|https://invalid.com||||yesterday|2020-03-04T18:23:43Z
+second|https://second.com||||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+first again|https://first.com||||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+|https://no-title.com||||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+too|few|fields
+`
 
-	db, err := storm.Open(dbPath)
-	if err != nil {
-		log.Fatalf("cannot open temp database: %s", err)
-	}
-	defer db.Close()
-	defer os.Remove(dbPath)
+func Test_ImportCSVReportsRowsWithLineNumbers(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
 
-	repo := bookmark.NewStore(db)
-	f(repo)
+		stored, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Stored", URL: "https://stored.com"})
+		r.NoError(err)
+
+		report, err := repo.ImportCSV(
+			ctx,
+			strings.NewReader(importModesCSV),
+			bookmark.ImportOptions{Mode: bookmark.ImportLenient},
+		)
+		r.NoError(err)
+		r.Equal(bookmark.ImportLenient, report.Mode)
+		r.True(report.Committed)
+		r.Empty(report.Skipped)
+
+		lines := func(rows []bookmark.ImportRow) []int {
+			ls := []int{}
+			for _, row := range rows {
+				ls = append(ls, row.Line)
+			}
+			return ls
+		}
+		r.Equal([]int{2, 6}, lines(report.Inserted))
+		r.Equal([]int{4, 7}, lines(report.Duplicates))
+		r.Equal([]int{5, 8, 9}, lines(report.Invalid))
+
+		r.Equal(stored.ID, report.Duplicates[0].ID)
+		r.Equal("https://stored.com", report.Duplicates[0].URL)
+		r.Equal(report.Inserted[0].ID, report.Duplicates[1].ID)
+		r.Contains(report.Duplicates[1].Error, "line 2")
+		r.Contains(report.Invalid[0].Error, "created_at")
+
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+		r.Len(bms, 3)
+		bm, err := repo.Get(ctx, report.Inserted[0].ID)
+		r.NoError(err)
+		r.Equal("multi\nline", bm.Notes)
+	})
+}
 
+func Test_StrictImportCSVIsRolledBackOnInvalidRows(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		report, err := repo.ImportCSV(ctx, strings.NewReader(importModesCSV), bookmark.ImportOptions{})
+		r.True(errors.Is(err, bookmark.ErrImportRolledBack))
+		r.Equal(bookmark.ImportStrict, report.Mode)
+		r.False(report.Committed)
+		r.Len(report.Inserted, 3)
+		for _, row := range report.Inserted {
+			r.Zero(row.ID)
+		}
+
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+		r.Empty(bms)
+		hits, err := repo.Search(ctx, "first", 0)
+		r.NoError(err)
+		r.Empty(hits)
+	})
+}
+
+func Test_DryRunImportCSVDoesntSaveBookmarks(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		testCSV := `title|url|tags|notes|document|created_at|updated_at
+test title|https://test.com|tag|test Note||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+`
+		report, err := repo.ImportCSV(
+			ctx,
+			strings.NewReader(testCSV),
+			bookmark.ImportOptions{Mode: bookmark.ImportDryRun},
+		)
+		r.NoError(err)
+		r.False(report.Committed)
+		r.Len(report.Inserted, 1)
+		r.Equal(2, report.Inserted[0].Line)
+
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+		r.Empty(bms)
+
+		_, err = repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{Mode: "unknown"})
+		r.True(errors.Is(err, bookmark.ErrInvalidImportMode))
+		_, err = repo.ImportCSV(ctx, strings.NewReader("title|url\n"), bookmark.ImportOptions{})
+		r.True(errors.Is(err, bookmark.ErrInvalidCSV))
+		_, err = repo.ImportCSV(ctx, strings.NewReader(""), bookmark.ImportOptions{})
+		r.True(errors.Is(err, bookmark.ErrInvalidCSV))
+	})
+}
+
+func Test_ImportCSVResolvesConflictsByPolicy(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		stored, err := repo.Add(ctx, &bookmark.NewBookmark{
+			Title: "stored",
+			URL:   "https://stored.com",
+			Tags:  []string{"a"},
+		})
+		r.NoError(err)
+
+		testCSV := `title|url|tags|notes|document|created_at|updated_at
+stored|https://stored.com|b|||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+new|https://new.com||||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+`
+		report, err := repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{
+			Conflict: bookmark.ConflictMergeTags,
+		})
+		r.NoError(err)
+		r.True(report.Committed)
+		r.Len(report.Inserted, 1)
+		r.Len(report.Updated, 1)
+		r.Equal(stored.ID, report.Updated[0].ID)
+		bm, err := repo.Get(ctx, stored.ID)
+		r.NoError(err)
+		r.Equal([]string{"a", "b"}, bm.Tags)
+
+		//Stored bookmark was updated after 2020, so it's kept.
+		report, err = repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{
+			Conflict: bookmark.ConflictKeepNewer,
+		})
+		r.NoError(err)
+		r.True(report.Committed)
+		r.Empty(report.Inserted)
+		r.Len(report.Duplicates, 2)
+
+		_, err = repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{Conflict: "unknown"})
+		r.True(errors.Is(err, bookmark.ErrInvalidConflictPolicy))
+	})
+}
+
+func Test_CanExportCSV(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		buf := &bytes.Buffer{}
+		r.NoError(repo.ExportCSV(ctx, buf))
+		r.Equal("title|url|tags|notes|document|created_at|updated_at|kind|content|collections\n", buf.String())
+
+		testCSV := `title|url|tags|notes|document|created_at|updated_at|kind|content|collections
+test title|https://test.com|tag;other tag|"test
+Note"|"<p>""quoted""</p>"|2020-03-04T18:23:43Z|2020-03-04T18:23:43.123456789Z|url||work/infra;reading
+"a|b"|https://test2.com||||2020-03-05T18:23:43Z|2020-03-05T18:23:43Z|url||
+pods||k8s|||2020-03-06T18:23:43Z|2020-03-06T18:23:43Z|cmd|kubectl get pods -A|work/infra/k8s
+`
+		_, err := repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{})
+		r.NoError(err)
+
+		buf.Reset()
+		r.NoError(repo.ExportCSV(ctx, buf))
+		r.Equal(testCSV, buf.String())
+
+		expected, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+
+		withTestStore(func(other *bookmark.Store) {
+			_, err := other.ImportCSV(ctx, bytes.NewReader(buf.Bytes()), bookmark.ImportOptions{})
+			r.NoError(err)
+			bms, _, err := other.List(ctx, bookmark.ListOptions{})
+			r.NoError(err)
+			r.Len(bms, len(expected))
+			for i := range bms {
+				r.Equal(expected[i].Title, bms[i].Title)
+				r.Equal(expected[i].URL, bms[i].URL)
+				r.Equal(expected[i].Tags, bms[i].Tags)
+				r.True(expected[i].CreatedAt.Equal(bms[i].CreatedAt))
+				r.True(expected[i].UpdatedAt.Equal(bms[i].UpdatedAt))
+			}
+			bm, err := other.Get(ctx, bms[0].ID)
+			r.NoError(err)
+			r.Equal("test\nNote", bm.Notes)
+			r.Equal(`<p>"quoted"</p>`, bm.Document)
+			r.Equal([]string{"work/infra", "reading"}, bm.Collections)
+			bm, err = other.Get(ctx, bms[2].ID)
+			r.NoError(err)
+			r.Equal(bookmark.KindCmd, bm.Kind)
+			r.Equal("kubectl get pods -A", bm.Content)
+		})
+	})
+}
+
+func Test_CanImportHTML(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		testHTML := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1583346223">Programming</H3>
+    <DL><p>
+        <DT><H3>Go</H3>
+        <DL><p>
+            <DT><A HREF="https://golang.org" ADD_DATE="1583346223" LAST_MODIFIED="1583432623" TAGS="lang,Go">The Go <b>Programming</b> Language</A>
+            <DD>Official &amp; <i>great</i>
+site
+        </DL><p>
+        <DT><A HREF="place:sort=8&maxResults=10">Most Visited</A>
+    </DL><p>
+    <DT><A HREF="https://test.com" ADD_DATE="1583346223123">Test</A>
+</DL><p>
+`
+		report, err := repo.ImportHTML(ctx, strings.NewReader(testHTML), bookmark.ImportOptions{})
+		r.NoError(err)
+		r.Len(report.Inserted, 2)
+		r.Equal(10, report.Inserted[0].Line)
+		r.Len(report.Skipped, 1)
+		r.Equal(14, report.Skipped[0].Line)
+
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+		r.Len(bms, 2)
+
+		bm, err := repo.Get(ctx, bms[0].ID)
+		r.NoError(err)
+		r.Equal("The Go Programming Language", bm.Title)
+		r.Equal("https://golang.org", bm.URL)
+		r.Equal([]string{"programming", "go", "lang"}, bm.Tags)
+		r.Equal([]string{"Programming/Go"}, bm.Collections)
+		r.Equal("Official & great\nsite", bm.Notes)
+		r.True(time.Unix(1583346223, 0).Equal(bm.CreatedAt))
+		r.True(time.Unix(1583432623, 0).Equal(bm.UpdatedAt))
+
+		bm, err = repo.Get(ctx, bms[1].ID)
+		r.NoError(err)
+		r.Equal("Test", bm.Title)
+		r.Empty(bm.Tags)
+		r.True(time.Unix(1583346223, 123*int64(time.Millisecond)).Equal(bm.CreatedAt))
+	})
+}
+
+func Test_CanExportHTML(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{
+			Title: "Fish & <Chips>",
+			URL:   "https://test.com/?a=1&b=2",
+			Tags:  []string{"food", "uk"},
+			Notes: "tasty",
+		})
+		r.NoError(err)
+		_, err = repo.Add(ctx, &bookmark.NewBookmark{Title: "Other", URL: "https://test2.com"})
+		r.NoError(err)
+
+		buf := &bytes.Buffer{}
+		r.NoError(repo.ExportHTML(ctx, buf))
+		r.True(strings.HasPrefix(buf.String(), "<!DOCTYPE NETSCAPE-Bookmark-file-1>"))
+		r.Contains(buf.String(), `<DT><A HREF="https://test.com/?a=1&amp;b=2" `)
+		r.Contains(buf.String(), ` TAGS="food,uk">Fish &amp; &lt;Chips&gt;</A>`)
+		r.Contains(buf.String(), "<DD>tasty\n")
+
+		expected, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+
+		withTestStore(func(other *bookmark.Store) {
+			_, err := other.ImportHTML(ctx, bytes.NewReader(buf.Bytes()), bookmark.ImportOptions{})
+			r.NoError(err)
+			bms, _, err := other.List(ctx, bookmark.ListOptions{})
+			r.NoError(err)
+			r.Len(bms, len(expected))
+			for i := range bms {
+				r.Equal(expected[i].Title, bms[i].Title)
+				r.Equal(expected[i].URL, bms[i].URL)
+				r.Equal(expected[i].Tags, bms[i].Tags)
+				r.Equal(expected[i].CreatedAt.Unix(), bms[i].CreatedAt.Unix())
+			}
+			bm, err := other.Get(ctx, bms[0].ID)
+			r.NoError(err)
+			r.Equal("tasty", bm.Notes)
+		})
+	})
+}
+
+func Test_SearchIndexIsKeptInSync(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{
+			Title: "Effective Go",
+			URL:   "https://golang.org/doc/effective_go.html",
+			Tags:  []string{"go", "docs"},
+			Notes: "Tips for writing clear, idiomatic code.",
+		})
+		r.NoError(err)
+
+		hits, err := repo.Search(ctx, "idiomatic", 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+		r.Equal(bm.ID, hits[0].Bookmark.ID)
+		r.Equal("Tips for writing clear, <mark>idiomatic</mark> code.", hits[0].Highlights["notes"])
+
+		hits, err = repo.Search(ctx, "tag:docs title:effective", 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+
+		_, err = repo.Update(ctx, &bookmark.Bookmark{ID: bm.ID, Notes: "Conventions."}, "Notes")
+		r.NoError(err)
+		hits, err = repo.Search(ctx, "idiomatic", 0)
+		r.NoError(err)
+		r.Empty(hits)
+		hits, err = repo.Search(ctx, "convention", 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+
+		bm.Title = "Go proverbs"
+		_, err = repo.Update(ctx, bm)
+		r.NoError(err)
+		hits, err = repo.Search(ctx, `"go proverbs"`, 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+
+		r.NoError(repo.Delete(ctx, bm.ID))
+		hits, err = repo.Search(ctx, "proverbs", 0)
+		r.NoError(err)
+		r.Empty(hits)
+
+		testCSV := `title|url|tags|notes|document|created_at|updated_at
+test title|https://test.com|tag|test Note|Imported document body|2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+`
+		_, err = repo.ImportCSV(ctx, strings.NewReader(testCSV), bookmark.ImportOptions{})
+		r.NoError(err)
+		hits, err = repo.Search(ctx, "document:body", 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+	})
+}
+
+func Test_CanReindex(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Storm", URL: "https://github.com/asdine/storm"})
+		r.NoError(err)
+
+		r.NoError(repo.Reindex(ctx))
+		r.NoError(repo.Reindex(ctx))
+
+		hits, err := repo.Search(ctx, "storm", 10)
+		r.NoError(err)
+		r.Len(hits, 1)
+	})
+}
+
+func Test_VisitsRankBookmarksByFrecency(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		ids := []int{}
+		for _, p := range []string{"tour", "docs", "blog"} {
+			bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Go " + p, URL: "https://go.dev/" + p})
+			r.NoError(err)
+			ids = append(ids, bm.ID)
+		}
+		for _, id := range []int{ids[2], ids[1], ids[2]} {
+			_, err := repo.Visit(ctx, id)
+			r.NoError(err)
+		}
+		_, err := repo.Visit(ctx, 100)
+		r.Equal(bookmark.ErrNotFound, err)
+
+		bm, err := repo.Get(ctx, ids[2])
+		r.NoError(err)
+		r.Equal(2, bm.Visits)
+		r.False(bm.VisitedAt.IsZero())
+		r.InDelta(2, bm.Frecency(time.Now()), 0.01)
+		r.InDelta(1, bm.Frecency(time.Now().Add(bookmark.FrecencyHalfLife)), 0.01)
+
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{Sort: bookmark.SortFrecency, Order: bookmark.OrderDesc})
+		r.NoError(err)
+		r.Len(bms, 3)
+		r.Equal([]int{ids[2], ids[1], ids[0]}, []int{bms[0].ID, bms[1].ID, bms[2].ID})
+		r.Equal(2, bms[0].Visits)
+		r.Zero(bms[2].Frecency)
+
+		hits, err := repo.Search(ctx, "go", 2)
+		r.NoError(err)
+		r.Len(hits, 2)
+		r.Equal(ids[2], hits[0].Bookmark.ID)
+		r.Equal(ids[1], hits[1].Bookmark.ID)
+	})
+}
+
+func Test_CanManageTags(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		a, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "A", URL: "https://a.com", Tags: []string{" GoLang", "", "db", "golang"}})
+		r.NoError(err)
+		r.Equal([]string{"golang", "db"}, a.Tags)
+		b, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "B", URL: "https://b.com", Tags: []string{"go", "web"}})
+		r.NoError(err)
+
+		tags, err := repo.Tags(ctx)
+		r.NoError(err)
+		r.Equal([]*bookmark.TagCount{{"db", 1}, {"go", 1}, {"golang", 1}, {"web", 1}}, tags)
+
+		_, err = repo.RenameTag(ctx, "golang", "Go")
+		r.True(errors.Is(err, bookmark.ErrTagExists))
+		_, err = repo.RenameTag(ctx, "missing", "other")
+		r.Equal(bookmark.ErrTagNotFound, err)
+		_, err = repo.RenameTag(ctx, "db", " ")
+		r.True(errors.Is(err, bookmark.ErrInvalidTag))
+
+		n, err := repo.RenameTag(ctx, "DB", "database")
+		r.NoError(err)
+		r.Equal(1, n)
+
+		n, err = repo.MergeTags(ctx, []string{"golang", "go"}, "go")
+		r.NoError(err)
+		r.Equal(1, n)
+		a, err = repo.Get(ctx, a.ID)
+		r.NoError(err)
+		r.Equal([]string{"go", "database"}, a.Tags)
+
+		n, err = repo.MergeTags(ctx, []string{"database", "web"}, "go")
+		r.NoError(err)
+		r.Equal(2, n)
+		b, err = repo.Get(ctx, b.ID)
+		r.NoError(err)
+		r.Equal([]string{"go"}, b.Tags)
+
+		bms, err := repo.Query(ctx, bookmark.Query{AllTags: []string{"Go"}})
+		r.NoError(err)
+		r.Len(bms, 2)
+
+		n, err = repo.DeleteTag(ctx, "go")
+		r.NoError(err)
+		r.Equal(2, n)
+		tags, err = repo.Tags(ctx)
+		r.NoError(err)
+		r.Empty(tags)
+		hits, err := repo.Search(ctx, "tag:go", 0)
+		r.NoError(err)
+		r.Empty(hits)
+	})
+}
+
+func Test_CanManageCollections(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		paths := func() []string {
+			cs, err := repo.Collections(ctx)
+			r.NoError(err)
+			ps := []string{}
+			for _, c := range cs {
+				ps = append(ps, c.Path)
+			}
+			return ps
+		}
+		titles := func(q bookmark.Query) []string {
+			bms, err := repo.Query(ctx, q)
+			r.NoError(err)
+			ts := []string{}
+			for _, bm := range bms {
+				ts = append(ts, bm.Title)
+			}
+			return ts
+		}
+
+		k8s, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "k8s", URL: "https://k8s.io", Collections: []string{"/work/ infra/k8s/", "reading"}})
+		r.NoError(err)
+		r.Equal([]string{"work/infra/k8s", "reading"}, k8s.Collections)
+		_, err = repo.Add(ctx, &bookmark.NewBookmark{Title: "infra", URL: "https://infra.com", Collections: []string{"work/infra"}})
+		r.NoError(err)
+		_, err = repo.Add(ctx, &bookmark.NewBookmark{Title: "worklog", URL: "https://worklog.com", Collections: []string{"worklog"}})
+		r.NoError(err)
+		r.Equal([]string{"reading", "work", "work/infra", "work/infra/k8s", "worklog"}, paths())
+
+		r.Equal([]string{"k8s", "infra"}, titles(bookmark.Query{Collection: "work/"}))
+		r.Equal([]string{"k8s"}, titles(bookmark.Query{Collection: "work/infra/k8s"}))
+
+		_, err = repo.CreateCollection(ctx, "work/infra")
+		r.True(errors.Is(err, bookmark.ErrCollectionExists))
+		c, err := repo.CreateCollection(ctx, "archive/2020")
+		r.NoError(err)
+		r.Equal("2020", c.Name)
+
+		_, err = repo.MoveCollection(ctx, "work", "work/old")
+		r.True(errors.Is(err, bookmark.ErrInvalidCollection))
+		_, err = repo.MoveCollection(ctx, "missing", "other")
+		r.True(errors.Is(err, bookmark.ErrCollectionNotFound))
+		_, err = repo.MoveCollection(ctx, "work/infra", "reading")
+		r.True(errors.Is(err, bookmark.ErrCollectionExists))
+		c, err = repo.MoveCollection(ctx, "work/infra", "ops/platform")
+		r.NoError(err)
+		r.Equal("platform", c.Name)
+		r.Equal([]string{"archive", "archive/2020", "ops", "ops/platform", "ops/platform/k8s", "reading", "work", "worklog"}, paths())
+		k8s, err = repo.Get(ctx, k8s.ID)
+		r.NoError(err)
+		r.Equal([]string{"ops/platform/k8s", "reading"}, k8s.Collections)
+
+		n, err := repo.DeleteCollection(ctx, "worklog", "archive")
+		r.NoError(err)
+		r.Equal(1, n)
+		r.Equal([]string{"worklog"}, titles(bookmark.Query{Collection: "archive"}))
+
+		_, err = repo.DeleteCollection(ctx, "ops", "ops/platform")
+		r.True(errors.Is(err, bookmark.ErrInvalidCollection))
+		n, err = repo.DeleteCollection(ctx, "ops", "")
+		r.NoError(err)
+		r.Equal(2, n)
+		r.Equal([]string{"archive", "archive/2020", "reading", "work"}, paths())
+		r.Equal([]string{"k8s", "worklog"}, titles(bookmark.Query{}))
+		k8s, err = repo.Get(ctx, k8s.ID)
+		r.NoError(err)
+		r.Equal([]string{"reading"}, k8s.Collections)
+	})
+}
+
+func Test_ExportHTMLWritesCollectionsAsFolders(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Go", URL: "https://golang.org", Collections: []string{"Programming/Go"}})
+		r.NoError(err)
+		_, err = repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com"})
+		r.NoError(err)
+
+		buf := &bytes.Buffer{}
+		r.NoError(repo.ExportHTML(ctx, buf))
+		r.Contains(buf.String(), `<DL><p>
+    <DT><H3>Programming</H3>
+    <DL><p>
+        <DT><H3>Go</H3>
+        <DL><p>
+            <DT><A HREF="https://golang.org" `)
+		r.Contains(buf.String(), `    </DL><p>
+    <DT><A HREF="https://test.com" `)
+
+		withTestStore(func(other *bookmark.Store) {
+			_, err := other.ImportHTML(ctx, bytes.NewReader(buf.Bytes()), bookmark.ImportOptions{})
+			r.NoError(err)
+			bm, err := other.GetByURL(ctx, "https://golang.org")
+			r.NoError(err)
+			r.Equal([]string{"Programming/Go"}, bm.Collections)
+		})
+	})
+}
+
+func Test_AddedBookmarksAreFetchedInBackground(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			fmt.Fprint(w, `<html><body><nav>Menu</nav><p>Bolt is a key/value store.</p></body></html>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "page", URL: ts.URL + "/page"})
+		r.NoError(err)
+		r.Equal(bookmark.FetchPending, bm.FetchStatus)
+		missing, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "missing", URL: ts.URL + "/missing"})
+		r.NoError(err)
+
+		errs := make(chan error, 1)
+		go func() {
+			errs <- repo.RunFetcher(ctx, func(id int, err error) {
+				t.Errorf("error fetching bookmark %d: %v", id, err)
+			})
+		}()
+
+		r.Eventually(func() bool {
+			bm, err := repo.Get(ctx, missing.ID)
+			return err == nil && bm.FetchStatus != bookmark.FetchPending
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+		r.NoError(<-errs)
+
+		bm, err = repo.Get(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal(bookmark.FetchDone, bm.FetchStatus)
+		r.Equal("Bolt is a key/value store.", bm.Document)
+		r.False(bm.FetchedAt.IsZero())
+		hits, err := repo.Search(ctx, "document:bolt", 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+
+		missing, err = repo.Get(ctx, missing.ID)
+		r.NoError(err)
+		r.Equal(bookmark.FetchFailed, missing.FetchStatus)
+		r.Contains(missing.FetchError, "404")
+		r.Empty(missing.Document)
+	}, bookmark.WithFetcher(fetch.New()))
+}
+
+func Test_CanRefetchBookmark(t *testing.T) {
+	text := "first version"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, text)
+	}))
+	defer ts.Close()
+
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "page", URL: ts.URL})
+		r.NoError(err)
+		bm, err = repo.Refetch(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal(bookmark.FetchDone, bm.FetchStatus)
+		r.Equal("first version", bm.Document)
+
+		text = "second version"
+		bm, err = repo.Refetch(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal("second version", bm.Document)
+
+		_, err = repo.Refetch(ctx, bm.ID+1)
+		r.Equal(bookmark.ErrNotFound, err)
+	}, bookmark.WithFetcher(fetch.New()))
+
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "page", URL: ts.URL})
+		r.NoError(err)
+		r.Empty(bm.FetchStatus)
+		_, err = repo.Refetch(ctx, bm.ID)
+		r.Equal(bookmark.ErrNoFetcher, err)
+	})
+
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Kind: bookmark.KindCmd, Content: "ls"})
+		r.NoError(err)
+		_, err = repo.Refetch(ctx, bm.ID)
+		r.Equal(bookmark.ErrNotURL, err)
+	}, bookmark.WithFetcher(fetch.New()))
+}
+
+func Test_CheckLinksRecordsHealth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok", "/new", "/taken":
+		case "/moved":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/moved-to-taken":
+			http.Redirect(w, r, "/taken", http.StatusMovedPermanently)
+		case "/temporary":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		ids := map[string]int{}
+		for _, path := range []string{"/ok", "/moved", "/moved-to-taken", "/taken", "/temporary", "/gone"} {
+			bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: path, URL: ts.URL + path})
+			r.NoError(err)
+			ids[path] = bm.ID
+		}
+
+		for i := 1; i <= 2; i++ {
+			report, err := repo.CheckLinks(ctx, bookmark.CheckOptions{Concurrency: 2})
+			r.NoError(err)
+			r.Equal(&bookmark.CheckReport{Checked: 6, OK: 2, Redirected: 3, Broken: 1}, report)
+
+			gone, err := repo.Get(ctx, ids["/gone"])
+			r.NoError(err)
+			r.Equal(bookmark.HealthBroken, gone.Health)
+			r.Equal(http.StatusNotFound, gone.StatusCode)
+			r.Equal(i, gone.CheckFailures)
+			r.False(gone.CheckedAt.IsZero())
+		}
+
+		temporary, err := repo.Get(ctx, ids["/temporary"])
+		r.NoError(err)
+		r.Equal(bookmark.HealthRedirected, temporary.Health)
+		r.Equal(ts.URL+"/ok", temporary.RedirectURL)
+
+		report, err := repo.CheckLinks(ctx, bookmark.CheckOptions{RewriteRedirects: true})
+		r.NoError(err)
+		r.Equal(1, report.Rewritten)
+		r.Equal(3, report.OK)
+		moved, err := repo.Get(ctx, ids["/moved"])
+		r.NoError(err)
+		r.Equal(ts.URL+"/new", moved.URL)
+		r.Equal(bookmark.HealthOK, moved.Health)
+		//Only permanent redirects are rewritten, and only to URL which isn't
+		//bookmarked already.
+		for _, path := range []string{"/temporary", "/moved-to-taken"} {
+			bm, err := repo.Get(ctx, ids[path])
+			r.NoError(err)
+			r.Equal(ts.URL+path, bm.URL)
+			r.Equal(bookmark.HealthRedirected, bm.Health)
+		}
+
+		bms, err := repo.Query(ctx, bookmark.Query{Health: bookmark.HealthBroken})
+		r.NoError(err)
+		r.Len(bms, 1)
+		r.Equal(ids["/gone"], bms[0].ID)
+	}, bookmark.WithLinkChecker(fetch.New()))
+
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		_, err := repo.CheckLinks(context.Background(), bookmark.CheckOptions{})
+		r.Equal(bookmark.ErrNoLinkChecker, err)
+	})
+}
+
+//archiver captures pages as their URL followed by the counter of captures.
+type archiver struct {
+	captures int
+}
+
+func (a *archiver) Archive(ctx context.Context, url, format string) (*bookmark.Capture, error) {
+	a.captures++
+	return &bookmark.Capture{
+		URL:         url,
+		ContentType: "text/html",
+		Body:        []byte(fmt.Sprintf("%s %d", url, a.captures)),
+	}, nil
+}
+
+func Test_CanSnapshotBookmark(t *testing.T) {
+	dir, err := ioutil.TempDir("", "librarian_blobs_*")
+	if err != nil {
+		log.Fatalf("cannot create temp directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	blobs, err := blob.Open(dir)
+	if err != nil {
+		log.Fatalf("cannot open blob store: %s", err)
+	}
+
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "page", URL: "https://example.com"})
+		r.NoError(err)
+		for i := 1; i <= 2; i++ {
+			s, err := repo.Snapshot(ctx, bm.ID, bookmark.SnapshotHTML)
+			r.NoError(err)
+			r.Equal(i, s.Version)
+			r.Equal(bm.ID, s.BookmarkID)
+			r.Equal("https://example.com", s.URL)
+		}
+		_, err = repo.Snapshot(ctx, bm.ID, "pdf")
+		r.True(errors.Is(err, bookmark.ErrInvalidSnapshotFormat))
+
+		ss, err := repo.Snapshots(ctx, bm.ID)
+		r.NoError(err)
+		r.Len(ss, 2)
+
+		for version, content := range map[int]string{0: "https://example.com 2", 1: "https://example.com 1"} {
+			_, rc, err := repo.OpenSnapshot(ctx, bm.ID, version)
+			r.NoError(err)
+			data, err := ioutil.ReadAll(rc)
+			rc.Close()
+			r.NoError(err)
+			r.Equal(content, string(data))
+		}
+		_, _, err = repo.OpenSnapshot(ctx, bm.ID, 3)
+		r.Equal(bookmark.ErrNotFound, err)
+
+		r.NoError(repo.Delete(ctx, bm.ID))
+		_, err = repo.Snapshots(ctx, bm.ID)
+		r.Equal(bookmark.ErrNotFound, err)
+		_, err = repo.Snapshot(ctx, bm.ID, bookmark.SnapshotHTML)
+		r.Equal(bookmark.ErrNotFound, err)
+	}, bookmark.WithArchiver(&archiver{}, blobs))
+}
+
+//metadataResolver returns metadata of pages by their URL.
+type metadataResolver map[string]*bookmark.Metadata
+
+func (m metadataResolver) ResolveMetadata(ctx context.Context, url string) (*bookmark.Metadata, error) {
+	if md, ok := m[url]; ok {
+		return md, nil
+	}
+	return nil, errors.New("page not found")
+}
+
+func Test_AddPopulatesBookmarkFromPageMetadata(t *testing.T) {
+	resolver := metadataResolver{
+		"https://example.com/a": {
+			Title:         "Page",
+			Description:   "Description of the page.",
+			CanonicalLink: "https://example.com/page",
+			FaviconURL:    "https://example.com/favicon.ico",
+		},
+		"https://example.com/b": {Title: "Page"},
+	}
+
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{URL: "https://example.com/a"})
+		r.NoError(err)
+		r.Equal("Page", bm.Title)
+		r.Equal("Description of the page.", bm.Notes)
+		r.Equal("https://example.com/page", bm.CanonicalLink)
+		r.Equal("https://example.com/favicon.ico", bm.FaviconURL)
+
+		//Title is unique, so bookmark of other page with the same title gets
+		//its URL as title.
+		bm, err = repo.Add(ctx, &bookmark.NewBookmark{URL: "https://example.com/b"})
+		r.NoError(err)
+		r.Equal("https://example.com/b", bm.Title)
+
+		bm, err = repo.Add(ctx, &bookmark.NewBookmark{URL: "https://example.com/missing"})
+		r.NoError(err)
+		r.Equal("https://example.com/missing", bm.Title)
+		r.Empty(bm.FaviconURL)
+
+		//Given fields aren't overwritten.
+		r.NoError(repo.Delete(ctx, 1))
+		bm, err = repo.Add(ctx, &bookmark.NewBookmark{
+			Title: "My title",
+			URL:   "https://example.com/a",
+			Notes: "My notes",
+		})
+		r.NoError(err)
+		r.Equal("My title", bm.Title)
+		r.Equal("My notes", bm.Notes)
+		r.Equal("https://example.com/favicon.ico", bm.FaviconURL)
+	}, bookmark.WithMetadataResolver(resolver))
+}
+
+func withTestStore(f func(repo *bookmark.Store), opts ...bookmark.StoreOption) {
+	dbFile, err := ioutil.TempFile("", "librarian_*.db")
+	if err != nil {
+		log.Fatalf("cannot create temp database file: %s", err)
+	}
+	dbPath := dbFile.Name()
+	if err := dbFile.Close(); err != nil {
+		log.Fatalf("cannot close temp database file: %s", err)
+	}
+
+	db, err := storm.Open(dbPath)
+	if err != nil {
+		log.Fatalf("cannot open temp database: %s", err)
+	}
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	repo := bookmark.NewStore(db, opts...)
+	f(repo)
+
+}
+
+func Test_RevisionsRecordChangesOfBookmark(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := bookmark.WithAuthor(context.Background(), "alice")
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Go", URL: "https://golang.org", Tags: []string{"go"}, Notes: "first line\nsecond line"})
+		r.NoError(err)
+
+		_, err = repo.Update(bookmark.WithAuthor(ctx, "bob"), &bookmark.Bookmark{ID: bm.ID, Title: "Golang", Notes: ""}, "Title", "Notes")
+		r.NoError(err)
+		//Save without change of tracked fields doesn't add revision.
+		_, err = repo.Visit(ctx, bm.ID)
+		r.NoError(err)
+
+		revs, err := repo.History(ctx, bm.ID)
+		r.NoError(err)
+		r.Len(revs, 2)
+		r.Equal(1, revs[0].Version)
+		r.Equal("alice", revs[0].Author)
+		r.Equal([]bookmark.FieldChange{
+			{Field: "Kind", New: bookmark.KindURL},
+			{Field: "Title", New: "Go"},
+			{Field: "URL", New: "https://golang.org"},
+			{Field: "Tags", New: "go"},
+			{Field: "Notes", New: "first line\nsecond line"},
+		}, revs[0].Changes)
+		r.Equal(2, revs[1].Version)
+		r.Equal("bob", revs[1].Author)
+		r.Equal([]bookmark.FieldChange{
+			{Field: "Title", Old: "Go", New: "Golang"},
+			{Field: "Notes", Old: "first line\nsecond line"},
+		}, revs[1].Changes)
+
+		restored, err := repo.Restore(ctx, bm.ID, 1)
+		r.NoError(err)
+		r.Equal("Go", restored.Title)
+		r.Equal("first line\nsecond line", restored.Notes)
+		revs, err = repo.History(ctx, bm.ID)
+		r.NoError(err)
+		r.Len(revs, 3)
+		r.Equal(revs[0].State, revs[2].State)
+
+		_, err = repo.Restore(ctx, bm.ID, 4)
+		r.Equal(bookmark.ErrRevisionNotFound, err)
+		_, err = repo.History(ctx, bm.ID+1)
+		r.Equal(bookmark.ErrNotFound, err)
+
+		//Revisions are kept after the bookmark is deleted.
+		r.NoError(repo.Delete(ctx, bm.ID))
+		revs, err = repo.History(ctx, bm.ID)
+		r.NoError(err)
+		r.Len(revs, 3)
+	})
+}
+
+func Test_DeletedBookmarksAreKeptInTrash(t *testing.T) {
+	withTestStore(func(repo *bookmark.Store) {
+		r := require.New(t)
+		ctx := context.Background()
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Go", URL: "https://golang.org", Tags: []string{"go"}})
+		r.NoError(err)
+		r.NoError(repo.Delete(ctx, bm.ID))
+
+		_, err = repo.Get(ctx, bm.ID)
+		r.Equal(bookmark.ErrNotFound, err)
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+		r.Empty(bms)
+		hits, err := repo.Search(ctx, "go", 10)
+		r.NoError(err)
+		r.Empty(hits)
+		trash, err := repo.Trash(ctx)
+		r.NoError(err)
+		r.Len(trash, 1)
+		r.Equal(bm.ID, trash[0].ID)
+		r.False(trash[0].DeletedAt.IsZero())
+
+		//URL and title of trashed bookmark can be used again.
+		readded, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Go", URL: "https://golang.org"})
+		r.NoError(err)
+		var dupErr *bookmark.ErrDuplicate
+		_, err = repo.RestoreFromTrash(ctx, bm.ID)
+		r.True(errors.As(err, &dupErr))
+		r.Equal(readded.ID, dupErr.ID)
+
+		r.NoError(repo.Delete(ctx, readded.ID))
+		restored, err := repo.RestoreFromTrash(ctx, bm.ID)
+		r.NoError(err)
+		r.True(restored.DeletedAt.IsZero())
+		hits, err = repo.Search(ctx, "go", 10)
+		r.NoError(err)
+		r.Len(hits, 1)
+		_, err = repo.RestoreFromTrash(ctx, bm.ID)
+		r.Equal(bookmark.ErrNotFound, err)
+
+		//Only bookmarks deleted before given time are purged.
+		n, err := repo.EmptyTrash(ctx, time.Now().Add(-time.Hour))
+		r.NoError(err)
+		r.Equal(0, n)
+		n, err = repo.EmptyTrash(ctx, time.Now())
+		r.NoError(err)
+		r.Equal(1, n)
+		trash, err = repo.Trash(ctx)
+		r.NoError(err)
+		r.Empty(trash)
+	})
+}
+
+func Test_StoreConformsToStorager(t *testing.T) {
+	storagertest.Run(t, func(f func(s bookmark.Storager)) {
+		withTestStore(func(repo *bookmark.Store) {
+			f(repo)
+		})
+	})
 }
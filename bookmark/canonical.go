@@ -0,0 +1,100 @@
+package bookmark
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+//DefaultTrackingParams lists query parameters which are removed from URLs by
+//default, see WithTrackingParams.
+var DefaultTrackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"mc_cid",
+	"mc_eid",
+	"yclid",
+	"igshid",
+}
+
+//StoreOption configures Store.
+type StoreOption func(*Store)
+
+//WithTrackingParams sets query parameters which are removed from canonical
+//URLs. Parameter ending with "*" matches all parameters with given prefix.
+func WithTrackingParams(params ...string) StoreOption {
+	return func(r *Store) {
+		r.trackingParams = params
+	}
+}
+
+//CanonicalURL returns canonical form of the URL, which is used to find
+//bookmarks of the same page under different URLs. Scheme and host are
+//lowercased, http scheme is replaced by https, default port, fragment,
+//trailing slash of the path and tracking parameters are removed, remaining
+//query parameters are sorted. URL which isn't absolute is returned unchanged.
+func CanonicalURL(rawURL string, trackingParams []string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return rawURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := u.Hostname(), u.Port()
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	switch {
+	case u.Scheme == "http" && port == "80", u.Scheme == "https" && port == "443":
+		port = ""
+	}
+	if u.Scheme == "http" && port == "" {
+		u.Scheme = "https"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		//IPv6 address has to be enclosed in brackets.
+		u.Host = "[" + host + "]"
+	}
+
+	u.Fragment = ""
+	if p := strings.TrimRight(u.EscapedPath(), "/"); p != "" {
+		u.RawPath = p
+		u.Path, _ = url.PathUnescape(p)
+	} else {
+		u.Path, u.RawPath = "/", ""
+	}
+
+	q := u.Query()
+	for k := range q {
+		if isTrackingParam(k, trackingParams) {
+			q.Del(k)
+		}
+	}
+	//Encode sorts parameters by key.
+	u.RawQuery = q.Encode()
+	u.ForceQuery = false
+	return u.String()
+}
+
+func isTrackingParam(param string, trackingParams []string) bool {
+	param = strings.ToLower(param)
+	for _, p := range trackingParams {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(param, strings.ToLower(strings.TrimSuffix(p, "*"))) {
+				return true
+			}
+		} else if param == strings.ToLower(p) {
+			return true
+		}
+	}
+	return false
+}
+
+//canonicalURL returns canonical form of the URL with tracking parameters of
+//the store.
+func (r *Store) canonicalURL(rawURL string) string {
+	return CanonicalURL(rawURL, r.trackingParams)
+}
@@ -0,0 +1,293 @@
+package bookmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//CollectionSeparator separates names of nested collections in their path.
+const CollectionSeparator = "/"
+
+var (
+	//ErrInvalidCollection is returned for empty collection paths and for
+	//moves of collection into itself.
+	ErrInvalidCollection = errors.New("invalid collection")
+	//ErrCollectionNotFound is returned when there is no collection with
+	//given path.
+	ErrCollectionNotFound = errors.New("collection not found")
+	//ErrCollectionExists is returned when collection with given path already
+	//exists.
+	ErrCollectionExists = errors.New("collection already exists")
+)
+
+//Collection groups bookmarks in a tree. Path of the collection is made of
+//names of its ancestors and its own name, separated by CollectionSeparator,
+//e.g. work/infra/k8s. Bookmark can belong to several collections.
+type Collection struct {
+	ID int `json:"id" storm:"id,increment"`
+	//ParentID is zero for top level collections.
+	ParentID  int       `json:"parent_id" storm:"index"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path" storm:"unique"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//NormalizeCollection returns the path with names trimmed and empty names
+//dropped, so "/work/ infra/" becomes "work/infra".
+func NormalizeCollection(path string) string {
+	names := []string{}
+	for _, n := range strings.Split(path, CollectionSeparator) {
+		if n = strings.TrimSpace(n); n != "" {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, CollectionSeparator)
+}
+
+//NormalizeCollections normalizes paths with NormalizeCollection, empty and
+//repeated paths are dropped. It returns nil when no paths are left.
+func NormalizeCollections(paths []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, p := range paths {
+		p = NormalizeCollection(p)
+		if p != "" && !seen[p] {
+			seen[p] = true
+			normalized = append(normalized, p)
+		}
+	}
+	return normalized
+}
+
+//inCollection reports whether path is the collection or one of its
+//descendants.
+func inCollection(path, collection string) bool {
+	return path == collection || strings.HasPrefix(path, collection+CollectionSeparator)
+}
+
+//Collections returns all collections ordered by path, so parents precede
+//their children.
+func (r *Store) Collections(ctx context.Context) ([]*Collection, error) {
+	cs := []*Collection{}
+	if err := r.db.All(&cs); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Path < cs[j].Path })
+	return cs, nil
+}
+
+//CreateCollection creates collection with given path, its missing ancestors
+//are created too.
+func (r *Store) CreateCollection(ctx context.Context, path string) (*Collection, error) {
+	if path = NormalizeCollection(path); path == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrInvalidCollection)
+	}
+	var c *Collection
+	if err := r.withTx(func(tx storm.Node) error {
+		err := tx.One("Path", path, &Collection{})
+		if err == nil {
+			return fmt.Errorf("%w: %q", ErrCollectionExists, path)
+		}
+		if err != storm.ErrNotFound {
+			return err
+		}
+		c, err = ensureCollection(tx, path)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//MoveCollection changes path of the collection from to the path to, which
+//can rename the collection or move it under other parent. Descendants of
+//the collection and its bookmarks are moved along.
+func (r *Store) MoveCollection(ctx context.Context, from, to string) (*Collection, error) {
+	from, to = NormalizeCollection(from), NormalizeCollection(to)
+	if from == "" || to == "" {
+		return nil, fmt.Errorf("%w: empty path", ErrInvalidCollection)
+	}
+	if inCollection(to, from) {
+		return nil, fmt.Errorf("%w: %q can't be moved into itself", ErrInvalidCollection, from)
+	}
+	moved := &Collection{}
+	if err := r.withTx(func(tx storm.Node) error {
+		if err := tx.One("Path", from, moved); err != nil {
+			if err == storm.ErrNotFound {
+				return fmt.Errorf("%w: %q", ErrCollectionNotFound, from)
+			}
+			return err
+		}
+		err := tx.One("Path", to, &Collection{})
+		if err == nil {
+			return fmt.Errorf("%w: %q", ErrCollectionExists, to)
+		}
+		if err != storm.ErrNotFound {
+			return err
+		}
+
+		moved.ParentID = 0
+		moved.Name = to
+		if i := strings.LastIndex(to, CollectionSeparator); i >= 0 {
+			parent, err := ensureCollection(tx, to[:i])
+			if err != nil {
+				return err
+			}
+			moved.ParentID, moved.Name = parent.ID, to[i+1:]
+		}
+		rename := func(path string) string {
+			if inCollection(path, from) {
+				return to + path[len(from):]
+			}
+			return path
+		}
+
+		cs := []Collection{}
+		if err := tx.All(&cs); err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		for i := range cs {
+			c := &cs[i]
+			if c.ID == moved.ID {
+				c = moved
+			} else if !inCollection(c.Path, from) {
+				continue
+			}
+			c.Path = rename(c.Path)
+			if err := tx.Save(c); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		return r.updateMembership(tx, from, func(bm *Bookmark) error {
+			for i, p := range bm.Collections {
+				bm.Collections[i] = rename(p)
+			}
+			bm.UpdatedAt = now
+			return r.save(ctx, tx, bm)
+		})
+	}); err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+//DeleteCollection deletes the collection with its descendants and returns
+//the number of bookmarks which belonged to them. When reassign is given,
+//the bookmarks are moved to that collection. Otherwise the deletion cascades
+//to the bookmarks: they are removed from the collections and those which are
+//left in no collection are moved to the trash.
+func (r *Store) DeleteCollection(ctx context.Context, path, reassign string) (int, error) {
+	if path = NormalizeCollection(path); path == "" {
+		return 0, fmt.Errorf("%w: empty path", ErrInvalidCollection)
+	}
+	reassign = NormalizeCollection(reassign)
+	if reassign != "" && inCollection(reassign, path) {
+		return 0, fmt.Errorf("%w: bookmarks can't be reassigned to deleted collection %q", ErrInvalidCollection, reassign)
+	}
+	updated := 0
+	if err := r.withTx(func(tx storm.Node) error {
+		if err := tx.One("Path", path, &Collection{}); err != nil {
+			if err == storm.ErrNotFound {
+				return fmt.Errorf("%w: %q", ErrCollectionNotFound, path)
+			}
+			return err
+		}
+		if reassign != "" {
+			if err := tx.One("Path", reassign, &Collection{}); err != nil {
+				if err == storm.ErrNotFound {
+					return fmt.Errorf("%w: %q", ErrCollectionNotFound, reassign)
+				}
+				return err
+			}
+		}
+
+		cs := []Collection{}
+		if err := tx.All(&cs); err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		for i := range cs {
+			if !inCollection(cs[i].Path, path) {
+				continue
+			}
+			if err := tx.DeleteStruct(&cs[i]); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now().UTC()
+		return r.updateMembership(tx, path, func(bm *Bookmark) error {
+			updated++
+			kept := []string{}
+			for _, p := range bm.Collections {
+				if !inCollection(p, path) {
+					kept = append(kept, p)
+				}
+			}
+			if reassign != "" {
+				kept = append(kept, reassign)
+			}
+			if len(kept) == 0 {
+				return r.delete(tx, bm.ID)
+			}
+			bm.Collections = kept
+			bm.UpdatedAt = now
+			return r.save(ctx, tx, bm)
+		})
+	}); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+//updateMembership calls update for every bookmark which belongs to the
+//collection or its descendants.
+func (r *Store) updateMembership(tx storm.Node, collection string, update func(*Bookmark) error) error {
+	bms := []Bookmark{}
+	if err := tx.All(&bms); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	for i := range bms {
+		for _, p := range bms[i].Collections {
+			if inCollection(p, collection) {
+				if err := update(&bms[i]); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+//ensureCollection returns collection with given normalized path, which is
+//created with its ancestors when it doesn't exist.
+func ensureCollection(n storm.Node, path string) (*Collection, error) {
+	c := &Collection{}
+	err := n.One("Path", path, c)
+	if err == nil {
+		return c, nil
+	}
+	if err != storm.ErrNotFound {
+		return nil, err
+	}
+	c = &Collection{Name: path, Path: path, CreatedAt: time.Now().UTC()}
+	if i := strings.LastIndex(path, CollectionSeparator); i >= 0 {
+		parent, err := ensureCollection(n, path[:i])
+		if err != nil {
+			return nil, err
+		}
+		c.ParentID, c.Name = parent.ID, path[i+1:]
+	}
+	if err := n.Save(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
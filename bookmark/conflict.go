@@ -0,0 +1,186 @@
+package bookmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//ConflictPolicy decides what happens when added or imported bookmark has
+//canonical URL of the stored one.
+type ConflictPolicy string
+
+//Conflict policies accepted by Add and importers.
+const (
+	//ConflictFail returns ErrDuplicate. It's the default policy.
+	ConflictFail ConflictPolicy = "fail"
+	//ConflictSkip keeps the stored bookmark untouched.
+	ConflictSkip ConflictPolicy = "skip"
+	//ConflictOverwrite replaces kind, title, URL, content, tags, collections
+	//and notes of the stored bookmark, and document when the new bookmark
+	//has one.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	//ConflictMergeTags adds tags of the new bookmark to the stored one.
+	ConflictMergeTags ConflictPolicy = "merge-tags"
+	//ConflictKeepNewer overwrites the stored bookmark only when the new one
+	//was updated later.
+	ConflictKeepNewer ConflictPolicy = "keep-newer"
+)
+
+//ErrInvalidConflictPolicy is returned when Add or importers get unknown
+//conflict policy.
+var ErrInvalidConflictPolicy = errors.New("invalid conflict policy")
+
+//ErrDuplicate is returned when bookmark can't be saved, because other bookmark
+//has the same URL or title.
+type ErrDuplicate struct {
+	//ID of the stored bookmark.
+	ID int
+	//Field is "url" or "title".
+	Field string
+}
+
+func (e *ErrDuplicate) Error() string {
+	return fmt.Sprintf("bookmark %d with the same %s already exists", e.ID, e.Field)
+}
+
+//resolution tells how saveWithPolicy saved the bookmark.
+type resolution int
+
+const (
+	//resolvedInsert means there was no conflict and bookmark was inserted.
+	resolvedInsert resolution = iota
+	//resolvedSkip means stored bookmark was kept untouched.
+	resolvedSkip
+	//resolvedUpdate means stored bookmark was overwritten or merged.
+	resolvedUpdate
+)
+
+func (p ConflictPolicy) validate() error {
+	switch p {
+	case "", ConflictFail, ConflictSkip, ConflictOverwrite, ConflictMergeTags, ConflictKeepNewer:
+		return nil
+	}
+	return fmt.Errorf("%w %q", ErrInvalidConflictPolicy, p)
+}
+
+//saveWithPolicy inserts bm, or resolves conflict with the stored bookmark of
+//the same canonical URL according to the policy. Conflicting title of other
+//bookmark can't be resolved, so ErrDuplicate is returned regardless of the
+//policy. Bookmarks without URL never conflict. It returns the saved or the
+//kept stored bookmark.
+func (r *Store) saveWithPolicy(ctx context.Context, n storm.Node, bm *Bookmark, policy ConflictPolicy) (*Bookmark, resolution, error) {
+	bm.CanonicalURL = r.canonicalURL(bm.URL)
+	stored := &Bookmark{}
+	err := storm.ErrNotFound
+	if bm.URL != "" {
+		err = n.One("CanonicalURL", bm.CanonicalURL, stored)
+	}
+	if err == storm.ErrNotFound && bm.URL != "" {
+		//Bookmarks stored before canonicalization have only original URL.
+		err = n.One("URL", bm.URL, stored)
+	}
+	if err == storm.ErrNotFound {
+		if err := checkUnique(n, bm); err != nil {
+			return nil, 0, err
+		}
+		if bm.Document == "" {
+			r.markPending(bm)
+		}
+		if err := r.save(ctx, n, bm); err != nil {
+			return nil, 0, err
+		}
+		return bm, resolvedInsert, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch policy {
+	case ConflictSkip:
+		return stored, resolvedSkip, nil
+	case ConflictKeepNewer:
+		if !bm.UpdatedAt.After(stored.UpdatedAt) {
+			return stored, resolvedSkip, nil
+		}
+	case ConflictOverwrite:
+	case ConflictMergeTags:
+		tags := mergeTags(stored.Tags, bm.Tags)
+		if len(tags) == len(stored.Tags) {
+			return stored, resolvedSkip, nil
+		}
+		stored.Tags = tags
+		stored.UpdatedAt = time.Now().UTC()
+		if err := r.save(ctx, n, stored); err != nil {
+			return nil, 0, err
+		}
+		return stored, resolvedUpdate, nil
+	default:
+		return nil, 0, &ErrDuplicate{ID: stored.ID, Field: "url"}
+	}
+
+	if bm.Document == "" && bm.URL != stored.URL {
+		r.markPending(stored)
+	}
+	stored.Kind = bm.Kind
+	stored.Title = bm.Title
+	stored.URL = bm.URL
+	stored.CanonicalURL = bm.CanonicalURL
+	stored.Content = bm.Content
+	stored.Tags = bm.Tags
+	stored.Collections = bm.Collections
+	stored.Notes = bm.Notes
+	if bm.Document != "" {
+		stored.Document = bm.Document
+	}
+	if bm.CreatedAt.Before(stored.CreatedAt) {
+		stored.CreatedAt = bm.CreatedAt
+	}
+	stored.UpdatedAt = bm.UpdatedAt
+	if err := checkUnique(n, stored); err != nil {
+		return nil, 0, err
+	}
+	if err := r.save(ctx, n, stored); err != nil {
+		return nil, 0, err
+	}
+	return stored, resolvedUpdate, nil
+}
+
+//checkUnique returns ErrDuplicate when other bookmark has the same URL,
+//canonical URL or title.
+func checkUnique(n storm.Node, bm *Bookmark) error {
+	for _, f := range []struct{ field, name, value string }{
+		{"URL", "url", bm.URL},
+		{"CanonicalURL", "url", bm.CanonicalURL},
+		{"Title", "title", bm.Title},
+	} {
+		if f.value == "" {
+			continue
+		}
+		stored := &Bookmark{}
+		err := n.One(f.field, f.value, stored)
+		if err == nil && stored.ID != bm.ID {
+			return &ErrDuplicate{ID: stored.ID, Field: f.name}
+		}
+		if err != nil && err != storm.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+//mergeTags returns tags followed by new tags which aren't among them.
+func mergeTags(tags, newTags []string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+	for _, t := range append(append([]string{}, tags...), newTags...) {
+		if !seen[t] {
+			seen[t] = true
+			merged = append(merged, t)
+		}
+	}
+	return merged
+}
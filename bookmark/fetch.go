@@ -0,0 +1,166 @@
+package bookmark
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//Fetch statuses of bookmarks. Empty status means the page was never fetched,
+//for example because bookmark was imported with the document.
+const (
+	FetchPending = "pending"
+	FetchDone    = "done"
+	FetchFailed  = "failed"
+)
+
+//fetchQueueSize is the number of bookmarks waiting for the fetcher. Bookmarks
+//which don't fit in the queue stay pending until the next RunFetcher.
+const fetchQueueSize = 1000
+
+//ErrNoFetcher is returned by Refetch and RunFetcher when store has no fetcher.
+var ErrNoFetcher = errors.New("page fetcher is not configured")
+
+//Page is the bookmarked page downloaded by Fetcher.
+type Page struct {
+	//URL of the page after redirects.
+	URL string
+	//Text is readable text of the page, without markup and boilerplate.
+	Text string
+}
+
+//Fetcher downloads bookmarked pages.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*Page, error)
+}
+
+//WithFetcher sets fetcher of bookmarked pages. Added bookmarks, and those
+//whose URL was changed, get FetchPending status and are fetched by
+//RunFetcher. Text of the page is stored in the Document.
+func WithFetcher(f Fetcher) StoreOption {
+	return func(r *Store) {
+		r.fetcher = f
+		r.fetchQueue = make(chan int, fetchQueueSize)
+	}
+}
+
+//Refetch downloads page of the bookmark and stores its text in the Document.
+//Failure of the download isn't returned, it's recorded in FetchStatus and
+//FetchError of the returned bookmark.
+func (r *Store) Refetch(ctx context.Context, id int) (*Bookmark, error) {
+	if r.fetcher == nil {
+		return nil, ErrNoFetcher
+	}
+	bm, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !bm.isURL() {
+		return nil, ErrNotURL
+	}
+	page, fetchErr := r.fetcher.Fetch(ctx, bm.URL)
+	//Download interrupted by the caller isn't a failure of the page.
+	if fetchErr != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	stored := &Bookmark{}
+	if err := r.withTx(func(tx storm.Node) error {
+		if err := tx.One("ID", id, stored); err != nil {
+			return err
+		}
+		//Bookmark got new URL in the meantime, it's queued again.
+		if stored.URL != bm.URL {
+			return nil
+		}
+		stored.FetchedAt = time.Now().UTC()
+		if fetchErr != nil {
+			stored.FetchStatus = FetchFailed
+			stored.FetchError = fetchErr.Error()
+		} else {
+			stored.FetchStatus = FetchDone
+			stored.FetchError = ""
+			stored.Document = page.Text
+		}
+		return r.save(ctx, tx, stored)
+	}); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return stored, nil
+}
+
+//RunFetcher fetches pending bookmarks until ctx is done. Bookmarks left
+//pending by the previous run are fetched first. Errors other than failed
+//downloads are passed to handleErr.
+func (r *Store) RunFetcher(ctx context.Context, handleErr func(id int, err error)) error {
+	if r.fetcher == nil {
+		return ErrNoFetcher
+	}
+	pending := []Bookmark{}
+	if err := r.db.Find("FetchStatus", FetchPending, &pending); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	for _, bm := range pending {
+		if ctx.Err() != nil {
+			return nil
+		}
+		r.refetchQueued(ctx, bm.ID, handleErr)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case id := <-r.fetchQueue:
+			r.refetchQueued(ctx, id, handleErr)
+		}
+	}
+}
+
+func (r *Store) refetchQueued(ctx context.Context, id int, handleErr func(id int, err error)) {
+	//Bookmark added before the run is queued and found pending too, so it
+	//could be fetched already.
+	if bm, err := r.Get(ctx, id); err == nil && bm.FetchStatus != FetchPending {
+		return
+	}
+	bm, err := r.Refetch(ctx, id)
+	//Bookmark could be deleted before it was fetched.
+	if err != nil && err != ErrNotFound && ctx.Err() == nil {
+		handleErr(id, err)
+	}
+	if err != nil || bm.FetchStatus != FetchDone || r.autoSnapshot == "" {
+		return
+	}
+	if _, err := r.Snapshot(ctx, id, r.autoSnapshot); err != nil && err != ErrNotFound && ctx.Err() == nil {
+		handleErr(id, err)
+	}
+}
+
+//markPending sets FetchPending status of web page when store has a fetcher.
+func (r *Store) markPending(bm *Bookmark) {
+	if r.fetcher != nil && bm.isURL() {
+		bm.FetchStatus = FetchPending
+		bm.FetchError = ""
+	}
+}
+
+//enqueueFetch queues pending bookmarks for RunFetcher. It has to be called
+//after the transaction which saved them is committed.
+func (r *Store) enqueueFetch(bms ...*Bookmark) {
+	if r.fetcher == nil {
+		return
+	}
+	for _, bm := range bms {
+		if bm.FetchStatus != FetchPending {
+			continue
+		}
+		select {
+		case r.fetchQueue <- bm.ID:
+		default:
+		}
+	}
+}
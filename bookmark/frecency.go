@@ -0,0 +1,63 @@
+package bookmark
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//FrecencyHalfLife is the time after which weight of a visit drops by half.
+const FrecencyHalfLife = 30 * 24 * time.Hour
+
+//decay is the rate of exponential decay of visit weights per second.
+var decay = math.Ln2 / FrecencyHalfLife.Seconds()
+
+//Visit records access to the bookmark and returns it. Every visit adds one to
+//the frecency of the bookmark, which then decays over time, see Frecency.
+func (r *Store) Visit(ctx context.Context, id int) (*Bookmark, error) {
+	bm := &Bookmark{}
+	if err := r.withTx(func(tx storm.Node) error {
+		if err := tx.One("ID", id, bm); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		bm.Rank = addVisit(bm.Rank, bm.Visits != 0, now)
+		bm.Visits++
+		bm.VisitedAt = now
+		//Indexed text doesn't change, so search index isn't updated.
+		if err := tx.Save(bm); err != nil {
+			return err
+		}
+		return updateSortKeys(tx, bm)
+	}); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return bm, nil
+}
+
+//Frecency returns the number of visits of the bookmark, where each visit is
+//weighted by its age: visit made FrecencyHalfLife ago counts as half.
+func (bm *Bookmark) Frecency(now time.Time) float64 {
+	if bm.Visits == 0 {
+		return 0
+	}
+	return math.Exp(bm.Rank - decay*float64(now.Unix()))
+}
+
+//addVisit returns rank with visit made at t. Rank is the logarithm of the
+//decayed visit count scaled to Unix epoch, ln Σ exp(decay*tᵢ), so it doesn't
+//change over time and orders bookmarks by frecency at any moment.
+func addVisit(rank float64, visited bool, t time.Time) float64 {
+	v := decay * float64(t.Unix())
+	if !visited {
+		return v
+	}
+	//log(exp(a) + exp(b)) computed without overflow.
+	hi, lo := math.Max(rank, v), math.Min(rank, v)
+	return hi + math.Log1p(math.Exp(lo-hi))
+}
@@ -0,0 +1,200 @@
+package bookmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+//ImportMode controls handling of invalid and duplicate rows by importers.
+type ImportMode string
+
+//Import modes accepted by ImportCSV and ImportHTML.
+const (
+	//ImportStrict rolls back whole import when any row is invalid or
+	//duplicate. It's the default mode.
+	ImportStrict ImportMode = "strict"
+	//ImportLenient imports valid rows and skips the others.
+	ImportLenient ImportMode = "lenient"
+	//ImportDryRun only validates rows, nothing is saved.
+	ImportDryRun ImportMode = "dry-run"
+)
+
+var (
+	//ErrInvalidImportMode is returned by importers when they get unknown mode.
+	ErrInvalidImportMode = errors.New("invalid import mode")
+	//ErrInvalidCSV is returned by ImportCSV when the file doesn't start with
+	//the expected header.
+	ErrInvalidCSV = errors.New("invalid csv file")
+	//ErrImportRolledBack is returned by importers in strict mode, when
+	//nothing was imported because of invalid or duplicate rows. Report of
+	//the import is returned along with the error.
+	ErrImportRolledBack = errors.New("import rolled back")
+)
+
+//ImportOptions controls importers.
+type ImportOptions struct {
+	//Mode is one of ImportStrict (default), ImportLenient or ImportDryRun.
+	Mode ImportMode
+	//Conflict is the policy of rows with URL of the stored bookmark, or of
+	//the previous row. Rows are duplicates by default (ConflictFail).
+	Conflict ConflictPolicy
+}
+
+//ImportRow describes single row (or bookmark entry) of the imported file.
+type ImportRow struct {
+	//Line is the line number, counted from 1, where the row starts.
+	Line  int    `json:"line"`
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url,omitempty"`
+	//ID is the ID of inserted or updated bookmark, or of the stored bookmark
+	//which row duplicates. It's zero when the bookmark was inserted by the
+	//import which wasn't committed.
+	ID    int    `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+//ImportReport describes result of the import. Every row of the file is
+//listed in exactly one of the row lists.
+type ImportReport struct {
+	Mode ImportMode `json:"mode"`
+	//Committed is false when the import was rolled back or run in dry-run
+	//mode, Inserted lists then rows which would be inserted.
+	Committed bool `json:"committed"`
+	//Inserted lists rows saved as new bookmarks.
+	Inserted []ImportRow `json:"inserted"`
+	//Updated lists rows which overwrote, or whose tags were merged into, the
+	//stored bookmarks, see ConflictPolicy.
+	Updated []ImportRow `json:"updated"`
+	//Skipped lists entries which can't be imported as bookmarks, like
+	//browser smart bookmarks.
+	Skipped []ImportRow `json:"skipped"`
+	//Duplicates lists rows with URL or title of the stored bookmark, or of
+	//the previous row, which weren't saved. Only those rejected by
+	//ConflictFail policy, or with duplicate title, make strict import fail.
+	Duplicates []ImportRow `json:"duplicates"`
+	//Invalid lists rows which couldn't be parsed or validated.
+	Invalid []ImportRow `json:"invalid"`
+}
+
+//importRecord is a bookmark parsed from the imported file. When the row can't
+//be parsed, bm is nil and err is set.
+type importRecord struct {
+	line  int
+	title string
+	url   string
+	bm    *Bookmark
+	err   error
+	//skip is set for entries which aren't bookmarks, err describes why.
+	skip bool
+}
+
+func (o ImportOptions) mode() (ImportMode, error) {
+	if err := o.Conflict.validate(); err != nil {
+		return "", err
+	}
+	switch o.Mode {
+	case "":
+		return ImportStrict, nil
+	case ImportStrict, ImportLenient, ImportDryRun:
+		return o.Mode, nil
+	}
+	return "", fmt.Errorf("%w %q", ErrInvalidImportMode, o.Mode)
+}
+
+//importRecords saves records in a single transaction, which is committed
+//according to the mode.
+func (r *Store) importRecords(ctx context.Context, recs []importRecord, mode ImportMode, policy ConflictPolicy) (*ImportReport, error) {
+	report := &ImportReport{
+		Mode:       mode,
+		Inserted:   []ImportRow{},
+		Updated:    []ImportRow{},
+		Skipped:    []ImportRow{},
+		Duplicates: []ImportRow{},
+		Invalid:    []ImportRow{},
+	}
+	tx, err := r.db.Begin(true)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	//insertedLines maps IDs of bookmarks inserted by this import to lines.
+	insertedLines := map[int]int{}
+	//failed counts rows which make strict import fail.
+	failed := 0
+	saved := []*Bookmark{}
+	for _, rec := range recs {
+		row := ImportRow{Line: rec.line, Title: rec.title, URL: rec.url}
+		if rec.skip {
+			row.Error = rec.err.Error()
+			report.Skipped = append(report.Skipped, row)
+			continue
+		}
+		if rec.err == nil {
+			rec.err = r.validate.StructExcept(rec.bm, "ID")
+		}
+		if rec.err != nil {
+			row.Error = rec.err.Error()
+			report.Invalid = append(report.Invalid, row)
+			continue
+		}
+
+		bm, res, err := r.saveWithPolicy(ctx, tx, rec.bm, policy)
+		var dupErr *ErrDuplicate
+		if errors.As(err, &dupErr) {
+			row.ID = dupErr.ID
+			row.Error = fmt.Sprintf("bookmark with the same %s already exists", dupErr.Field)
+			if line, ok := insertedLines[dupErr.ID]; ok {
+				row.Error = fmt.Sprintf("bookmark with the same %s is in line %d", dupErr.Field, line)
+			}
+			report.Duplicates = append(report.Duplicates, row)
+			failed++
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		row.ID = bm.ID
+		saved = append(saved, bm)
+		switch res {
+		case resolvedInsert:
+			insertedLines[bm.ID] = rec.line
+			report.Inserted = append(report.Inserted, row)
+		case resolvedUpdate:
+			report.Updated = append(report.Updated, row)
+		case resolvedSkip:
+			row.Error = "skipped, bookmark with the same url already exists"
+			if line, ok := insertedLines[bm.ID]; ok {
+				row.Error = fmt.Sprintf("skipped, bookmark with the same url is in line %d", line)
+			}
+			report.Duplicates = append(report.Duplicates, row)
+		}
+	}
+
+	failed += len(report.Invalid)
+	if mode == ImportDryRun || (mode == ImportStrict && failed != 0) {
+		//IDs of bookmarks inserted by the import are gone with the
+		//transaction.
+		for _, rows := range [][]ImportRow{report.Inserted, report.Updated, report.Duplicates} {
+			for i := range rows {
+				if _, ok := insertedLines[rows[i].ID]; ok {
+					rows[i].ID = 0
+				}
+			}
+		}
+		if mode == ImportStrict {
+			return report, fmt.Errorf(
+				"%w: %d invalid and %d duplicate rows",
+				ErrImportRolledBack, len(report.Invalid), failed-len(report.Invalid),
+			)
+		}
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	r.enqueueFetch(saved...)
+	report.Committed = true
+	return report, nil
+}
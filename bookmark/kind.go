@@ -0,0 +1,75 @@
+package bookmark
+
+import (
+	"errors"
+	"strings"
+
+	validator "github.com/go-playground/validator/v10"
+)
+
+//Kinds of bookmarked resources.
+const (
+	//KindURL is a web page, it's the default kind.
+	KindURL = "url"
+	//KindCmd is a shell command kept in Content.
+	KindCmd = "cmd"
+	//KindSnippet is a text snippet kept in Content.
+	KindSnippet = "snippet"
+)
+
+//ErrNotURL is returned when operation which needs a web page, like Refetch or
+//Snapshot, is requested for bookmark of other kind.
+var ErrNotURL = errors.New("bookmark isn't a web page")
+
+//validateKind checks fields which depend on the kind of the bookmark. URL is
+//required for web pages and they have no Content, other kinds have Content
+//instead and no URL.
+func validateKind(sl validator.StructLevel) {
+	var kind, url, content string
+	switch bm := sl.Current().Interface().(type) {
+	case NewBookmark:
+		kind, url, content = bm.Kind, bm.URL, bm.Content
+	case Bookmark:
+		kind, url, content = bm.Kind, bm.URL, bm.Content
+	}
+	switch kind {
+	case "", KindURL:
+		if url == "" {
+			sl.ReportError(url, "URL", "URL", "required", "")
+		}
+		if content != "" {
+			sl.ReportError(content, "Content", "Content", "isdefault", "")
+		}
+	case KindCmd, KindSnippet:
+		if content == "" {
+			sl.ReportError(content, "Content", "Content", "required", "")
+		}
+		if url != "" {
+			sl.ReportError(url, "URL", "URL", "isdefault", "")
+		}
+	}
+}
+
+//isURL reports whether bookmark is a web page. Bookmarks stored before kinds
+//were introduced have no kind.
+func (bm *Bookmark) isURL() bool {
+	return bm.Kind == "" || bm.Kind == KindURL
+}
+
+//matchKind reports whether bookmark of given kind matches the wanted one.
+func matchKind(kind, wanted string) bool {
+	if kind == "" {
+		kind = KindURL
+	}
+	return kind == wanted
+}
+
+//contentTitle returns the first line of the content, which is used as title
+//of bookmarks without URL.
+func contentTitle(content string) string {
+	content = strings.TrimSpace(content)
+	if i := strings.IndexByte(content, '\n'); i >= 0 {
+		content = strings.TrimSpace(content[:i])
+	}
+	return content
+}
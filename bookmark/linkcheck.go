@@ -0,0 +1,249 @@
+package bookmark
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//Health statuses of bookmarks, see CheckLinks. Empty status means the link was
+//never checked.
+const (
+	HealthOK = "ok"
+	//HealthRedirected means the page was moved to RedirectURL.
+	HealthRedirected = "redirected"
+	//HealthBroken means the request failed or the server responded with an
+	//error status.
+	HealthBroken = "broken"
+	//HealthUnchecked is accepted by Query to match bookmarks which were never
+	//checked.
+	HealthUnchecked = "unchecked"
+)
+
+//DefaultCheckConcurrency is the number of links checked at once by default.
+const DefaultCheckConcurrency = 8
+
+//ErrNoLinkChecker is returned by CheckLinks and RunLinkChecker when store has
+//no link checker.
+var ErrNoLinkChecker = errors.New("link checker is not configured")
+
+//LinkStatus is the result of the link check.
+type LinkStatus struct {
+	//StatusCode of the final response.
+	StatusCode int
+	//URL of the page after redirects.
+	URL string
+	//Permanent reports whether the link was redirected and all redirects
+	//were permanent.
+	Permanent bool
+}
+
+//LinkChecker checks whether bookmarked pages are still available.
+type LinkChecker interface {
+	CheckLink(ctx context.Context, url string) (*LinkStatus, error)
+}
+
+//WithLinkChecker sets checker used by CheckLinks and RunLinkChecker.
+func WithLinkChecker(c LinkChecker) StoreOption {
+	return func(r *Store) {
+		r.checker = c
+	}
+}
+
+//CheckOptions controls CheckLinks.
+type CheckOptions struct {
+	//Concurrency is the number of links checked at once,
+	//DefaultCheckConcurrency when zero.
+	Concurrency int
+	//RewriteRedirects replaces URL of permanently redirected bookmarks by the
+	//redirect target, unless other bookmark has that URL already.
+	RewriteRedirects bool
+}
+
+//CheckReport summarizes CheckLinks.
+type CheckReport struct {
+	Checked    int `json:"checked"`
+	OK         int `json:"ok"`
+	Redirected int `json:"redirected"`
+	Broken     int `json:"broken"`
+	//Rewritten is the number of bookmarks which got URL of the redirect
+	//target, they are counted as OK.
+	Rewritten int `json:"rewritten"`
+}
+
+//CheckLinks checks links of all web pages and records their health. Bookmark
+//which fails the check gets HealthBroken status and its CheckFailures counter
+//is increased, successful check resets the counter.
+func (r *Store) CheckLinks(ctx context.Context, opts CheckOptions) (*CheckReport, error) {
+	if r.checker == nil {
+		return nil, ErrNoLinkChecker
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultCheckConcurrency
+	}
+	bms := []Bookmark{}
+	if err := r.db.All(&bms); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	report := &CheckReport{}
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	ids := make(chan int)
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				health, rewritten, err := r.checkLink(ctx, id, opts)
+				mu.Lock()
+				switch {
+				//Bookmark could be deleted in the meantime.
+				case err == ErrNotFound:
+				case err != nil:
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				case health != "":
+					report.Checked++
+					switch health {
+					case HealthOK:
+						report.OK++
+					case HealthRedirected:
+						report.Redirected++
+					case HealthBroken:
+						report.Broken++
+					}
+					if rewritten {
+						report.Rewritten++
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, bm := range bms {
+		if !bm.isURL() {
+			continue
+		}
+		select {
+		case ids <- bm.ID:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(ids)
+	wg.Wait()
+	if firstErr != nil {
+		return report, firstErr
+	}
+	return report, ctx.Err()
+}
+
+//RunLinkChecker checks links of all bookmarks every interval until ctx is
+//done. Errors are passed to handleErr.
+func (r *Store) RunLinkChecker(ctx context.Context, interval time.Duration, opts CheckOptions, handleErr func(err error)) error {
+	if r.checker == nil {
+		return ErrNoLinkChecker
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if _, err := r.CheckLinks(ctx, opts); err != nil && ctx.Err() == nil {
+				handleErr(err)
+			}
+		}
+	}
+}
+
+//checkLink checks link of the bookmark and records its health, which is
+//returned. Empty health means the bookmark got new URL during the check, so the
+//result was dropped.
+func (r *Store) checkLink(ctx context.Context, id int, opts CheckOptions) (string, bool, error) {
+	bm, err := r.Get(ctx, id)
+	if err != nil {
+		return "", false, err
+	}
+	status, checkErr := r.checker.CheckLink(ctx, bm.URL)
+	//Cancelled check says nothing about the link.
+	if ctx.Err() != nil {
+		return "", false, ctx.Err()
+	}
+
+	stored := &Bookmark{}
+	rewritten := false
+	if err := r.withTx(func(tx storm.Node) error {
+		if err := tx.One("ID", id, stored); err != nil {
+			return err
+		}
+		if stored.URL != bm.URL {
+			return nil
+		}
+		stored.CheckedAt = time.Now().UTC()
+		stored.StatusCode, stored.RedirectURL, stored.CheckError = 0, "", ""
+		switch {
+		case checkErr != nil:
+			stored.Health = HealthBroken
+			stored.CheckError = checkErr.Error()
+		case status.StatusCode >= 400:
+			stored.Health = HealthBroken
+			stored.StatusCode = status.StatusCode
+		case status.URL != stored.URL:
+			stored.Health = HealthRedirected
+			stored.StatusCode = status.StatusCode
+			stored.RedirectURL = status.URL
+		default:
+			stored.Health = HealthOK
+			stored.StatusCode = status.StatusCode
+		}
+		if stored.Health == HealthBroken {
+			stored.CheckFailures++
+		} else {
+			stored.CheckFailures = 0
+		}
+
+		if stored.Health == HealthRedirected && status.Permanent && opts.RewriteRedirects {
+			moved := *stored
+			moved.URL = status.URL
+			moved.CanonicalURL = r.canonicalURL(moved.URL)
+			err := checkUnique(tx, &moved)
+			var dupErr *ErrDuplicate
+			if err != nil && !errors.As(err, &dupErr) {
+				return err
+			}
+			if err == nil {
+				moved.Health = HealthOK
+				moved.RedirectURL = ""
+				moved.UpdatedAt = moved.CheckedAt
+				r.markPending(&moved)
+				*stored = moved
+				rewritten = true
+			}
+		}
+		return r.save(ctx, tx, stored)
+	}); err != nil {
+		if err == storm.ErrNotFound {
+			return "", false, ErrNotFound
+		}
+		return "", false, err
+	}
+	if stored.URL != bm.URL && !rewritten {
+		return "", false, nil
+	}
+	r.enqueueFetch(stored)
+	return stored.Health, rewritten, nil
+}
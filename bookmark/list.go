@@ -0,0 +1,220 @@
+package bookmark
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	"github.com/asdine/storm/v3/q"
+)
+
+//Sort keys and orders accepted by List.
+const (
+	SortID        = "id"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortTitle     = "title"
+	SortFrecency  = "frecency"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var (
+	//ErrInvalidCursor is returned when List gets cursor which wasn't
+	//returned by List, or which was issued for different sort key or order.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	//ErrInvalidSort is returned when List gets unknown sort key or order.
+	ErrInvalidSort = errors.New("invalid sort")
+)
+
+//sortFields maps sort keys to Bookmark fields.
+var sortFields = map[string]string{
+	SortID:        "ID",
+	SortCreatedAt: "CreatedAt",
+	SortUpdatedAt: "UpdatedAt",
+	SortTitle:     "Title",
+	SortFrecency:  "Rank",
+}
+
+//ListOptions controls pagination and order of List. Zero value lists all
+//bookmarks ordered by ID.
+type ListOptions struct {
+	//Limit is the maximum number of returned bookmarks, zero means no limit.
+	Limit int
+	//Cursor is an opaque value returned by previous List call, list starts
+	//right after the last bookmark of the previous page.
+	Cursor string
+	//Sort is one of SortID (default), SortCreatedAt, SortUpdatedAt,
+	//SortTitle or SortFrecency. Bookmarks with the same sort value are
+	//ordered by ID.
+	Sort string
+	//Order is OrderAsc (default) or OrderDesc.
+	Order string
+	//Kind limits the list to bookmarks of given kind.
+	Kind string
+}
+
+//cursor points to the last bookmark of the page.
+type cursor struct {
+	Sort  string          `json:"s"`
+	Order string          `json:"o"`
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"i"`
+}
+
+//List returns page of bookmarks and cursor of the next page. Cursor is empty
+//when there are no more bookmarks.
+func (r *Store) List(ctx context.Context, opts ListOptions) ([]*BookmarkSummary, string, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortID
+	}
+	if opts.Order == "" {
+		opts.Order = OrderAsc
+	}
+	if _, ok := sortFields[opts.Sort]; !ok {
+		return nil, "", fmt.Errorf("%w: unknown sort key %q", ErrInvalidSort, opts.Sort)
+	}
+	if opts.Order != OrderAsc && opts.Order != OrderDesc {
+		return nil, "", fmt.Errorf("%w: unknown order %q", ErrInvalidSort, opts.Order)
+	}
+
+	var (
+		c     *cursor
+		value interface{}
+		bms   []Bookmark
+		err   error
+	)
+	if opts.Cursor != "" {
+		if c, value, err = decodeCursor(opts); err != nil {
+			return nil, "", err
+		}
+	}
+	if opts.Sort == SortID {
+		bms, err = r.listByID(opts, c)
+	} else {
+		bms, err = r.listSorted(opts, c, value)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if opts.Limit > 0 && len(bms) > opts.Limit {
+		bms = bms[:opts.Limit]
+		if next, err = encodeCursor(opts, &bms[len(bms)-1]); err != nil {
+			return nil, "", err
+		}
+	}
+
+	bs := []*BookmarkSummary{}
+	for i := range bms {
+		bs = append(bs, summary(&bms[i]))
+	}
+	return bs, next, nil
+}
+
+//listByID returns bookmarks following the one pointed by the cursor in ID
+//order, at most opts.Limit+1 of them. Bookmarks are stored in ID order, so
+//they don't need sort index.
+func (r *Store) listByID(opts ListOptions, c *cursor) ([]Bookmark, error) {
+	matchers := []q.Matcher{}
+	if opts.Kind != "" {
+		matchers = append(matchers, q.NewFieldMatcher("Kind", kindMatcher(opts.Kind)))
+	}
+	if c != nil {
+		if opts.Order == OrderDesc {
+			matchers = append(matchers, q.Lt("ID", c.ID))
+		} else {
+			matchers = append(matchers, q.Gt("ID", c.ID))
+		}
+	}
+	query := r.db.Select(matchers...)
+	if opts.Order == OrderDesc {
+		query = query.Reverse()
+	}
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit + 1)
+	}
+	bms := []Bookmark{}
+	if err := query.Find(&bms); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return bms, nil
+}
+
+//kindMatcher matches Kind field of bookmarks, see matchKind.
+type kindMatcher string
+
+func (m kindMatcher) MatchField(v interface{}) (bool, error) {
+	kind, _ := v.(string)
+	return matchKind(kind, string(m)), nil
+}
+
+func encodeCursor(opts ListOptions, bm *Bookmark) (string, error) {
+	value, err := json.Marshal(sortValue(bm, opts.Sort))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(&cursor{Sort: opts.Sort, Order: opts.Order, Value: value, ID: bm.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+//decodeCursor returns the cursor and sort value of the bookmark it points
+//to.
+func decodeCursor(opts ListOptions) (*cursor, interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	c := &cursor{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	if c.Sort != opts.Sort || c.Order != opts.Order {
+		return nil, nil, fmt.Errorf("%w: cursor was issued for %s %s order", ErrInvalidCursor, c.Sort, c.Order)
+	}
+
+	var value interface{}
+	switch opts.Sort {
+	case SortID:
+		value = c.ID
+	case SortTitle:
+		var s string
+		err = json.Unmarshal(c.Value, &s)
+		value = s
+	case SortFrecency:
+		var f float64
+		err = json.Unmarshal(c.Value, &f)
+		value = f
+	default:
+		var t time.Time
+		err = json.Unmarshal(c.Value, &t)
+		value = t
+	}
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	return c, value, nil
+}
+
+func sortValue(bm *Bookmark, key string) interface{} {
+	switch key {
+	case SortCreatedAt:
+		return bm.CreatedAt
+	case SortUpdatedAt:
+		return bm.UpdatedAt
+	case SortTitle:
+		return bm.Title
+	case SortFrecency:
+		return bm.Rank
+	}
+	return bm.ID
+}
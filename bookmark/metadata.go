@@ -0,0 +1,64 @@
+package bookmark
+
+import (
+	"context"
+
+	"github.com/asdine/storm/v3"
+)
+
+//Metadata of the bookmarked page.
+type Metadata struct {
+	Title       string
+	Description string
+	//CanonicalLink is URL of the page declared by <link rel="canonical">.
+	CanonicalLink string
+	FaviconURL    string
+}
+
+//MetadataResolver reads metadata of bookmarked pages.
+type MetadataResolver interface {
+	ResolveMetadata(ctx context.Context, url string) (*Metadata, error)
+}
+
+//WithMetadataResolver sets resolver used by Add to fill title, notes,
+//canonical link and favicon URL which weren't given.
+func WithMetadataResolver(m MetadataResolver) StoreOption {
+	return func(r *Store) {
+		r.resolver = m
+	}
+}
+
+//populate fills empty fields of the new bookmark from page metadata. Failure
+//of the resolver isn't fatal, bookmark without title gets its URL as title.
+//Resolved title which is already used by other bookmark is replaced by the URL
+//as well, because titles are unique. Bookmark which isn't a web page gets the
+//first line of its content as title.
+func (r *Store) populate(ctx context.Context, bm *Bookmark) error {
+	if !bm.isURL() {
+		if bm.Title == "" {
+			bm.Title = contentTitle(bm.Content)
+		}
+		return nil
+	}
+	if r.resolver != nil {
+		if md, err := r.resolver.ResolveMetadata(ctx, bm.URL); err == nil {
+			if bm.Title == "" && md.Title != "" {
+				err := r.db.One("Title", md.Title, &Bookmark{})
+				if err == storm.ErrNotFound {
+					bm.Title = md.Title
+				} else if err != nil {
+					return err
+				}
+			}
+			if bm.Notes == "" {
+				bm.Notes = md.Description
+			}
+			bm.CanonicalLink = md.CanonicalLink
+			bm.FaviconURL = md.FaviconURL
+		}
+	}
+	if bm.Title == "" {
+		bm.Title = bm.URL
+	}
+	return nil
+}
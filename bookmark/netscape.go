@@ -0,0 +1,325 @@
+package bookmark
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const netscapeHeader = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`
+
+const netscapeFooter = "</DL><p>\n"
+
+//ImportHTML imports bookmarks from the Netscape bookmark file, which is the
+//format of bookmarks exported by web browsers. Folder hierarchy containing the
+//bookmark becomes its collection, e.g. Programming/Go, names of the folders
+//and TAGS become bookmark tags, <DD> description becomes notes, ADD_DATE and
+//LAST_MODIFIED are kept as creation and update time. Like ImportCSV, all bookmarks are imported in a
+//single transaction.
+func (r *Store) ImportHTML(ctx context.Context, rd io.Reader, opts ImportOptions) (*ImportReport, error) {
+	mode, err := opts.mode()
+	if err != nil {
+		return nil, err
+	}
+	recs, err := parseNetscape(rd)
+	if err != nil {
+		return nil, err
+	}
+	return r.importRecords(ctx, recs, mode, opts.Conflict)
+}
+
+//ExportHTML writes all web pages as the Netscape bookmark file, which can be
+//imported by web browsers. Collections become nested folders and bookmarks,
+//ordered by ID, are written to the folder of their first collection, as the
+//file can't hold bookmark in several folders.
+func (r *Store) ExportHTML(ctx context.Context, w io.Writer) error {
+	root := &netscapeFolder{}
+	cs, err := r.Collections(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		root.folder(c.Path)
+	}
+	if err := r.db.Select().Each(&Bookmark{}, func(record interface{}) error {
+		//Netscape bookmark file can hold only web pages.
+		bm := *record.(*Bookmark)
+		if !bm.isURL() {
+			return nil
+		}
+		f := root
+		if len(bm.Collections) != 0 {
+			f = root.folder(bm.Collections[0])
+		}
+		f.bookmarks = append(f.bookmarks, &bm)
+		return nil
+	}); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+
+	if _, err := io.WriteString(w, netscapeHeader); err != nil {
+		return err
+	}
+	if err := root.write(w, "    "); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, netscapeFooter)
+	return err
+}
+
+//netscapeFolder is a folder of exported Netscape bookmark file.
+type netscapeFolder struct {
+	name      string
+	folders   []*netscapeFolder
+	bookmarks []*Bookmark
+}
+
+//folder returns descendant folder with given collection path, creating it
+//when missing.
+func (f *netscapeFolder) folder(path string) *netscapeFolder {
+	for _, name := range strings.Split(path, CollectionSeparator) {
+		var sub *netscapeFolder
+		for _, s := range f.folders {
+			if s.name == name {
+				sub = s
+				break
+			}
+		}
+		if sub == nil {
+			sub = &netscapeFolder{name: name}
+			f.folders = append(f.folders, sub)
+		}
+		f = sub
+	}
+	return f
+}
+
+//write writes content of the folder, subfolders followed by bookmarks.
+func (f *netscapeFolder) write(w io.Writer, indent string) error {
+	for _, sub := range f.folders {
+		if _, err := fmt.Fprintf(w, "%s<DT><H3>%s</H3>\n%s<DL><p>\n", indent, html.EscapeString(sub.name), indent); err != nil {
+			return err
+		}
+		if err := sub.write(w, indent+"    "); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s</DL><p>\n", indent); err != nil {
+			return err
+		}
+	}
+	for _, bm := range f.bookmarks {
+		if err := writeNetscapeBookmark(w, bm, indent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeNetscapeBookmark(w io.Writer, bm *Bookmark, indent string) error {
+	attrs := fmt.Sprintf(
+		`HREF="%s" ADD_DATE="%d" LAST_MODIFIED="%d"`,
+		html.EscapeString(bm.URL), bm.CreatedAt.Unix(), bm.UpdatedAt.Unix(),
+	)
+	if len(bm.Tags) != 0 {
+		attrs += fmt.Sprintf(` TAGS="%s"`, html.EscapeString(strings.Join(bm.Tags, ",")))
+	}
+	if _, err := fmt.Fprintf(w, "%s<DT><A %s>%s</A>\n", indent, attrs, html.EscapeString(bm.Title)); err != nil {
+		return err
+	}
+	if bm.Notes != "" {
+		if _, err := fmt.Fprintf(w, "%s<DD>%s\n", indent, html.EscapeString(bm.Notes)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//netscapeParser keeps state of the Netscape bookmark file parsing.
+type netscapeParser struct {
+	z *nethtml.Tokenizer
+	//folders is a stack of folders enclosing current <DL>, empty name is
+	//used for lists which are not preceded by folder header.
+	folders []string
+	//folder is the name of the last folder header, which is pushed on the
+	//stack by the following <DL>.
+	folder  string
+	records []importRecord
+	//line is the line number of the current token.
+	line int
+	//description is true when <DD> of the last bookmark is being read.
+	description bool
+}
+
+func parseNetscape(r io.Reader) ([]importRecord, error) {
+	p := &netscapeParser{z: nethtml.NewTokenizer(r), line: 1}
+	for {
+		tt := p.next()
+		switch tt {
+		case nethtml.ErrorToken:
+			if p.z.Err() == io.EOF {
+				for _, rec := range p.records {
+					if rec.bm != nil {
+						rec.bm.Notes = strings.TrimSpace(rec.bm.Notes)
+					}
+				}
+				return p.records, nil
+			}
+			return nil, p.z.Err()
+		case nethtml.TextToken:
+			if p.description {
+				bm := p.records[len(p.records)-1].bm
+				bm.Notes += string(p.z.Text())
+			}
+		case nethtml.StartTagToken, nethtml.EndTagToken:
+			p.tag(tt)
+		}
+	}
+}
+
+func (p *netscapeParser) tag(tt nethtml.TokenType) {
+	name, hasAttr := p.z.TagName()
+	a := atom.Lookup(name)
+	if p.description {
+		switch a {
+		case atom.Dt, atom.Dl, atom.H3, atom.A:
+			p.description = false
+		default:
+			//Inline markup of the description is dropped.
+			return
+		}
+	}
+
+	switch {
+	case tt == nethtml.StartTagToken && a == atom.H3:
+		p.folder = strings.TrimSpace(p.text(atom.H3))
+	case tt == nethtml.StartTagToken && a == atom.Dl:
+		p.folders = append(p.folders, p.folder)
+		p.folder = ""
+	case tt == nethtml.EndTagToken && a == atom.Dl:
+		if len(p.folders) > 0 {
+			p.folders = p.folders[:len(p.folders)-1]
+		}
+	case tt == nethtml.StartTagToken && a == atom.A:
+		attrs := map[string]string{}
+		for hasAttr {
+			var k, v []byte
+			k, v, hasAttr = p.z.TagAttr()
+			attrs[string(k)] = string(v)
+		}
+		line := p.line
+		title := strings.TrimSpace(p.text(atom.A))
+		rec := p.bookmark(attrs, title)
+		rec.line = line
+		p.records = append(p.records, rec)
+	case tt == nethtml.StartTagToken && a == atom.Dd:
+		if n := len(p.records); n > 0 && p.records[n-1].bm != nil {
+			p.description = true
+		}
+	}
+}
+
+//next moves to the next token, keeping track of its line number.
+func (p *netscapeParser) next() nethtml.TokenType {
+	p.line += bytes.Count(p.z.Raw(), []byte("\n"))
+	return p.z.Next()
+}
+
+//text reads text up to the closing tag.
+func (p *netscapeParser) text(closing atom.Atom) string {
+	sb := strings.Builder{}
+	for {
+		switch p.next() {
+		case nethtml.ErrorToken:
+			return sb.String()
+		case nethtml.TextToken:
+			sb.Write(p.z.Text())
+		case nethtml.EndTagToken:
+			name, _ := p.z.TagName()
+			if atom.Lookup(name) == closing {
+				return sb.String()
+			}
+		}
+	}
+}
+
+func (p *netscapeParser) bookmark(attrs map[string]string, title string) importRecord {
+	href := strings.TrimSpace(attrs["href"])
+	rec := importRecord{title: title, url: href}
+	//Firefox exports smart bookmarks (saved queries) with place: scheme,
+	//they can't be opened outside of the browser.
+	if strings.HasPrefix(href, "place:") {
+		rec.skip, rec.err = true, errors.New("browser smart bookmark")
+		return rec
+	}
+	if href == "" {
+		rec.err = errors.New("missing HREF attribute")
+		return rec
+	}
+	if title == "" {
+		title = href
+	}
+
+	var tags, collections []string
+	//Names of folders can contain the separator, which would make
+	//them nested.
+	names := []string{}
+	for _, f := range p.folders {
+		if f = strings.TrimSpace(strings.Replace(f, CollectionSeparator, " ", -1)); f != "" {
+			names = append(names, f)
+		}
+	}
+	if len(names) != 0 {
+		collections = []string{strings.Join(names, CollectionSeparator)}
+	}
+	tags = append(tags, names...)
+	if attrs["tags"] != "" {
+		tags = append(tags, strings.Split(attrs["tags"], ",")...)
+	}
+	tags = NormalizeTags(tags)
+
+	now := time.Now().UTC()
+	created := parseNetscapeTime(attrs["add_date"], now)
+	rec.bm = &Bookmark{
+		Title:       title,
+		URL:         href,
+		Tags:        tags,
+		Collections: collections,
+		CreatedAt:   created,
+		UpdatedAt:   parseNetscapeTime(attrs["last_modified"], created),
+	}
+	return rec
+}
+
+//parseNetscapeTime parses Unix timestamp of the bookmark file. Most browsers
+//use seconds, but some of them write milli- or microseconds.
+func parseNetscapeTime(s string, def time.Time) time.Time {
+	ts, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || ts <= 0 {
+		return def
+	}
+	switch {
+	case ts > 1e14:
+		return time.Unix(0, ts*int64(time.Microsecond)).UTC()
+	case ts > 1e11:
+		return time.Unix(0, ts*int64(time.Millisecond)).UTC()
+	}
+	return time.Unix(ts, 0).UTC()
+}
@@ -0,0 +1,170 @@
+package bookmark
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//Query describes criteria used to filter bookmarks. Zero value of the field
+//means that the criterion is not applied, bookmark has to match all applied
+//criteria.
+type Query struct {
+	//AnyTags matches bookmarks which have at least one of given tags.
+	AnyTags []string
+	//AllTags matches bookmarks which have all of given tags.
+	AllTags []string
+
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+
+	//Host matches bookmarks which URL host is equal to given one, letter
+	//case is ignored.
+	Host string
+	//URLPrefix matches bookmarks which URL starts with given prefix.
+	URLPrefix string
+	//Text matches bookmarks which title or notes contains given text, letter
+	//case is ignored.
+	Text string
+	//Health matches bookmarks with given health status, HealthUnchecked
+	//matches bookmarks which were never checked.
+	Health string
+	//Kind matches bookmarks of given kind.
+	Kind string
+	//Collection matches bookmarks in the collection or its descendants, so
+	//"work" matches also bookmarks in "work/infra".
+	Collection string
+}
+
+//Query returns summaries of bookmarks matching the query, ordered by ID.
+//Date ranges are resolved with CreatedAt or UpdatedAt index, remaining
+//criteria are applied on the result. Tags are normalized, see NormalizeTags.
+func (r *Store) Query(ctx context.Context, q Query) ([]*BookmarkSummary, error) {
+	q.AnyTags, q.AllTags = NormalizeTags(q.AnyTags), NormalizeTags(q.AllTags)
+	bms := []Bookmark{}
+	var err error
+	switch {
+	case !q.CreatedAfter.IsZero() || !q.CreatedBefore.IsZero():
+		min, max := indexRange(q.CreatedAfter, q.CreatedBefore)
+		err = r.db.Range("CreatedAt", min, max, &bms)
+	case !q.UpdatedAfter.IsZero() || !q.UpdatedBefore.IsZero():
+		min, max := indexRange(q.UpdatedAfter, q.UpdatedBefore)
+		err = r.db.Range("UpdatedAt", min, max, &bms)
+	default:
+		err = r.db.All(&bms)
+	}
+	if err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+
+	bs := []*BookmarkSummary{}
+	for i := range bms {
+		if q.Match(&bms[i]) {
+			bs = append(bs, summary(&bms[i]))
+		}
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].ID < bs[j].ID })
+	return bs, nil
+}
+
+//Match reports whether bookmark matches the query.
+func (q *Query) Match(bm *Bookmark) bool {
+	if len(q.AnyTags) != 0 && !hasAnyTag(bm.Tags, q.AnyTags) {
+		return false
+	}
+	for _, tag := range q.AllTags {
+		if !hasAnyTag(bm.Tags, []string{tag}) {
+			return false
+		}
+	}
+	if !inRange(bm.CreatedAt, q.CreatedAfter, q.CreatedBefore) {
+		return false
+	}
+	if !inRange(bm.UpdatedAt, q.UpdatedAfter, q.UpdatedBefore) {
+		return false
+	}
+	if q.Host != "" {
+		u, err := url.Parse(bm.URL)
+		if err != nil || !strings.EqualFold(u.Hostname(), q.Host) {
+			return false
+		}
+	}
+	if q.URLPrefix != "" && !strings.HasPrefix(bm.URL, q.URLPrefix) {
+		return false
+	}
+	if q.Text != "" {
+		text := strings.ToLower(q.Text)
+		if !strings.Contains(strings.ToLower(bm.Title), text) &&
+			!strings.Contains(strings.ToLower(bm.Notes), text) {
+			return false
+		}
+	}
+	if q.Kind != "" && !matchKind(bm.Kind, q.Kind) {
+		return false
+	}
+	if c := NormalizeCollection(q.Collection); c != "" {
+		found := false
+		for _, p := range bm.Collections {
+			if inCollection(p, c) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.Health != "" {
+		health := bm.Health
+		if health == "" {
+			health = HealthUnchecked
+		}
+		if health != q.Health {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyTag(tags []string, wanted []string) bool {
+	for _, t := range tags {
+		for _, w := range wanted {
+			if t == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inRange(t, after, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+	if !before.IsZero() && t.After(before) {
+		return false
+	}
+	return true
+}
+
+//indexRange returns bounds for storm Range over time index. Index keys are
+//JSON encoded times compared as bytes, where fractional seconds don't sort
+//correctly, so bounds are widened to full seconds and exact range is checked
+//by Query.Match.
+func indexRange(after, before time.Time) (time.Time, time.Time) {
+	min := time.Time{}
+	if !after.IsZero() {
+		min = after.UTC().Truncate(time.Second).Add(-time.Second)
+	}
+	max := time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+	if !before.IsZero() {
+		max = before.UTC().Truncate(time.Second).Add(time.Second)
+	}
+	return min, max
+}
@@ -0,0 +1,190 @@
+package bookmark
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//revisionBucket is the storm bucket of the revision log.
+const revisionBucket = "revisions"
+
+//ErrRevisionNotFound is returned when bookmark has no revision of given
+//version.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+type authorKey struct{}
+
+//WithAuthor returns context of changes made by the author, who is recorded
+//in revisions of changed bookmarks.
+func WithAuthor(ctx context.Context, author string) context.Context {
+	return context.WithValue(ctx, authorKey{}, author)
+}
+
+//Author returns author of changes set by WithAuthor, or empty string.
+func Author(ctx context.Context) string {
+	author, _ := ctx.Value(authorKey{}).(string)
+	return author
+}
+
+//Revision records change of the bookmark. Revisions are kept in append-only
+//log, also after the bookmark is deleted. Versions of bookmark revisions are
+//numbered from 1, which is the revision of the added bookmark.
+type Revision struct {
+	ID         int       `json:"id" storm:"id,increment"`
+	BookmarkID int       `json:"bookmark_id" storm:"index"`
+	Version    int       `json:"version"`
+	Author     string    `json:"author"`
+	CreatedAt  time.Time `json:"created_at"`
+	//Changes lists fields which were changed, see RevisionState.
+	Changes []FieldChange `json:"changes"`
+	//State holds the bookmark after the change, so it can be restored.
+	State RevisionState `json:"state"`
+}
+
+//RevisionState holds fields of the bookmark tracked by revisions. Document
+//isn't tracked, it's the page text refreshed by fetcher.
+type RevisionState struct {
+	Kind        string   `json:"kind"`
+	Title       string   `json:"title"`
+	URL         string   `json:"url"`
+	Content     string   `json:"content"`
+	Tags        []string `json:"tags"`
+	Collections []string `json:"collections"`
+	Notes       string   `json:"notes"`
+}
+
+//FieldChange is the old and new value of the changed field. Values of lists
+//are joined with semicolon.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+//revisionFields lists fields of RevisionState, in the order of changes.
+var revisionFields = []string{"Kind", "Title", "URL", "Content", "Tags", "Collections", "Notes"}
+
+func revisionState(bm *Bookmark) RevisionState {
+	return RevisionState{
+		Kind:        bm.Kind,
+		Title:       bm.Title,
+		URL:         bm.URL,
+		Content:     bm.Content,
+		Tags:        bm.Tags,
+		Collections: bm.Collections,
+		Notes:       bm.Notes,
+	}
+}
+
+//field returns value of the field formatted for FieldChange.
+func (s *RevisionState) field(name string) string {
+	switch name {
+	case "Kind":
+		return s.Kind
+	case "Title":
+		return s.Title
+	case "URL":
+		return s.URL
+	case "Content":
+		return s.Content
+	case "Tags":
+		return strings.Join(s.Tags, ";")
+	case "Collections":
+		return strings.Join(s.Collections, ";")
+	case "Notes":
+		return s.Notes
+	}
+	return ""
+}
+
+//diff returns changes from old to new state.
+func diff(old, new *RevisionState) []FieldChange {
+	changes := []FieldChange{}
+	for _, f := range revisionFields {
+		if o, n := old.field(f), new.field(f); o != n {
+			changes = append(changes, FieldChange{Field: f, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+//History returns revisions of the bookmark ordered by version.
+func (r *Store) History(ctx context.Context, id int) ([]*Revision, error) {
+	revs, err := revisions(r.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(revs) == 0 {
+		//Bookmarks saved before revisions were introduced have none.
+		if _, err := r.Get(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return revs, nil
+}
+
+//revisions returns revisions of the bookmark ordered by version.
+func revisions(n storm.Node, id int) ([]*Revision, error) {
+	revs := []*Revision{}
+	if err := n.From(revisionBucket).Find("BookmarkID", id, &revs); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	sort.Slice(revs, func(i, j int) bool { return revs[i].Version < revs[j].Version })
+	return revs, nil
+}
+
+//Restore sets tracked fields of the bookmark to their state in given version,
+//which is recorded as a new revision.
+func (r *Store) Restore(ctx context.Context, id, version int) (*Bookmark, error) {
+	revs, err := revisions(r.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if version < 1 || version > len(revs) {
+		return nil, ErrRevisionNotFound
+	}
+	s := revs[version-1].State
+	return r.Update(ctx, &Bookmark{
+		ID:          id,
+		Kind:        s.Kind,
+		Title:       s.Title,
+		URL:         s.URL,
+		Content:     s.Content,
+		Tags:        s.Tags,
+		Collections: s.Collections,
+		Notes:       s.Notes,
+	}, revisionFields...)
+}
+
+//addRevision appends revision of the saved bookmark, when any of its tracked
+//fields has changed since the last revision. Bookmark without revisions, which
+//is new or was saved before they were introduced, is compared with its
+//previously stored version, which is zero for new bookmark.
+func addRevision(ctx context.Context, n storm.Node, bm, stored *Bookmark) error {
+	revs, err := revisions(n, bm.ID)
+	if err != nil {
+		return err
+	}
+	old := revisionState(stored)
+	if len(revs) != 0 {
+		old = revs[len(revs)-1].State
+	}
+	state := revisionState(bm)
+	changes := diff(&old, &state)
+	if len(changes) == 0 {
+		return nil
+	}
+	return n.From(revisionBucket).Save(&Revision{
+		BookmarkID: bm.ID,
+		Version:    len(revs) + 1,
+		Author:     Author(ctx),
+		CreatedAt:  time.Now().UTC(),
+		Changes:    changes,
+		State:      state,
+	})
+}
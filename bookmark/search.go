@@ -0,0 +1,159 @@
+package bookmark
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/akruszewski/librarian/search"
+	"github.com/asdine/storm/v3"
+)
+
+const (
+	searchBucket = "search"
+	snippetSize  = 160
+	//frecencyBoost is the weight of frecency in search ranking.
+	frecencyBoost = 0.2
+)
+
+//searchFields maps names of indexed bookmark fields to their weight in
+//search ranking. Names are used in field-scoped queries like title:go.
+var searchFields = map[string]float64{
+	"title":    2.0,
+	"content":  1.5,
+	"tag":      1.5,
+	"notes":    1.0,
+	"document": 0.7,
+}
+
+//SearchHit is a single full-text search result. Highlights maps names of
+//matched fields to text fragments with matched words wrapped in <mark> tags.
+type SearchHit struct {
+	Bookmark   *BookmarkSummary  `json:"bookmark"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+//Search runs full-text query over title, content, notes, tags and document of
+//bookmarks and returns at most limit hits ordered by relevance. Limit lower
+//than one means no limit. Query terms are matched against all fields, unless
+//they are prefixed with field name (title:, content:, tag:, notes: or
+//document:), and
+//"quoted phrases" match words next to each other. Frequently and recently
+//visited bookmarks are ranked higher, see Frecency.
+func (r *Store) Search(ctx context.Context, query string, limit int) ([]*SearchHit, error) {
+	//Limit is applied after ranking by frecency, which can change the order.
+	hits, err := r.index(r.db).Search(query, 0)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	shs := []*SearchHit{}
+	for _, hit := range hits {
+		bm, err := r.Get(ctx, hit.ID)
+		if err != nil {
+			//Index is out of sync, it's better to skip hit than to fail
+			//whole search.
+			if err == ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+		highlights := map[string]string{}
+		for field, text := range document(bm).Fields {
+			if h := search.Highlight(text, hit.Terms, snippetSize); h != "" {
+				highlights[field] = h
+			}
+		}
+		shs = append(shs, &SearchHit{
+			Bookmark:   summary(bm),
+			Score:      hit.Score * (1 + frecencyBoost*math.Log1p(bm.Frecency(now))),
+			Highlights: highlights,
+		})
+	}
+	sort.SliceStable(shs, func(i, j int) bool { return shs[i].Score > shs[j].Score })
+	if limit > 0 && len(shs) > limit {
+		shs = shs[:limit]
+	}
+	return shs, nil
+}
+
+//Reindex rebuilds sort and search indexes and canonical URLs of all
+//bookmarks, which is needed after change of tracking parameters. Bookmark
+//whose canonical URL is already taken by other bookmark is left without it.
+func (r *Store) Reindex(ctx context.Context) error {
+	return r.withTx(func(tx storm.Node) error {
+		ix := r.index(tx)
+		if err := ix.Reset(); err != nil {
+			return err
+		}
+		bms := []Bookmark{}
+		if err := tx.All(&bms); err != nil {
+			return err
+		}
+		if err := r.recanonicalize(tx, bms); err != nil {
+			return err
+		}
+		if err := buildSortIndex(tx); err != nil {
+			return err
+		}
+		for i := range bms {
+			if err := ix.Add(document(&bms[i])); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//recanonicalize updates canonical URLs of bookmarks. Changed URLs are cleared
+//first, so they can be swapped between bookmarks.
+func (r *Store) recanonicalize(n storm.Node, bms []Bookmark) error {
+	changed := []*Bookmark{}
+	for i := range bms {
+		if bms[i].CanonicalURL != r.canonicalURL(bms[i].URL) {
+			changed = append(changed, &bms[i])
+		}
+	}
+	for _, bm := range changed {
+		bm.CanonicalURL = ""
+		if err := n.Save(bm); err != nil {
+			return err
+		}
+	}
+	for _, bm := range changed {
+		canonical := r.canonicalURL(bm.URL)
+		err := n.One("CanonicalURL", canonical, &Bookmark{})
+		if err == nil {
+			continue
+		}
+		if err != storm.ErrNotFound {
+			return err
+		}
+		bm.CanonicalURL = canonical
+		if err := n.Save(bm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//index returns search index stored in given node, which can be a transaction.
+func (r *Store) index(n storm.Node) *search.Index {
+	return search.New(n.From(searchBucket), searchFields)
+}
+
+func document(bm *Bookmark) search.Document {
+	return search.Document{
+		ID: bm.ID,
+		Fields: map[string]string{
+			"title":    bm.Title,
+			"content":  bm.Content,
+			"tag":      strings.Join(bm.Tags, " "),
+			"notes":    bm.Notes,
+			"document": bm.Document,
+		},
+	}
+}
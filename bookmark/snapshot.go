@@ -0,0 +1,208 @@
+package bookmark
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//Snapshot formats.
+const (
+	//SnapshotHTML is a single HTML file with inlined styles and images.
+	SnapshotHTML = "html"
+	//SnapshotWARC is a WARC file with the HTTP response of the page.
+	SnapshotWARC = "warc"
+)
+
+var (
+	//ErrNoArchiver is returned by snapshot methods when store has no
+	//archiver.
+	ErrNoArchiver = errors.New("page archiver is not configured")
+	//ErrInvalidSnapshotFormat is returned for unknown snapshot format.
+	ErrInvalidSnapshotFormat = errors.New("invalid snapshot format")
+	//ErrCaptureFailed is returned by Snapshot when the page can't be
+	//captured.
+	ErrCaptureFailed = errors.New("cannot capture page")
+)
+
+//Snapshot is a saved copy of the bookmarked page. Content of the snapshot is
+//kept in the blob store under its digest.
+type Snapshot struct {
+	ID         int `json:"id" storm:"id,increment"`
+	BookmarkID int `json:"bookmark_id" storm:"index"`
+	//Version numbers snapshots of the bookmark from 1.
+	Version     int    `json:"version"`
+	Format      string `json:"format"`
+	ContentType string `json:"content_type"`
+	Digest      string `json:"digest"`
+	Size        int64  `json:"size"`
+	//URL of the page after redirects.
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+//Capture is the page captured by Archiver.
+type Capture struct {
+	//URL of the page after redirects.
+	URL         string
+	ContentType string
+	Body        []byte
+}
+
+//Archiver captures bookmarked pages in given format.
+type Archiver interface {
+	Archive(ctx context.Context, url, format string) (*Capture, error)
+}
+
+//BlobStore keeps contents of snapshots by their digest.
+type BlobStore interface {
+	Put(r io.Reader) (digest string, size int64, err error)
+	Open(digest string) (io.ReadCloser, error)
+}
+
+//WithArchiver sets archiver of bookmarked pages and blob store of their
+//snapshots.
+func WithArchiver(a Archiver, blobs BlobStore) StoreOption {
+	return func(r *Store) {
+		r.archiver = a
+		r.blobs = blobs
+	}
+}
+
+//WithAutoSnapshot makes RunFetcher save snapshot of given format for every
+//successfully fetched page. It requires archiver, see WithArchiver.
+func WithAutoSnapshot(format string) StoreOption {
+	return func(r *Store) {
+		r.autoSnapshot = format
+	}
+}
+
+//Snapshot captures page of the bookmark and saves it as its new version.
+func (r *Store) Snapshot(ctx context.Context, id int, format string) (*Snapshot, error) {
+	if r.archiver == nil {
+		return nil, ErrNoArchiver
+	}
+	if format != SnapshotHTML && format != SnapshotWARC {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSnapshotFormat, format)
+	}
+	bm, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !bm.isURL() {
+		return nil, ErrNotURL
+	}
+	capture, err := r.archiver.Archive(ctx, bm.URL, format)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCaptureFailed, err)
+	}
+	digest, size, err := r.blobs.Put(bytes.NewReader(capture.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		BookmarkID:  id,
+		Format:      format,
+		ContentType: capture.ContentType,
+		Digest:      digest,
+		Size:        size,
+		URL:         capture.URL,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if err := r.withTx(func(tx storm.Node) error {
+		//Bookmark could be deleted during the capture.
+		if err := tx.One("ID", id, &Bookmark{}); err != nil {
+			return err
+		}
+		latest, err := latestSnapshot(tx, id)
+		if err != nil {
+			return err
+		}
+		s.Version = 1
+		if latest != nil {
+			s.Version = latest.Version + 1
+		}
+		return tx.Save(s)
+	}); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+//Snapshots returns snapshots of the bookmark ordered by version.
+func (r *Store) Snapshots(ctx context.Context, id int) ([]*Snapshot, error) {
+	if _, err := r.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	ss := []*Snapshot{}
+	if err := r.db.Find("BookmarkID", id, &ss); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	return ss, nil
+}
+
+//OpenSnapshot returns snapshot of the bookmark and its content. Zero version
+//means the latest one. Caller has to close the content.
+func (r *Store) OpenSnapshot(ctx context.Context, id, version int) (*Snapshot, io.ReadCloser, error) {
+	if r.archiver == nil {
+		return nil, nil, ErrNoArchiver
+	}
+	ss, err := r.Snapshots(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	var s *Snapshot
+	for _, v := range ss {
+		if v.Version == version || version == 0 && (s == nil || v.Version > s.Version) {
+			s = v
+		}
+	}
+	if s == nil {
+		return nil, nil, ErrNotFound
+	}
+	rc, err := r.blobs.Open(s.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, rc, nil
+}
+
+//latestSnapshot returns the latest snapshot of the bookmark, or nil when it
+//has none.
+func latestSnapshot(n storm.Node, id int) (*Snapshot, error) {
+	ss := []Snapshot{}
+	if err := n.Find("BookmarkID", id, &ss); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	var latest *Snapshot
+	for i := range ss {
+		if latest == nil || ss[i].Version > latest.Version {
+			latest = &ss[i]
+		}
+	}
+	return latest, nil
+}
+
+//deleteSnapshots removes snapshots of the bookmark. Their contents stay in the
+//blob store, because other snapshots can share them.
+func deleteSnapshots(n storm.Node, id int) error {
+	ss := []Snapshot{}
+	if err := n.Find("BookmarkID", id, &ss); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	for i := range ss {
+		if err := n.DeleteStruct(&ss[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package bookmark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/asdine/storm/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+//sortBucket keeps sort index of bookmarks, which lets List seek to the page
+//without reading all of them. It has bucket of keys for every sort key but
+//ID, where key is made of the sort value and ID of the bookmark, and value
+//is ID and kind of the bookmark. Keys of every bookmark are kept in
+//sortIDsBucket, so they can be removed when its values change.
+const (
+	sortBucket    = "sort"
+	sortIDsBucket = "ids"
+	//sortBuiltKey marks index which has all bookmarks, see ensureSortIndex.
+	sortBuiltKey = "built"
+)
+
+//indexedSorts are sort keys kept in sort index.
+var indexedSorts = []string{SortCreatedAt, SortUpdatedAt, SortTitle, SortFrecency}
+
+//sortKey returns key of the bookmark in sort index. Keys are ordered by
+//value, then by ID, like bookmarks listed by List.
+func sortKey(value interface{}, id int) []byte {
+	var key []byte
+	switch v := value.(type) {
+	case time.Time:
+		key = make([]byte, 12)
+		//Flipped sign bit orders times before 1970 first.
+		binary.BigEndian.PutUint64(key, uint64(v.Unix())^1<<63)
+		binary.BigEndian.PutUint32(key[8:], uint32(v.Nanosecond()))
+	case string:
+		//Separator orders title before titles it's prefix of.
+		key = append([]byte(v), 0)
+	case float64:
+		//Negative numbers have all bits flipped, so larger magnitude is
+		//ordered first, positive ones only sign bit.
+		bits := math.Float64bits(v)
+		if bits>>63 == 0 {
+			bits ^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		key = make([]byte, 8)
+		binary.BigEndian.PutUint64(key, bits)
+	}
+	return append(key, idBytes(id)...)
+}
+
+func idBytes(id int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(id))
+	return b
+}
+
+//updateSortKeys replaces keys of the bookmark in sort index.
+func updateSortKeys(n storm.Node, bm *Bookmark) error {
+	if err := removeSortKeys(n, bm.ID); err != nil {
+		return err
+	}
+	ix := n.From(sortBucket)
+	value := append(idBytes(bm.ID), bm.Kind...)
+	keys := map[string][]byte{}
+	for _, s := range indexedSorts {
+		key := sortKey(sortValue(bm, s), bm.ID)
+		if err := ix.SetBytes(s, key, value); err != nil {
+			return err
+		}
+		keys[s] = key
+	}
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	return ix.SetBytes(sortIDsBucket, bm.ID, data)
+}
+
+//removeSortKeys removes the bookmark from sort index.
+func removeSortKeys(n storm.Node, id int) error {
+	ix := n.From(sortBucket)
+	data, err := ix.GetBytes(sortIDsBucket, id)
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	keys := map[string][]byte{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+	for s, key := range keys {
+		if err := ix.Delete(s, key); err != nil && err != storm.ErrNotFound {
+			return err
+		}
+	}
+	return ix.Delete(sortIDsBucket, id)
+}
+
+//buildSortIndex rebuilds sort index from all bookmarks.
+func buildSortIndex(n storm.Node) error {
+	if err := n.Drop(sortBucket); err != nil && err != bolt.ErrBucketNotFound {
+		return err
+	}
+	if err := n.Select().Each(&Bookmark{}, func(record interface{}) error {
+		return updateSortKeys(n, record.(*Bookmark))
+	}); err != nil && err != storm.ErrNotFound {
+		return err
+	}
+	return n.SetBytes(sortBucket, sortBuiltKey, []byte{1})
+}
+
+//ensureSortIndex builds sort index of databases created before it was kept.
+func (r *Store) ensureSortIndex() error {
+	if built, err := r.db.KeyExists(sortBucket, sortBuiltKey); err == nil && built {
+		return nil
+	}
+	return r.withTx(func(tx storm.Node) error {
+		//Other call could have built it in the meantime.
+		if built, err := tx.KeyExists(sortBucket, sortBuiltKey); err == nil && built {
+			return nil
+		}
+		return buildSortIndex(tx)
+	})
+}
+
+//listSorted returns bookmarks following the one pointed by the cursor, which
+//has given sort value, in sort index of opts.Sort. It returns at most
+//opts.Limit+1 of them, so the caller knows whether there is next page.
+func (r *Store) listSorted(opts ListOptions, c *cursor, value interface{}) ([]Bookmark, error) {
+	if err := r.ensureSortIndex(); err != nil {
+		return nil, err
+	}
+	var after []byte
+	if c != nil {
+		after = sortKey(value, c.ID)
+	}
+	bms := []Bookmark{}
+	err := r.db.Bolt.View(func(tx *bolt.Tx) error {
+		b := r.db.From(sortBucket).GetBucket(tx, opts.Sort)
+		if b == nil {
+			return nil
+		}
+		cur := b.Cursor()
+		next := cur.Next
+		var k, v []byte
+		switch {
+		case opts.Order == OrderAsc && after == nil:
+			k, v = cur.First()
+		case opts.Order == OrderAsc:
+			k, v = cur.Seek(after)
+		default:
+			next = cur.Prev
+			if after == nil {
+				k, v = cur.Last()
+				break
+			}
+			//Seek goes to the first key which isn't smaller.
+			if k, v = cur.Seek(after); k == nil {
+				k, v = cur.Last()
+			} else if !bytes.Equal(k, after) {
+				k, v = cur.Prev()
+			}
+		}
+		n := r.db.WithTransaction(tx)
+		for ; k != nil; k, v = next() {
+			//Nil value belongs to metadata bucket of storm.
+			if v == nil || bytes.Equal(k, after) {
+				continue
+			}
+			if opts.Kind != "" && !matchKind(string(v[8:]), opts.Kind) {
+				continue
+			}
+			bm := Bookmark{}
+			if err := n.One("ID", int(binary.BigEndian.Uint64(v[:8])), &bm); err != nil {
+				return err
+			}
+			bms = append(bms, bm)
+			if opts.Limit > 0 && len(bms) > opts.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return bms, err
+}
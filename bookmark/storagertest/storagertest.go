@@ -0,0 +1,339 @@
+//Package storagertest provides conformance tests of bookmark.Storager
+//implementations, so code written against the interface works the same with
+//the local store and the remote server.
+package storagertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akruszewski/librarian/bookmark"
+	"github.com/stretchr/testify/require"
+)
+
+//WithStorager calls f with a new empty storager, which has neither fetcher
+//nor archiver configured, and releases it when f returns.
+type WithStorager func(f func(s bookmark.Storager))
+
+//Run runs the conformance tests, each with its own storager.
+func Run(t *testing.T, withStorager WithStorager) {
+	for _, test := range []struct {
+		name string
+		run  func(*testing.T, bookmark.Storager)
+	}{
+		{"AddAndGet", testAddAndGet},
+		{"Validation", testValidation},
+		{"Update", testUpdate},
+		{"Visit", testVisit},
+		{"ListAndQuery", testListAndQuery},
+		{"Tags", testTags},
+		{"Collections", testCollections},
+		{"History", testHistory},
+		{"Trash", testTrash},
+		{"ImportExport", testImportExport},
+		{"NotConfigured", testNotConfigured},
+	} {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			withStorager(func(s bookmark.Storager) {
+				test.run(t, s)
+			})
+		})
+	}
+}
+
+func testAddAndGet(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	bm, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com", Tags: []string{"go"}, Notes: "note"})
+	r.NoError(err)
+	r.NotZero(bm.ID)
+
+	got, err := s.Get(ctx, bm.ID)
+	r.NoError(err)
+	r.Equal(bm.ID, got.ID)
+	r.Equal("Test", got.Title)
+	r.Equal("https://test.com", got.URL)
+	r.Equal([]string{"go"}, got.Tags)
+	r.Equal("note", got.Notes)
+
+	got, err = s.GetByURL(ctx, "https://test.com")
+	r.NoError(err)
+	r.Equal(bm.ID, got.ID)
+
+	_, err = s.Get(ctx, bm.ID+1)
+	r.True(errors.Is(err, bookmark.ErrNotFound), err)
+	_, err = s.GetByURL(ctx, "https://other.com")
+	r.True(errors.Is(err, bookmark.ErrNotFound), err)
+
+	_, err = s.Add(ctx, &bookmark.NewBookmark{Title: "Other", URL: "https://test.com"})
+	var dupErr *bookmark.ErrDuplicate
+	r.True(errors.As(err, &dupErr), err)
+	r.Equal(bm.ID, dupErr.ID)
+
+	_, err = s.Add(ctx, &bookmark.NewBookmark{Title: "Other", URL: "https://test.com"}, "invalid")
+	r.True(errors.Is(err, bookmark.ErrInvalidConflictPolicy), err)
+}
+
+func testValidation(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	_, err := s.Add(ctx, &bookmark.NewBookmark{Kind: "invalid", URL: "https://test.com"})
+	var invErr *bookmark.ErrInvalidBookmark
+	r.True(errors.As(err, &invErr), err)
+	r.Equal([]bookmark.FieldError{{Field: "Kind", Tag: "oneof", Param: "url cmd snippet"}}, invErr.Fields)
+
+	bm, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com"})
+	r.NoError(err)
+	_, err = s.Update(ctx, &bookmark.Bookmark{ID: bm.ID, Kind: "invalid"}, "Kind")
+	r.True(errors.As(err, &invErr), err)
+	r.Equal("Kind", invErr.Fields[0].Field)
+}
+
+func testUpdate(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	bm, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com", Notes: "note"})
+	r.NoError(err)
+	other, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Other", URL: "https://other.com"})
+	r.NoError(err)
+
+	updated, err := s.Update(ctx, &bookmark.Bookmark{ID: bm.ID, Title: "Changed"}, "Title")
+	r.NoError(err)
+	r.Equal("Changed", updated.Title)
+	r.Equal("note", updated.Notes)
+
+	_, err = s.Update(ctx, &bookmark.Bookmark{ID: other.ID + 1, Title: "Changed"}, "Title")
+	r.True(errors.Is(err, bookmark.ErrNotFound), err)
+	_, err = s.Update(ctx, &bookmark.Bookmark{ID: bm.ID}, "ID")
+	r.True(errors.Is(err, bookmark.ErrUnknownField), err)
+	_, err = s.Update(ctx, &bookmark.Bookmark{ID: bm.ID, URL: "https://other.com"}, "URL")
+	var dupErr *bookmark.ErrDuplicate
+	r.True(errors.As(err, &dupErr), err)
+	r.Equal(other.ID, dupErr.ID)
+}
+
+func testVisit(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	bm, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com"})
+	r.NoError(err)
+	visited, err := s.Visit(ctx, bm.ID)
+	r.NoError(err)
+	r.Equal(1, visited.Visits)
+	got, err := s.Get(ctx, bm.ID)
+	r.NoError(err)
+	r.Equal(1, got.Visits)
+
+	_, err = s.Visit(ctx, bm.ID+1)
+	r.True(errors.Is(err, bookmark.ErrNotFound), err)
+}
+
+func testListAndQuery(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	for _, nbm := range []*bookmark.NewBookmark{
+		{Title: "Go", URL: "https://golang.org", Tags: []string{"go"}},
+		{Title: "Rust", URL: "https://rust-lang.org", Tags: []string{"rust"}},
+		{Title: "Go blog", URL: "https://blog.golang.org", Tags: []string{"go", "blog"}},
+	} {
+		_, err := s.Add(ctx, nbm)
+		r.NoError(err)
+	}
+
+	bms, next, err := s.List(ctx, bookmark.ListOptions{Limit: 2})
+	r.NoError(err)
+	r.Len(bms, 2)
+	r.NotEmpty(next)
+	bms, next, err = s.List(ctx, bookmark.ListOptions{Limit: 2, Cursor: next})
+	r.NoError(err)
+	r.Len(bms, 1)
+	r.Empty(next)
+	r.Equal("Go blog", bms[0].Title)
+	_, _, err = s.List(ctx, bookmark.ListOptions{Limit: 2, Cursor: "invalid"})
+	r.True(errors.Is(err, bookmark.ErrInvalidCursor), err)
+
+	bms, err = s.Query(ctx, bookmark.Query{AllTags: []string{"go"}})
+	r.NoError(err)
+	r.Len(bms, 2)
+	bms, err = s.Query(ctx, bookmark.Query{})
+	r.NoError(err)
+	r.Len(bms, 3)
+
+	hits, err := s.Search(ctx, "rust", 10)
+	r.NoError(err)
+	r.Len(hits, 1)
+	r.Equal("Rust", hits[0].Bookmark.Title)
+	r.NoError(s.Reindex(ctx))
+}
+
+func testTags(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	_, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com", Tags: []string{"go", "lang"}})
+	r.NoError(err)
+
+	n, err := s.RenameTag(ctx, "lang", "language")
+	r.NoError(err)
+	r.Equal(1, n)
+	_, err = s.RenameTag(ctx, "missing", "other")
+	r.True(errors.Is(err, bookmark.ErrTagNotFound), err)
+	_, err = s.RenameTag(ctx, "go", "")
+	r.True(errors.Is(err, bookmark.ErrInvalidTag), err)
+
+	n, err = s.MergeTags(ctx, []string{"go", "language"}, "golang")
+	r.NoError(err)
+	r.Equal(1, n)
+	tags, err := s.Tags(ctx)
+	r.NoError(err)
+	r.Len(tags, 1)
+	r.Equal("golang", tags[0].Name)
+
+	n, err = s.DeleteTag(ctx, "golang")
+	r.NoError(err)
+	r.Equal(1, n)
+}
+
+func testCollections(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	col, err := s.CreateCollection(ctx, "work/infra")
+	r.NoError(err)
+	r.Equal("work/infra", col.Path)
+	_, err = s.CreateCollection(ctx, "work/infra")
+	r.True(errors.Is(err, bookmark.ErrCollectionExists), err)
+	_, err = s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com", Collections: []string{"work/infra"}})
+	r.NoError(err)
+
+	col, err = s.MoveCollection(ctx, "work/infra", "ops")
+	r.NoError(err)
+	r.Equal("ops", col.Path)
+	_, err = s.MoveCollection(ctx, "missing", "other")
+	r.True(errors.Is(err, bookmark.ErrCollectionNotFound), err)
+
+	cs, err := s.Collections(ctx)
+	r.NoError(err)
+	r.Len(cs, 2)
+
+	n, err := s.DeleteCollection(ctx, "ops", "work")
+	r.NoError(err)
+	r.Equal(1, n)
+	_, err = s.DeleteCollection(ctx, "ops", "")
+	r.True(errors.Is(err, bookmark.ErrCollectionNotFound), err)
+}
+
+func testHistory(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := bookmark.WithAuthor(context.Background(), "alice")
+
+	bm, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com"})
+	r.NoError(err)
+	_, err = s.Update(ctx, &bookmark.Bookmark{ID: bm.ID, Title: "Changed"}, "Title")
+	r.NoError(err)
+
+	revs, err := s.History(ctx, bm.ID)
+	r.NoError(err)
+	r.Len(revs, 2)
+	r.Equal("alice", revs[1].Author)
+	r.Equal([]bookmark.FieldChange{{Field: "Title", Old: "Test", New: "Changed"}}, revs[1].Changes)
+
+	restored, err := s.Restore(ctx, bm.ID, 1)
+	r.NoError(err)
+	r.Equal("Test", restored.Title)
+	_, err = s.Restore(ctx, bm.ID, 10)
+	r.True(errors.Is(err, bookmark.ErrRevisionNotFound), err)
+	_, err = s.History(ctx, bm.ID+1)
+	r.True(errors.Is(err, bookmark.ErrNotFound), err)
+}
+
+func testTrash(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	bm, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com"})
+	r.NoError(err)
+	r.NoError(s.Delete(ctx, bm.ID))
+	r.True(errors.Is(s.Delete(ctx, bm.ID), bookmark.ErrNotFound))
+	_, err = s.Get(ctx, bm.ID)
+	r.True(errors.Is(err, bookmark.ErrNotFound), err)
+
+	trashed, err := s.Trash(ctx)
+	r.NoError(err)
+	r.Len(trashed, 1)
+	r.Equal(bm.ID, trashed[0].ID)
+
+	restored, err := s.RestoreFromTrash(ctx, bm.ID)
+	r.NoError(err)
+	r.Equal("Test", restored.Title)
+	_, err = s.RestoreFromTrash(ctx, bm.ID)
+	r.True(errors.Is(err, bookmark.ErrNotFound), err)
+
+	r.NoError(s.Delete(ctx, bm.ID))
+	n, err := s.EmptyTrash(ctx, time.Now().Add(-time.Hour))
+	r.NoError(err)
+	r.Zero(n)
+	n, err = s.EmptyTrash(ctx, time.Now().Add(time.Minute))
+	r.NoError(err)
+	r.Equal(1, n)
+}
+
+func testImportExport(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	bm, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com", Tags: []string{"go"}})
+	r.NoError(err)
+	csv := &bytes.Buffer{}
+	r.NoError(s.ExportCSV(ctx, csv))
+	html := &bytes.Buffer{}
+	r.NoError(s.ExportHTML(ctx, html))
+	r.Contains(html.String(), "https://test.com")
+
+	r.NoError(s.Delete(ctx, bm.ID))
+	report, err := s.ImportCSV(ctx, bytes.NewReader(csv.Bytes()), bookmark.ImportOptions{})
+	r.NoError(err)
+	r.Len(report.Inserted, 1)
+	imported, err := s.GetByURL(ctx, "https://test.com")
+	r.NoError(err)
+	r.Equal([]string{"go"}, imported.Tags)
+
+	report, err = s.ImportHTML(ctx, bytes.NewReader(html.Bytes()), bookmark.ImportOptions{Conflict: bookmark.ConflictSkip})
+	r.NoError(err)
+	r.Len(report.Duplicates, 1)
+
+	_, err = s.ImportCSV(ctx, bytes.NewReader(csv.Bytes()), bookmark.ImportOptions{Mode: "invalid"})
+	r.True(errors.Is(err, bookmark.ErrInvalidImportMode), err)
+	report, err = s.ImportCSV(ctx, bytes.NewReader(csv.Bytes()), bookmark.ImportOptions{})
+	r.True(errors.Is(err, bookmark.ErrImportRolledBack), err)
+	r.False(report.Committed)
+}
+
+func testNotConfigured(t *testing.T, s bookmark.Storager) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	bm, err := s.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "https://test.com"})
+	r.NoError(err)
+
+	_, err = s.Refetch(ctx, bm.ID)
+	r.True(errors.Is(err, bookmark.ErrNoFetcher), err)
+	_, err = s.Snapshot(ctx, bm.ID, bookmark.SnapshotHTML)
+	r.True(errors.Is(err, bookmark.ErrNoArchiver), err)
+	_, _, err = s.OpenSnapshot(ctx, bm.ID, 0)
+	r.True(errors.Is(err, bookmark.ErrNoArchiver), err)
+	ss, err := s.Snapshots(ctx, bm.ID)
+	r.NoError(err)
+	r.Empty(ss)
+	_, err = s.Snapshots(ctx, bm.ID+1)
+	r.True(errors.Is(err, bookmark.ErrNotFound), err)
+}
@@ -0,0 +1,161 @@
+package bookmark
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+var (
+	//ErrInvalidTag is returned for tag names which are empty after
+	//normalization, see NormalizeTags.
+	ErrInvalidTag = errors.New("invalid tag")
+	//ErrTagNotFound is returned when no bookmark has the tag.
+	ErrTagNotFound = errors.New("tag not found")
+	//ErrTagExists is returned by RenameTag when some bookmark already has
+	//the new name, MergeTags has to be used then.
+	ErrTagExists = errors.New("tag already exists")
+)
+
+//TagCount is the tag with the number of bookmarks which have it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+//NormalizeTag returns the tag trimmed and in lower case.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+//NormalizeTags normalizes tags with NormalizeTag, empty and repeated tags are
+//dropped. It returns nil when no tags are left.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = NormalizeTag(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			normalized = append(normalized, t)
+		}
+	}
+	return normalized
+}
+
+//Tags returns all tags with number of their bookmarks, ordered by name.
+func (r *Store) Tags(ctx context.Context) ([]*TagCount, error) {
+	counts := map[string]int{}
+	if err := r.db.Select().Each(&Bookmark{}, func(record interface{}) error {
+		for _, t := range record.(*Bookmark).Tags {
+			counts[t]++
+		}
+		return nil
+	}); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	tags := []*TagCount{}
+	for name, count := range counts {
+		tags = append(tags, &TagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+//RenameTag renames the tag on all bookmarks and returns their number.
+//ErrTagExists is returned when the new name is already used.
+func (r *Store) RenameTag(ctx context.Context, old, new string) (int, error) {
+	if NormalizeTag(new) == "" {
+		return 0, fmt.Errorf("%w: empty tag", ErrInvalidTag)
+	}
+	if NormalizeTag(old) == NormalizeTag(new) {
+		return 0, fmt.Errorf("%w: tag can't be renamed to itself", ErrInvalidTag)
+	}
+	return r.replaceTags(ctx, []string{old}, new, true)
+}
+
+//MergeTags replaces tags from with the tag to on all bookmarks and returns
+//their number. Tag to doesn't have to exist.
+func (r *Store) MergeTags(ctx context.Context, from []string, to string) (int, error) {
+	if len(from) == 0 {
+		return 0, fmt.Errorf("%w: no tags to merge", ErrInvalidTag)
+	}
+	if NormalizeTag(to) == "" {
+		return 0, fmt.Errorf("%w: empty tag", ErrInvalidTag)
+	}
+	return r.replaceTags(ctx, from, to, false)
+}
+
+//DeleteTag removes the tag from all bookmarks and returns their number.
+func (r *Store) DeleteTag(ctx context.Context, tag string) (int, error) {
+	return r.replaceTags(ctx, []string{tag}, "", false)
+}
+
+//replaceTags replaces tags from with the tag to, or removes them when to is
+//empty, on all bookmarks in a single transaction. ErrTagNotFound is returned
+//when no bookmark has any of the tags.
+func (r *Store) replaceTags(ctx context.Context, from []string, to string, unique bool) (int, error) {
+	replaced := map[string]bool{}
+	for _, t := range from {
+		t = NormalizeTag(t)
+		if t == "" {
+			return 0, fmt.Errorf("%w: empty tag", ErrInvalidTag)
+		}
+		replaced[t] = true
+	}
+	//Merging tag into itself keeps it on the bookmarks.
+	to = NormalizeTag(to)
+	delete(replaced, to)
+
+	updated, exists := 0, false
+	err := r.withTx(func(tx storm.Node) error {
+		bms := []Bookmark{}
+		if err := tx.All(&bms); err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		now := time.Now().UTC()
+		for i := range bms {
+			bm := &bms[i]
+			tags, changed := []string{}, false
+			for _, t := range bm.Tags {
+				if t == to {
+					exists = true
+				}
+				if !replaced[t] {
+					tags = append(tags, t)
+					continue
+				}
+				changed = true
+				if to != "" {
+					tags = append(tags, to)
+				}
+			}
+			if !changed {
+				continue
+			}
+			bm.Tags = tags
+			bm.UpdatedAt = now
+			if err := r.save(ctx, tx, bm); err != nil {
+				return err
+			}
+			updated++
+		}
+		if updated == 0 {
+			return ErrTagNotFound
+		}
+		//Transaction is rolled back, so no bookmark is changed.
+		if unique && exists {
+			return fmt.Errorf("%w: %q", ErrTagExists, to)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
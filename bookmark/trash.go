@@ -0,0 +1,118 @@
+package bookmark
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/asdine/storm/v3"
+)
+
+//trashBucket is the storm bucket of deleted bookmarks.
+const trashBucket = "trash"
+
+//DefaultTrashRetention is the period after which RunTrashPurger purges
+//deleted bookmarks.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+//trashPurgeInterval is the interval of purges run by RunTrashPurger.
+const trashPurgeInterval = time.Hour
+
+//trashedBookmark is the bookmark in the trash. The bookmark isn't indexed in
+//the trash, so it doesn't take its URL and title, and bookmark with the same
+//URL can be added again.
+type trashedBookmark struct {
+	ID        int       `storm:"id"`
+	DeletedAt time.Time `storm:"index"`
+	Bookmark  *Bookmark
+}
+
+//Trash returns deleted bookmarks, most recently deleted first.
+func (r *Store) Trash(ctx context.Context) ([]*Bookmark, error) {
+	trashed := []trashedBookmark{}
+	if err := r.db.From(trashBucket).All(&trashed); err != nil && err != storm.ErrNotFound {
+		return nil, err
+	}
+	bms := make([]*Bookmark, 0, len(trashed))
+	for _, t := range trashed {
+		bms = append(bms, t.Bookmark)
+	}
+	sort.SliceStable(bms, func(i, j int) bool { return bms[i].DeletedAt.After(bms[j].DeletedAt) })
+	return bms, nil
+}
+
+//RestoreFromTrash moves the deleted bookmark back from the trash.
+//ErrDuplicate is returned when other bookmark got its URL or title in the
+//meantime.
+func (r *Store) RestoreFromTrash(ctx context.Context, id int) (*Bookmark, error) {
+	var bm *Bookmark
+	if err := r.withTx(func(tx storm.Node) error {
+		trash := tx.From(trashBucket)
+		t := &trashedBookmark{}
+		if err := trash.One("ID", id, t); err != nil {
+			return err
+		}
+		bm = t.Bookmark
+		bm.DeletedAt = time.Time{}
+		if err := checkUnique(tx, bm); err != nil {
+			return err
+		}
+		if err := trash.DeleteStruct(t); err != nil {
+			return err
+		}
+		return r.save(ctx, tx, bm)
+	}); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return bm, nil
+}
+
+//EmptyTrash permanently deletes bookmarks, which were deleted before given
+//time, with their snapshots, and returns their number. Revisions of the
+//bookmarks are kept.
+func (r *Store) EmptyTrash(ctx context.Context, before time.Time) (int, error) {
+	purged := 0
+	if err := r.withTx(func(tx storm.Node) error {
+		trash := tx.From(trashBucket)
+		trashed := []trashedBookmark{}
+		if err := trash.All(&trashed); err != nil && err != storm.ErrNotFound {
+			return err
+		}
+		for i := range trashed {
+			if !trashed[i].DeletedAt.Before(before) {
+				continue
+			}
+			if err := trash.DeleteStruct(&trashed[i]); err != nil {
+				return err
+			}
+			if err := deleteSnapshots(tx, trashed[i].ID); err != nil {
+				return err
+			}
+			purged++
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
+
+//RunTrashPurger purges bookmarks deleted longer than retention ago, at start
+//and then every hour until ctx is done. Errors are passed to handleErr.
+func (r *Store) RunTrashPurger(ctx context.Context, retention time.Duration, handleErr func(err error)) error {
+	t := time.NewTicker(trashPurgeInterval)
+	defer t.Stop()
+	for {
+		if _, err := r.EmptyTrash(ctx, time.Now().Add(-retention)); err != nil && ctx.Err() == nil {
+			handleErr(err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package bookmark
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	validator "github.com/go-playground/validator/v10"
+)
+
+//ErrInvalidBookmark is returned when bookmark can't be saved, because its
+//fields failed validation. Locally it wraps validator.ValidationErrors, which
+//can be inspected with errors.As, but only Fields are available in all
+//implementations of Storager.
+type ErrInvalidBookmark struct {
+	Fields []FieldError `json:"fields"`
+	err    error
+}
+
+//FieldError describes the field which failed validation.
+type FieldError struct {
+	//Field is the name of the field, e.g. "URL" or "Tags[0]".
+	Field string `json:"field"`
+	//Tag is the failed validation, e.g. "required".
+	Tag string `json:"tag"`
+	//Param is the parameter of the validation, e.g. allowed kinds of "oneof".
+	Param string `json:"param,omitempty"`
+}
+
+func (e *ErrInvalidBookmark) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, fmt.Sprintf("%s failed on the %q validation", f.Field, f.Tag))
+	}
+	return "invalid bookmark: " + strings.Join(msgs, ", ")
+}
+
+func (e *ErrInvalidBookmark) Unwrap() error {
+	return e.err
+}
+
+//invalidBookmark wraps validator.ValidationErrors in ErrInvalidBookmark,
+//other errors are returned unchanged.
+func invalidBookmark(err error) error {
+	var ve validator.ValidationErrors
+	if !errors.As(err, &ve) {
+		return err
+	}
+	fields := make([]FieldError, 0, len(ve))
+	for _, fe := range ve {
+		fields = append(fields, FieldError{Field: fe.Field(), Tag: fe.Tag(), Param: fe.Param()})
+	}
+	return &ErrInvalidBookmark{Fields: fields, err: err}
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/akruszewski/librarian/blob"
+	"github.com/akruszewski/librarian/bookmark"
+	"github.com/akruszewski/librarian/config"
+	"github.com/akruszewski/librarian/fetch"
+	librarianHttp "github.com/akruszewski/librarian/http"
+	"github.com/asdine/storm/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+//Backends of commands, see config.Config.Backend.
+const (
+	//backendAuto uses the server when it's reachable and the database
+	//otherwise.
+	backendAuto   = "auto"
+	backendServer = "server"
+	backendLocal  = "local"
+)
+
+//serverProbeTimeout is how long commands wait for connection to the server
+//before they fall back to the database.
+const serverProbeTimeout = time.Second
+
+//errDBLocked is returned when the database is opened by other process,
+//usually the server. Bolt allows a single process to open the database.
+var errDBLocked = errors.New("database is locked by other process")
+
+//backend is the bookmark.Storager picked by open, librarianHttp.Client which
+//talks to the server or bookmark.Store working on the database directly.
+//Commands get it before it's opened, so the storager is set once global flags
+//are parsed.
+type backend struct {
+	bookmark.Storager
+	cfg *config.Config
+	//ctx is the context of calls, with the user running librarian as author
+	//of changes.
+	ctx context.Context
+	//close releases the storager, it's nil when nothing has to be released.
+	close func() error
+}
+
+//open picks the storager of the configured backend.
+func (b *backend) open(ctx context.Context) error {
+	cfg := b.cfg
+	b.ctx = bookmark.WithAuthor(ctx, currentUser())
+	client, err := librarianHttp.NewClient(cfg.Server, cfg.Timeout)
+	if err != nil {
+		return err
+	}
+	switch cfg.Backend {
+	case backendServer:
+		b.Storager = client
+		return nil
+	case backendLocal:
+		return b.openLocal(cfg)
+	case "", backendAuto:
+		if serverReachable(cfg.Server) {
+			b.Storager = client
+			return nil
+		}
+		err := b.openLocal(cfg)
+		if errors.Is(err, errDBLocked) {
+			return fmt.Errorf("server %s isn't reachable and %w", cfg.Server, err)
+		}
+		return err
+	}
+	return fmt.Errorf("invalid backend %q, expected %s, %s or %s", cfg.Backend, backendAuto, backendServer, backendLocal)
+}
+
+func (b *backend) openLocal(cfg *config.Config) error {
+	db, err := openDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	blobs, err := blob.Open(blobPath(cfg))
+	if err != nil {
+		db.Close()
+		return err
+	}
+	f := fetch.New()
+	//Added bookmarks stay pending until the server fetches them.
+	b.Storager = bookmark.NewStore(db,
+		bookmark.WithFetcher(f),
+		bookmark.WithMetadataResolver(f),
+		bookmark.WithArchiver(f, blobs),
+	)
+	b.close = db.Close
+	return nil
+}
+
+//Close releases the storager.
+func (b *backend) Close() error {
+	if b.close == nil {
+		return nil
+	}
+	return b.close()
+}
+
+//serverReachable reports whether the server of the bookmark endpoint accepts
+//connections.
+func serverReachable(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), serverProbeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+//openDB opens the database, errDBLocked is returned when other process has
+//it open.
+func openDB(path string) (*storm.DB, error) {
+	db, err := storm.Open(path)
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("%w: %s", errDBLocked, path)
+	}
+	return db, err
+}
+
+//blobDir is the directory of snapshot contents, next to the database.
+const blobDir = "blobs"
+
+//blobPath returns the directory of snapshot contents, next to the database.
+func blobPath(cfg *config.Config) string {
+	return filepath.Join(filepath.Dir(cfg.DB), blobDir)
+}
+
+//parseID parses ID of the bookmark given on the command line.
+func parseID(id string) (int, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bookmark id %q", id)
+	}
+	return n, nil
+}
@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akruszewski/librarian/bookmark"
+	"github.com/akruszewski/librarian/config"
+	librarianHttp "github.com/akruszewski/librarian/http"
+	"github.com/asdine/storm/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AutoBackendFallsBackToDatabaseWhenServerIsUnreachable(t *testing.T) {
+	withTestConfig(func(cfg *config.Config) {
+		r := require.New(t)
+
+		b := &backend{cfg: cfg}
+		r.NoError(b.open(context.Background()))
+		defer b.Close()
+		r.IsType(&bookmark.Store{}, b.Storager)
+
+		_, err := b.Add(b.ctx, &bookmark.NewBookmark{Title: "Go", URL: "https://go.dev"})
+		r.NoError(err)
+		_, err = os.Stat(cfg.DB)
+		r.NoError(err)
+	})
+}
+
+func Test_AutoBackendUsesReachableServer(t *testing.T) {
+	withTestConfig(func(cfg *config.Config) {
+		r := require.New(t)
+
+		db, err := storm.Open(filepath.Join(filepath.Dir(cfg.DB), "server.db"))
+		r.NoError(err)
+		defer db.Close()
+		repo := bookmark.NewStore(db)
+		srv := httptest.NewServer(librarianHttp.Handler(repo))
+		defer srv.Close()
+		cfg.Server = srv.URL + "/bookmark"
+
+		b := &backend{cfg: cfg}
+		r.NoError(b.open(context.Background()))
+		defer b.Close()
+		r.IsType(&librarianHttp.Client{}, b.Storager)
+
+		bm, err := b.Add(b.ctx, &bookmark.NewBookmark{Title: "Go", URL: "https://go.dev"})
+		r.NoError(err)
+		_, err = repo.Get(context.Background(), bm.ID)
+		r.NoError(err)
+		_, err = os.Stat(cfg.DB)
+		r.True(os.IsNotExist(err))
+	})
+}
+
+func Test_ServerBackendFailsWhenServerIsUnreachable(t *testing.T) {
+	withTestConfig(func(cfg *config.Config) {
+		r := require.New(t)
+
+		cfg.Backend = backendServer
+		b := &backend{cfg: cfg}
+		r.NoError(b.open(context.Background()))
+		defer b.Close()
+		r.IsType(&librarianHttp.Client{}, b.Storager)
+
+		_, _, err := b.List(b.ctx, bookmark.ListOptions{})
+		r.Error(err)
+		_, err = os.Stat(cfg.DB)
+		r.True(os.IsNotExist(err))
+	})
+}
+
+func Test_LocalBackendIgnoresServer(t *testing.T) {
+	withTestConfig(func(cfg *config.Config) {
+		r := require.New(t)
+
+		requests := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests++
+		}))
+		defer srv.Close()
+		cfg.Server = srv.URL + "/bookmark"
+		cfg.Backend = backendLocal
+
+		b := &backend{cfg: cfg}
+		r.NoError(b.open(context.Background()))
+		defer b.Close()
+		r.IsType(&bookmark.Store{}, b.Storager)
+
+		_, err := b.Add(b.ctx, &bookmark.NewBookmark{Title: "Go", URL: "https://go.dev"})
+		r.NoError(err)
+		r.Zero(requests)
+	})
+}
+
+func Test_BackendReportsLockedDatabase(t *testing.T) {
+	withTestConfig(func(cfg *config.Config) {
+		r := require.New(t)
+
+		db, err := storm.Open(cfg.DB)
+		r.NoError(err)
+		defer db.Close()
+
+		_, err = openDB(cfg.DB)
+		r.True(errors.Is(err, errDBLocked), err)
+
+		b := &backend{cfg: cfg}
+		err = b.open(context.Background())
+		r.True(errors.Is(err, errDBLocked), err)
+		r.Contains(err.Error(), "isn't reachable")
+
+		cfg.Backend = backendLocal
+		err = b.open(context.Background())
+		r.True(errors.Is(err, errDBLocked), err)
+	})
+}
+
+func Test_BackendRejectsUnknownBackend(t *testing.T) {
+	withTestConfig(func(cfg *config.Config) {
+		cfg.Backend = "remote"
+		b := &backend{cfg: cfg}
+		require.Error(t, b.open(context.Background()))
+	})
+}
+
+//withTestConfig runs f with configuration of the database in temporary
+//directory and the server which isn't listening. Configuration files are
+//looked up in the directory too, so the ones of the user are ignored.
+func withTestConfig(f func(cfg *config.Config)) {
+	dir, err := ioutil.TempDir("", "librarian_cli_*")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, env := range []string{"XDG_CONFIG_HOME", "XDG_CONFIG_DIRS"} {
+		old, ok := os.LookupEnv(env)
+		os.Setenv(env, dir)
+		if ok {
+			defer os.Setenv(env, old)
+		} else {
+			defer os.Unsetenv(env)
+		}
+	}
+
+	//Port of closed listener is free, so connections to it are refused.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	cfg := config.Default()
+	cfg.DB = filepath.Join(dir, "data.db")
+	cfg.Server = "http://" + addr + "/bookmark"
+	cfg.Timeout = time.Second
+	f(cfg)
+}
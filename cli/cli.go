@@ -1,64 +1,202 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/akruszewski/librarian/blob"
 	"github.com/akruszewski/librarian/bookmark"
+	"github.com/akruszewski/librarian/config"
+	"github.com/akruszewski/librarian/fetch"
 	librarianHttp "github.com/akruszewski/librarian/http"
-	"github.com/asdine/storm/v3"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
 
-func NewApp() (*cli.App, error) {
+//highlightRe matches markup of search highlights, which is replaced with
+//plain text markers in terminal output.
+var highlightRe = regexp.MustCompile(`</?mark>`)
 
-	client, err := librarianHttp.NewClient("http://127.0.0.1:8080/bookmark", 10*time.Second)
-	if err != nil {
-		return nil, err
-	}
+func NewApp() (*cli.App, error) {
+	//Configuration is loaded by configure, once global flags are parsed.
+	cfg := config.Default()
+	client := &backend{cfg: cfg}
 
-	return &cli.App{
-		Name:  "librarian",
-		Usage: "librarian is a bookmark manager application",
+	app := &cli.App{
+		Name:   "librarian",
+		Usage:  "librarian is a bookmark manager application",
+		Flags:  globalFlags(),
+		Before: configure(cfg),
+		After: func(c *cli.Context) error {
+			return client.Close()
+		},
 		Commands: []*cli.Command{
 			{
 				Name:    "serve",
 				Usage:   "start librarian service",
 				Aliases: []string{"s"},
-				Action:  serveHandler,
+				Action:  serveHandler(cfg),
+				Flags: []cli.Flag{
+					trackingParamFlag(),
+					&cli.BoolFlag{
+						Name:  "fetch",
+						Value: true,
+						Usage: "download pages of added bookmarks in the background and resolve their metadata",
+					},
+					&cli.DurationFlag{
+						Name:  "fetch-timeout",
+						Value: fetch.DefaultTimeout,
+						Usage: "time limit of the page download",
+					},
+					&cli.Int64Flag{
+						Name:  "fetch-max-size",
+						Value: fetch.DefaultMaxSize,
+						Usage: "maximum size of the downloaded page in bytes",
+					},
+					&cli.StringFlag{
+						Name:  "user-agent",
+						Value: fetch.DefaultUserAgent,
+						Usage: "User-Agent header of page downloads",
+					},
+					&cli.DurationFlag{
+						Name:  "check-interval",
+						Usage: "check links of all bookmarks periodically, disabled when zero",
+					},
+					&cli.IntFlag{
+						Name:  "check-concurrency",
+						Value: bookmark.DefaultCheckConcurrency,
+						Usage: "number of links checked at once",
+					},
+					rewriteRedirectsFlag(),
+					&cli.StringFlag{
+						Name:  "snapshot-format",
+						Usage: "save snapshot of every fetched page in given format, html or warc",
+					},
+					&cli.DurationFlag{
+						Name:  "trash-retention",
+						Value: bookmark.DefaultTrashRetention,
+						Usage: "purge deleted bookmarks from the trash after this period, disabled when zero",
+					},
+				},
+			},
+			{
+				Name:   "check",
+				Usage:  "check links of all bookmarks and record their health",
+				Action: checkHandler(cfg),
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: bookmark.DefaultCheckConcurrency,
+						Usage: "number of links checked at once",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Value: fetch.DefaultTimeout,
+						Usage: "time limit of the single link check",
+					},
+					&cli.StringFlag{
+						Name:  "user-agent",
+						Value: fetch.DefaultUserAgent,
+						Usage: "User-Agent header of requests",
+					},
+					rewriteRedirectsFlag(),
+					trackingParamFlag(),
+				},
+			},
+			{
+				Name:   "reindex",
+				Usage:  "rebuild full-text search index and canonical URLs",
+				Action: reindexHandler(cfg),
+				Flags:  []cli.Flag{trackingParamFlag()},
+			},
+			{
+				Name:      "import",
+				Usage:     "import bookmarks from CSV or browser HTML file",
+				ArgsUsage: "<FILE>",
+				Action:    importHandler(client),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format of the file, csv or html (default: detected from file extension)",
+					},
+					&cli.StringFlag{
+						Name:  "mode",
+						Value: string(bookmark.ImportStrict),
+						Usage: "strict (nothing is imported if any row is invalid or duplicate), lenient (invalid and duplicate rows are skipped) or dry-run (rows are only validated)",
+					},
+					&cli.StringFlag{
+						Name:  "on-conflict",
+						Value: string(bookmark.ConflictFail),
+						Usage: "what to do when bookmark with the same URL exists: fail, skip, overwrite, merge-tags or keep-newer",
+					},
+				},
 			},
 			{
-				Name:   "import",
-				Usage:  "import bookmarks from CSV file",
-				Action: importCSVHandler,
+				Name:      "export",
+				Usage:     "export bookmarks to CSV or browser HTML file",
+				ArgsUsage: "[FILE]",
+				Action:    exportHandler(client),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format of the file, csv or html (default: detected from file extension, csv for standard output)",
+					},
+				},
 			},
 			{
 				Name:      "add",
-				Usage:     "add bookmark",
+				Usage:     "add bookmark of web page, shell command or text snippet",
 				Aliases:   []string{"a"},
-				ArgsUsage: "<URL>",
+				ArgsUsage: "[URL]",
 				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "cmd",
+						Usage: "shell command which is bookmarked instead of URL",
+					},
+					&cli.StringFlag{
+						Name:  "snippet",
+						Usage: "text snippet which is bookmarked instead of URL",
+					},
 					&cli.StringFlag{
 						Name:  "title, t",
 						Value: "",
-						Usage: "title of the bookmark",
+						Usage: "title of the bookmark, resolved from the page when not given",
 					},
 					&cli.StringFlag{
 						Name:  "tags",
 						Value: "",
 						Usage: "tags of the bookmark",
 					},
+					&cli.StringFlag{
+						Name:  "collections",
+						Usage: "paths of collections of the bookmark separated by ;, e.g. work/infra",
+					},
 					&cli.StringFlag{
 						Name:  "note, n",
 						Value: "",
 						Usage: "notes to the bookmark",
 					},
+					&cli.StringFlag{
+						Name:  "on-conflict",
+						Value: string(bookmark.ConflictFail),
+						Usage: "what to do when bookmark with the same URL exists: fail, skip, overwrite, merge-tags or keep-newer",
+					},
 				},
 				Action: addHandler(client),
 			},
@@ -69,26 +207,95 @@ func NewApp() (*cli.App, error) {
 				ArgsUsage: "<ID>",
 				Action:    getHandler(client),
 			},
+			{
+				Name:      "open",
+				Usage:     "open bookmarked page in the browser",
+				Aliases:   []string{"o"},
+				ArgsUsage: "<ID>",
+				Action:    openHandler(client),
+			},
+			{
+				Name:      "run",
+				Usage:     "print bookmarked shell command and run it after confirmation",
+				ArgsUsage: "<ID>",
+				Action:    runHandler(client),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "print",
+						Usage: "only print the command",
+					},
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: "run the command without confirmation",
+					},
+				},
+			},
+			{
+				Name:      "refetch",
+				Usage:     "download page of the bookmark again",
+				ArgsUsage: "<ID>",
+				Action:    refetchHandler(client),
+			},
+			{
+				Name:      "snapshot",
+				Usage:     "save snapshot of the bookmarked page",
+				ArgsUsage: "<ID>",
+				Action:    snapshotHandler(client),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: bookmark.SnapshotHTML,
+						Usage: "format of the snapshot, html or warc",
+					},
+				},
+			},
+			{
+				Name:      "open-snapshot",
+				Usage:     "open snapshot of the bookmarked page in the browser",
+				ArgsUsage: "<ID> [VERSION]",
+				Action:    openSnapshotHandler(client),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "write the snapshot to the file instead, \"-\" for the standard output",
+					},
+				},
+			},
 			{
 				Name:      "update",
 				Usage:     "update bookmark",
 				Aliases:   []string{"u", "up"},
-				ArgsUsage: "<URL>",
+				ArgsUsage: "<ID>",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:  "title, t",
-						Value: "NOT_UPDATED",
-						Usage: "title of the bookmark",
+						Name:    "title",
+						Aliases: []string{"t"},
+						Usage:   "title of the bookmark",
+					},
+					&cli.StringFlag{
+						Name:  "url",
+						Usage: "URL of the bookmark, which makes it a web page",
+					},
+					&cli.StringFlag{
+						Name:  "cmd",
+						Usage: "shell command which is bookmarked instead of URL",
+					},
+					&cli.StringFlag{
+						Name:  "snippet",
+						Usage: "text snippet which is bookmarked instead of URL",
 					},
 					&cli.StringFlag{
 						Name:  "tags",
-						Value: "NOT_UPDATED",
 						Usage: "tags of the bookmark",
 					},
 					&cli.StringFlag{
-						Name:  "note, n",
-						Value: "NOT_UPDATED",
-						Usage: "notes to the bookmark",
+						Name:  "collections",
+						Usage: "paths of collections of the bookmark separated by ;",
+					},
+					&cli.StringFlag{
+						Name:    "note",
+						Aliases: []string{"n"},
+						Usage:   "notes to the bookmark",
 					},
 				},
 				Action: updateHandler(client),
@@ -100,12 +307,218 @@ func NewApp() (*cli.App, error) {
 				ArgsUsage: "<ID>",
 				Action:    deleteHandler(client),
 			},
+			{
+				Name:      "history",
+				Usage:     "show revisions of bookmark with changed fields",
+				ArgsUsage: "<ID>",
+				Action:    historyHandler(client),
+			},
+			{
+				Name:      "restore",
+				Usage:     "restore bookmark to given revision",
+				ArgsUsage: "<ID>",
+				Action:    restoreHandler(client),
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:     "rev",
+						Usage:    "version of the revision",
+						Required: true,
+					},
+				},
+			},
 			{
 				Name:    "list",
 				Usage:   "lists all bookmarks",
 				Aliases: []string{"l"},
 				Action:  listHandler(client),
 				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "sort",
+						Value: bookmark.SortID,
+						Usage: "sort key, one of id, created_at, updated_at, title or frecency",
+					},
+					&cli.StringFlag{
+						Name:  "order",
+						Value: bookmark.OrderAsc,
+						Usage: "sort order, asc or desc",
+					},
+					&cli.IntFlag{
+						Name:  "page-size",
+						Value: 100,
+						Usage: "number of bookmarks fetched from the server at once",
+					},
+					&cli.StringFlag{
+						Name:  "kind",
+						Usage: "kind of bookmarks, url, cmd or snippet",
+					},
+					&cli.StringFlag{
+						Name:  "fields",
+						Value: "id;title;url;tags;created_at;updated_at",
+						Usage: "fields which will be displayed",
+					},
+				},
+			},
+			{
+				Name:   "top",
+				Usage:  "list most used bookmarks",
+				Action: topHandler(client),
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "limit",
+						Value: 10,
+						Usage: "number of listed bookmarks",
+					},
+					&cli.StringFlag{
+						Name:  "kind",
+						Usage: "kind of bookmarks, url, cmd or snippet",
+					},
+					&cli.StringFlag{
+						Name:  "fields",
+						Value: "id;title;url;visits;frecency",
+						Usage: "fields which will be displayed",
+					},
+				},
+			},
+			{
+				Name:  "tag",
+				Usage: "manage tags of all bookmarks",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "ls",
+						Usage:   "list tags with number of bookmarks",
+						Aliases: []string{"list"},
+						Action:  tagListHandler(client),
+					},
+					{
+						Name:      "rename",
+						Usage:     "rename tag on all bookmarks",
+						ArgsUsage: "<OLD> <NEW>",
+						Action:    tagRenameHandler(client),
+					},
+					{
+						Name:      "merge",
+						Usage:     "replace tags with the last one on all bookmarks",
+						ArgsUsage: "<TAG>... <INTO>",
+						Action:    tagMergeHandler(client),
+					},
+					{
+						Name:      "rm",
+						Usage:     "remove tag from all bookmarks",
+						ArgsUsage: "<TAG>",
+						Action:    tagDeleteHandler(client),
+					},
+				},
+			},
+			{
+				Name:    "collection",
+				Usage:   "manage collections of bookmarks",
+				Aliases: []string{"col"},
+				Subcommands: []*cli.Command{
+					{
+						Name:    "ls",
+						Usage:   "list collections",
+						Aliases: []string{"list"},
+						Action:  collectionListHandler(client),
+					},
+					{
+						Name:      "create",
+						Usage:     "create collection with its missing parents",
+						ArgsUsage: "<PATH>",
+						Action:    collectionCreateHandler(client),
+					},
+					{
+						Name:      "mv",
+						Usage:     "rename collection or move it under other parent",
+						ArgsUsage: "<FROM> <TO>",
+						Action:    collectionMoveHandler(client),
+					},
+					{
+						Name:      "rm",
+						Usage:     "delete collection with its descendants and move its bookmarks to the trash",
+						ArgsUsage: "<PATH>",
+						Action:    collectionDeleteHandler(client),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "reassign",
+								Usage: "move bookmarks to this collection instead of the trash",
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:  "trash",
+				Usage: "manage deleted bookmarks",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "ls",
+						Usage:   "list deleted bookmarks",
+						Aliases: []string{"list"},
+						Action:  trashListHandler(client),
+					},
+					{
+						Name:      "restore",
+						Usage:     "move deleted bookmark back from the trash",
+						ArgsUsage: "<ID>",
+						Action:    trashRestoreHandler(client),
+					},
+					{
+						Name:   "empty",
+						Usage:  "permanently delete all bookmarks in the trash",
+						Action: trashEmptyHandler(client),
+					},
+				},
+			},
+			{
+				Name:      "search",
+				Usage:     "search bookmarks",
+				ArgsUsage: "[TEXT]",
+				Action:    searchHandler(client),
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "tag",
+						Usage: "tag which bookmark must have, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "any-tag",
+						Usage: "bookmark must have at least one of these tags, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "bookmarks created at or after given time (RFC 3339 or YYYY-MM-DD)",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "bookmarks created at or before given time (RFC 3339 or YYYY-MM-DD)",
+					},
+					&cli.StringFlag{
+						Name:  "updated-since",
+						Usage: "bookmarks updated at or after given time (RFC 3339 or YYYY-MM-DD)",
+					},
+					&cli.StringFlag{
+						Name:  "updated-until",
+						Usage: "bookmarks updated at or before given time (RFC 3339 or YYYY-MM-DD)",
+					},
+					&cli.StringFlag{
+						Name:  "host",
+						Usage: "host of bookmark URL",
+					},
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "prefix of bookmark URL",
+					},
+					&cli.StringFlag{
+						Name:  "health",
+						Usage: "health of bookmark link: ok, redirected, broken or unchecked",
+					},
+					&cli.StringFlag{
+						Name:  "collection",
+						Usage: "collection of bookmarks, including its descendants",
+					},
+					&cli.StringFlag{
+						Name:  "kind",
+						Usage: "kind of bookmarks, url, cmd or snippet",
+					},
 					&cli.StringFlag{
 						Name:  "fields",
 						Value: "id;title;url;tags;created_at;updated_at",
@@ -113,176 +526,1099 @@ func NewApp() (*cli.App, error) {
 					},
 				},
 			},
+			{
+				Name:      "find",
+				Usage:     "full-text search in bookmarks",
+				Aliases:   []string{"f"},
+				ArgsUsage: "<QUERY>",
+				Action:    findHandler(client),
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "limit",
+						Value: 20,
+						Usage: "maximum number of results",
+					},
+				},
+			},
 		},
-	}, nil
-}
-
-func serveHandler(c *cli.Context) error {
-	//TODO; db string from config
-	db, err := storm.Open("data.db")
-	if err != nil {
-		log.Fatal(err)
 	}
-	defer db.Close()
-	repo := bookmark.NewStore(db)
-	handler := librarianHttp.Handler(context.Background(), repo)
-	if err := http.ListenAndServe(":8080", handler); err != nil {
-		log.Fatal(err)
+	for _, cmd := range app.Commands {
+		if usesBackend(cmd.Name) {
+			withBackend(cmd, client)
+		}
 	}
+	return app, nil
+}
 
-	return nil
+//globalFlags returns flags overriding the configuration, see config.Load.
+func globalFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "config",
+			Usage: "path of the configuration file, by default librarian/config.yaml in XDG config directories",
+		},
+		&cli.StringFlag{
+			Name:  "profile",
+			Usage: "name of the profile from the configuration file",
+		},
+		&cli.StringFlag{
+			Name:  "db",
+			Usage: "path of the database file",
+		},
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "address the server listens on",
+		},
+		&cli.StringFlag{
+			Name:  "server",
+			Usage: "URL of the bookmark endpoint of the server",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "timeout of requests to the server",
+		},
+		&cli.StringFlag{
+			Name:  "backend",
+			Usage: "server, local for the database, or auto for the server when it's reachable (default: auto)",
+		},
+		&cli.StringFlag{
+			Name:  "log-level",
+			Usage: "lowest level of logged server messages: debug, info, warning or error (default: info)",
+		},
+		&cli.StringFlag{
+			Name:  "log-format",
+			Usage: "format of server logs, text or json (default: text)",
+		},
+	}
 }
 
-func getHandler(client *librarianHttp.Client) func(c *cli.Context) error {
+//configure loads the configuration into cfg, with global flags applied on
+//top.
+func configure(cfg *config.Config) func(c *cli.Context) error {
 	return func(c *cli.Context) error {
-		if c.NArg() != 1 {
-			return errors.New("ID argument required")
-		}
-
-		bm, err := client.Get(c.Args().First())
+		loaded, err := config.Load(config.Options{
+			File:    c.String("config"),
+			Profile: c.String("profile"),
+		})
 		if err != nil {
 			return err
 		}
-
-		fmt.Printf(`ID: %d
-Title:     %s
-URL:       %s
-Tags:      %s
-CreateAt:  %s
-UpdatedAt: %s
-Notes:
-	%s
-`, bm.ID, bm.Title, bm.URL, bm.Tags, bm.CreatedAt, bm.UpdatedAt, bm.Notes)
-
+		if c.IsSet("db") {
+			loaded.DB = c.String("db")
+		}
+		if c.IsSet("listen") {
+			loaded.Listen = c.String("listen")
+		}
+		if c.IsSet("server") {
+			loaded.Server = c.String("server")
+		}
+		if c.IsSet("timeout") {
+			loaded.Timeout = c.Duration("timeout")
+		}
+		if c.IsSet("backend") {
+			loaded.Backend = c.String("backend")
+		}
+		if c.IsSet("log-level") {
+			loaded.LogLevel = c.String("log-level")
+		}
+		if c.IsSet("log-format") {
+			loaded.LogFormat = c.String("log-format")
+		}
+		*cfg = *loaded
 		return nil
 	}
 }
 
-func addHandler(client *librarianHttp.Client) func(c *cli.Context) error {
-	return func(c *cli.Context) error {
-		if c.NArg() != 1 {
-			return errors.New("URL argument required")
-		}
+//usesBackend reports whether the command works through the backend. Other
+//commands work on the database themselves.
+func usesBackend(command string) bool {
+	switch command {
+	case "serve", "check", "reindex":
+		return false
+	}
+	return true
+}
 
-		bm, err := client.Add(&bookmark.NewBookmark{
-			Title: c.String("title"),
-			URL:   c.Args().First(),
-			Tags:  strings.Split(c.String("tags"), ";"),
-			Notes: c.String("note"),
-		})
-		if err != nil {
-			return err
+//withBackend opens the backend before actions of the command and its
+//subcommands, see backend.open.
+func withBackend(cmd *cli.Command, client *backend) {
+	if action := cmd.Action; action != nil {
+		cmd.Action = func(c *cli.Context) error {
+			if err := client.open(c.Context); err != nil {
+				return err
+			}
+			return action(c)
 		}
-
-		fmt.Printf(`ID: %d
-Title:     %s
-URL:       %s
-Tags:      %s
-CreateAt:  %s
-UpdatedAt: %s
-Notes:
-	%s
-`, bm.ID, bm.Title, bm.URL, bm.Tags, bm.CreatedAt, bm.UpdatedAt, bm.Notes)
-		return nil
 	}
-
+	for _, sub := range cmd.Subcommands {
+		withBackend(sub, client)
+	}
 }
 
-func updateHandler(client *librarianHttp.Client) func(c *cli.Context) error {
+func serveHandler(cfg *config.Config) func(c *cli.Context) error {
 	return func(c *cli.Context) error {
-		if c.NArg() != 1 {
-			return errors.New("ID argument required")
+		switch format := c.String("snapshot-format"); format {
+		case "", bookmark.SnapshotHTML, bookmark.SnapshotWARC:
+		default:
+			return fmt.Errorf("invalid --snapshot-format value %q", format)
 		}
-		bm, err := client.Update(&bookmark.Bookmark{
-			Title:    c.String("title"),
-			URL:      c.Args().First(),
-			Tags:     strings.Split(c.String("tags"), ";"),
-			Notes:    c.String("note"),
-			Document: ".",
-		})
+		logger, err := newLogger(cfg)
 		if err != nil {
 			return err
 		}
+		db, err := openDB(cfg.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		opts := storeOptions(c)
+		f := fetch.New(
+			fetch.WithTimeout(c.Duration("fetch-timeout")),
+			fetch.WithMaxSize(c.Int64("fetch-max-size")),
+			fetch.WithUserAgent(c.String("user-agent")),
+		)
+		blobs, err := blob.Open(blobPath(cfg))
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, bookmark.WithArchiver(f, blobs))
+		if c.Bool("fetch") {
+			opts = append(opts,
+				bookmark.WithFetcher(f),
+				bookmark.WithMetadataResolver(f),
+				bookmark.WithAutoSnapshot(c.String("snapshot-format")),
+			)
+		}
+		if c.Duration("check-interval") > 0 {
+			opts = append(opts, bookmark.WithLinkChecker(fetch.New(
+				fetch.WithTimeout(c.Duration("fetch-timeout")),
+				fetch.WithUserAgent(c.String("user-agent")),
+			)))
+		}
+		repo := bookmark.NewStore(db, opts...)
+		if c.Bool("fetch") {
+			go func() {
+				if err := repo.RunFetcher(context.Background(), func(id int, err error) {
+					logger.Errorf("Error fetching bookmark %d: %v", id, err)
+				}); err != nil {
+					logger.Errorf("Fetcher stopped: %v", err)
+				}
+			}()
+		}
+		if interval := c.Duration("check-interval"); interval > 0 {
+			go func() {
+				checkOpts := bookmark.CheckOptions{
+					Concurrency:      c.Int("check-concurrency"),
+					RewriteRedirects: c.Bool("rewrite-redirects"),
+				}
+				if err := repo.RunLinkChecker(context.Background(), interval, checkOpts, func(err error) {
+					logger.Errorf("Error checking links: %v", err)
+				}); err != nil {
+					logger.Errorf("Link checker stopped: %v", err)
+				}
+			}()
+		}
+		if retention := c.Duration("trash-retention"); retention > 0 {
+			go func() {
+				if err := repo.RunTrashPurger(context.Background(), retention, func(err error) {
+					logger.Errorf("Error purging trash: %v", err)
+				}); err != nil {
+					logger.Errorf("Trash purger stopped: %v", err)
+				}
+			}()
+		}
+		handler := librarianHttp.Handler(repo, librarianHttp.WithLogger(logger))
+		if err := http.ListenAndServe(cfg.Listen, handler); err != nil {
+			log.Fatal(err)
+		}
 
-		fmt.Printf(`ID: %d
-Title:     %s
-URL:       %s
-Tags:      %s
-CreateAt:  %s
-UpdatedAt: %s
-Notes:
-	%s
-`, bm.ID, bm.Title, bm.URL, bm.Tags, bm.CreatedAt, bm.UpdatedAt, bm.Notes)
 		return nil
 	}
 }
 
-func deleteHandler(client *librarianHttp.Client) func(c *cli.Context) error {
+//newLogger returns logger of the server with configured level and format.
+func newLogger(cfg *config.Config) (*logrus.Logger, error) {
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q", cfg.LogLevel)
+	}
+	logger := logrus.New()
+	logger.SetLevel(level)
+	switch cfg.LogFormat {
+	case "", "text":
+		logger.SetFormatter(&logrus.TextFormatter{})
+	case "json":
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", cfg.LogFormat)
+	}
+	return logger, nil
+}
+
+func snapshotHandler(client *backend) func(c *cli.Context) error {
 	return func(c *cli.Context) error {
 		if c.NArg() != 1 {
 			return errors.New("ID argument required")
 		}
 
-		err := client.Delete(c.Args().First())
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		s, err := client.Snapshot(client.ctx, id, c.String("format"))
 		if err != nil {
 			return err
 		}
+		fmt.Printf("Version: %d\nFormat:  %s\nSize:    %d\nURL:     %s\n", s.Version, s.Format, s.Size, s.URL)
 		return nil
 	}
 }
 
-func listHandler(client *librarianHttp.Client) func(c *cli.Context) error {
+//openSnapshotHandler opens the latest or given version of the snapshot in the
+//browser, or writes it to the output file.
+func openSnapshotHandler(client *backend) func(c *cli.Context) error {
 	return func(c *cli.Context) error {
-		bms, err := client.List()
+		if c.NArg() < 1 || c.NArg() > 2 {
+			return errors.New("ID argument required")
+		}
+		id, err := parseID(c.Args().First())
 		if err != nil {
 			return err
 		}
+		//Zero is the latest version.
+		version := 0
+		if v := c.Args().Get(1); c.NArg() == 2 && v != "latest" {
+			if version, err = strconv.Atoi(v); err != nil || version < 1 {
+				return fmt.Errorf("invalid snapshot version %q", v)
+			}
+		}
+
+		s, rc, err := client.OpenSnapshot(client.ctx, id, version)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		contentType := s.ContentType
+		output := c.String("output")
+		if output == "-" {
+			_, err := io.Copy(os.Stdout, rc)
+			return err
+		}
+		if output == "" && !strings.HasPrefix(contentType, "text/html") {
+			return fmt.Errorf("snapshot of type %q can't be opened in the browser, use --output", contentType)
+		}
+
+		var f *os.File
+		if output == "" {
+			f, err = ioutil.TempFile("", "librarian-snapshot-*.html")
+		} else {
+			f, err = os.Create(output)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, rc); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		if output != "" {
+			return nil
+		}
+		return openBrowser(f.Name())
+	}
+}
+
+//openBrowser opens the file in the default browser of the system.
+func openBrowser(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	return cmd.Start()
+}
+
+func refetchHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		bm, err := client.Refetch(client.ctx, id)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf(`ID: %d
+URL:         %s
+FetchStatus: %s
+FetchedAt:   %s
+`, bm.ID, bm.URL, bm.FetchStatus, bm.FetchedAt)
+		if bm.FetchError != "" {
+			fmt.Printf("FetchError:  %s\n", bm.FetchError)
+		}
+		return nil
+	}
+}
+
+func getHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		bm, err := client.Visit(client.ctx, id)
+		if err != nil {
+			return err
+		}
+		printBookmark(bm)
+		return nil
+	}
+}
+
+//openHandler opens the bookmarked page in the browser. Getting the bookmark
+//records the visit, so it counts to the frecency of the bookmark.
+func openHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		bm, err := client.Visit(client.ctx, id)
+		if err != nil {
+			return err
+		}
+		if bm.URL == "" {
+			printBookmark(bm)
+			return nil
+		}
+		return openBrowser(bm.URL)
+	}
+}
 
-		//TODO: add fields validation
-		fields := c.String("fields")
-		for _, bm := range bms {
-
-			if strings.Contains(fields, "ID") {
-				fmt.Printf("%d\t", bm.ID)
+//printBookmark prints URL of web page, or content of bookmark of other kind.
+func printBookmark(bm *bookmark.Bookmark) {
+	location := "URL:       " + bm.URL
+	if bm.Kind == bookmark.KindCmd || bm.Kind == bookmark.KindSnippet {
+		location = "Content:\n\t" + strings.Replace(bm.Content, "\n", "\n\t", -1)
+	}
+	fmt.Printf(`ID: %d
+Title:     %s
+%s
+Tags:      %s
+CreateAt:  %s
+UpdatedAt: %s
+Notes:
+	%s
+`, bm.ID, bm.Title, location, bm.Tags, bm.CreatedAt, bm.UpdatedAt, bm.Notes)
+}
+
+//runHandler prints the bookmarked shell command and runs it after
+//confirmation.
+func runHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		bm, err := client.Visit(client.ctx, id)
+		if err != nil {
+			return err
+		}
+		if bm.Kind != bookmark.KindCmd {
+			return fmt.Errorf("bookmark %d isn't a shell command", bm.ID)
+		}
+		fmt.Println(bm.Content)
+		if c.Bool("print") {
+			return nil
+		}
+		if !c.Bool("yes") {
+			fmt.Print("Run this command? [y/N] ")
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
 			}
-			if strings.Contains(fields, "title") {
-				fmt.Printf("%s\t", bm.Title)
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				return nil
 			}
-			if strings.Contains(fields, "tags") {
-				fmt.Printf("%s\t", strings.Join(bm.Tags, ","))
+		}
+
+		cmd := exec.Command("sh", "-c", bm.Content)
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", bm.Content)
+		}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		return cmd.Run()
+	}
+}
+
+func addHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		nbm := &bookmark.NewBookmark{
+			Kind:        bookmark.KindURL,
+			Title:       c.String("title"),
+			URL:         c.Args().First(),
+			Tags:        bookmark.NormalizeTags(strings.Split(c.String("tags"), ";")),
+			Collections: bookmark.NormalizeCollections(strings.Split(c.String("collections"), ";")),
+			Notes:       c.String("note"),
+		}
+		switch {
+		case c.IsSet("cmd") && c.IsSet("snippet"):
+			return errors.New("--cmd and --snippet can't be used together")
+		case c.IsSet("cmd"):
+			nbm.Kind, nbm.Content = bookmark.KindCmd, c.String("cmd")
+		case c.IsSet("snippet"):
+			nbm.Kind, nbm.Content = bookmark.KindSnippet, c.String("snippet")
+		}
+		if nbm.Kind == bookmark.KindURL && c.NArg() != 1 {
+			return errors.New("URL argument required")
+		}
+		if nbm.Kind != bookmark.KindURL && c.NArg() != 0 {
+			return fmt.Errorf("URL argument can't be used with --%s", nbm.Kind)
+		}
+
+		bm, err := client.Add(client.ctx, nbm, bookmark.ConflictPolicy(c.String("on-conflict")))
+		if err != nil {
+			return err
+		}
+		printBookmark(bm)
+		return nil
+	}
+
+}
+
+func updateHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		//Only fields explicitly set by the user are sent, so the rest of the
+		//bookmark stays untouched.
+		bm := &bookmark.Bookmark{ID: id}
+		fields := []string{}
+		if c.IsSet("title") {
+			bm.Title = c.String("title")
+			fields = append(fields, "Title")
+		}
+		//Kind decides whether URL or content is kept, so the other one is
+		//cleared.
+		switch {
+		case c.IsSet("cmd") && c.IsSet("snippet"):
+			return errors.New("--cmd and --snippet can't be used together")
+		case c.IsSet("url") && (c.IsSet("cmd") || c.IsSet("snippet")):
+			return errors.New("--url can't be used with --cmd or --snippet")
+		case c.IsSet("url"):
+			bm.Kind, bm.URL = bookmark.KindURL, c.String("url")
+		case c.IsSet("cmd"):
+			bm.Kind, bm.Content = bookmark.KindCmd, c.String("cmd")
+		case c.IsSet("snippet"):
+			bm.Kind, bm.Content = bookmark.KindSnippet, c.String("snippet")
+		}
+		if bm.Kind != "" {
+			fields = append(fields, "Kind", "URL", "Content")
+		}
+		if c.IsSet("tags") {
+			bm.Tags = bookmark.NormalizeTags(strings.Split(c.String("tags"), ";"))
+			fields = append(fields, "Tags")
+		}
+		if c.IsSet("collections") {
+			bm.Collections = bookmark.NormalizeCollections(strings.Split(c.String("collections"), ";"))
+			fields = append(fields, "Collections")
+		}
+		if c.IsSet("note") {
+			bm.Notes = c.String("note")
+			fields = append(fields, "Notes")
+		}
+		if len(fields) == 0 {
+			return errors.New("nothing to update")
+		}
+
+		bm, err = client.Update(client.ctx, bm, fields...)
+		if err != nil {
+			return err
+		}
+		printBookmark(bm)
+		return nil
+	}
+}
+
+func deleteHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		return client.Delete(client.ctx, id)
+	}
+}
+
+//historyHandler prints revisions of the bookmark with old and new values of
+//changed fields.
+func historyHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		revs, err := client.History(client.ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, rev := range revs {
+			author := rev.Author
+			if author == "" {
+				author = "unknown"
+			}
+			fmt.Printf("Revision %d by %s at %s\n", rev.Version, author, rev.CreatedAt.Local().Format(time.RFC3339))
+			for _, ch := range rev.Changes {
+				fmt.Printf("  %s:\n", ch.Field)
+				printDiffLines("-", ch.Old)
+				printDiffLines("+", ch.New)
+			}
+		}
+		return nil
+	}
+}
+
+//printDiffLines prints lines of the field value prefixed with the diff
+//marker. Empty value isn't printed.
+func printDiffLines(marker, value string) {
+	if value == "" {
+		return
+	}
+	for _, line := range strings.Split(value, "\n") {
+		fmt.Printf("    %s %s\n", marker, line)
+	}
+}
+
+func restoreHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		bm, err := client.Restore(client.ctx, id, c.Int("rev"))
+		if err != nil {
+			return err
+		}
+		printBookmark(bm)
+		return nil
+	}
+}
+
+//currentUser returns name of the user running librarian, who is recorded as
+//author of changes.
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func listHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		opts := bookmark.ListOptions{
+			Limit: c.Int("page-size"),
+			Sort:  c.String("sort"),
+			Order: c.String("order"),
+			Kind:  c.String("kind"),
+		}
+		for {
+			bms, next, err := client.List(client.ctx, opts)
+			if err != nil {
+				return err
 			}
-			if strings.Contains(fields, "created_at") {
-				fmt.Printf("%s\t", bm.UpdatedAt)
+			printSummaries(c.String("fields"), bms)
+			if next == "" {
+				return nil
+			}
+			opts.Cursor = next
+		}
+	}
+}
+
+//topHandler lists bookmarks with the highest frecency.
+func topHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		bms, _, err := client.List(client.ctx, bookmark.ListOptions{
+			Limit: c.Int("limit"),
+			Sort:  bookmark.SortFrecency,
+			Order: bookmark.OrderDesc,
+			Kind:  c.String("kind"),
+		})
+		if err != nil {
+			return err
+		}
+		printSummaries(c.String("fields"), bms)
+		return nil
+	}
+}
+
+func tagListHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		tags, err := client.Tags(client.ctx)
+		if err != nil {
+			return err
+		}
+		for _, t := range tags {
+			fmt.Printf("%s\t%d\n", t.Name, t.Count)
+		}
+		return nil
+	}
+}
+
+func tagRenameHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			return errors.New("OLD and NEW arguments required")
+		}
+		n, err := client.RenameTag(client.ctx, c.Args().Get(0), c.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Updated %d bookmarks\n", n)
+		return nil
+	}
+}
+
+func tagMergeHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() < 2 {
+			return errors.New("TAG and INTO arguments required")
+		}
+		args := c.Args().Slice()
+		n, err := client.MergeTags(client.ctx, args[:len(args)-1], args[len(args)-1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Updated %d bookmarks\n", n)
+		return nil
+	}
+}
+
+func tagDeleteHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("TAG argument required")
+		}
+		n, err := client.DeleteTag(client.ctx, c.Args().First())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Updated %d bookmarks\n", n)
+		return nil
+	}
+}
+
+func collectionListHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		cs, err := client.Collections(client.ctx)
+		if err != nil {
+			return err
+		}
+		for _, col := range cs {
+			fmt.Println(col.Path)
+		}
+		return nil
+	}
+}
+
+func collectionCreateHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("PATH argument required")
+		}
+		col, err := client.CreateCollection(client.ctx, c.Args().First())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\n", col.Path)
+		return nil
+	}
+}
+
+func collectionMoveHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 2 {
+			return errors.New("FROM and TO arguments required")
+		}
+		col, err := client.MoveCollection(client.ctx, c.Args().Get(0), c.Args().Get(1))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Moved to %s\n", col.Path)
+		return nil
+	}
+}
+
+func collectionDeleteHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("PATH argument required")
+		}
+		n, err := client.DeleteCollection(client.ctx, c.Args().First(), c.String("reassign"))
+		if err != nil {
+			return err
+		}
+		if c.IsSet("reassign") {
+			fmt.Printf("Reassigned %d bookmarks\n", n)
+			return nil
+		}
+		fmt.Printf("Removed %d bookmarks from the collection\n", n)
+		return nil
+	}
+}
+
+func trashListHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		bms, err := client.Trash(client.ctx)
+		if err != nil {
+			return err
+		}
+		for _, bm := range bms {
+			fmt.Printf("%d\t%s\t%s\n", bm.ID, bm.DeletedAt.Local().Format(time.RFC3339), bm.Title)
+		}
+		return nil
+	}
+}
+
+func trashRestoreHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("ID argument required")
+		}
+		id, err := parseID(c.Args().First())
+		if err != nil {
+			return err
+		}
+		bm, err := client.RestoreFromTrash(client.ctx, id)
+		if err != nil {
+			return err
+		}
+		printBookmark(bm)
+		return nil
+	}
+}
+
+func trashEmptyHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		n, err := client.EmptyTrash(client.ctx, time.Now())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Purged %d bookmarks\n", n)
+		return nil
+	}
+}
+
+func searchHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		q := bookmark.Query{
+			AllTags:    c.StringSlice("tag"),
+			AnyTags:    c.StringSlice("any-tag"),
+			Host:       c.String("host"),
+			URLPrefix:  c.String("prefix"),
+			Text:       strings.Join(c.Args().Slice(), " "),
+			Health:     c.String("health"),
+			Kind:       c.String("kind"),
+			Collection: c.String("collection"),
+		}
+		times := []struct {
+			flag string
+			dst  *time.Time
+		}{
+			{"since", &q.CreatedAfter},
+			{"until", &q.CreatedBefore},
+			{"updated-since", &q.UpdatedAfter},
+			{"updated-until", &q.UpdatedBefore},
+		}
+		for _, t := range times {
+			if !c.IsSet(t.flag) {
+				continue
 			}
-			if strings.Contains(fields, "updated_at") {
-				fmt.Printf("%s", bm.CreatedAt)
+			parsed, err := librarianHttp.ParseTime(c.String(t.flag))
+			if err != nil {
+				return fmt.Errorf("invalid --%s value: %w", t.flag, err)
 			}
-			if strings.Contains(fields, "url") {
-				fmt.Printf("%s\t", bm.URL)
+			*t.dst = parsed
+		}
+
+		bms, err := client.Query(client.ctx, q)
+		if err != nil {
+			return err
+		}
+		printSummaries(c.String("fields"), bms)
+		return nil
+	}
+}
+
+func findHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() == 0 {
+			return errors.New("QUERY argument required")
+		}
+
+		hits, err := client.Search(client.ctx, strings.Join(c.Args().Slice(), " "), c.Int("limit"))
+		if err != nil {
+			return err
+		}
+		for _, hit := range hits {
+			fmt.Printf("%d\t%.2f\t%s\t%s\n", hit.Bookmark.ID, hit.Score, hit.Bookmark.Title, hit.Bookmark.URL)
+			for _, field := range []string{"title", "tag", "notes", "document"} {
+				if h, ok := hit.Highlights[field]; ok {
+					fmt.Printf("\t%s: %s\n", field, html.UnescapeString(highlightRe.ReplaceAllString(h, "*")))
+				}
 			}
-			fmt.Printf("\n")
 		}
 		return nil
 	}
 }
 
-func importCSVHandler(c *cli.Context) error {
-	if c.NArg() != 1 {
-		return errors.New("URL argument required")
+func printSummaries(fields string, bms []*bookmark.BookmarkSummary) {
+	//TODO: add fields validation
+	for _, bm := range bms {
+		if strings.Contains(fields, "id") {
+			fmt.Printf("%d\t", bm.ID)
+		}
+		if strings.Contains(fields, "title") {
+			fmt.Printf("%s\t", bm.Title)
+		}
+		if strings.Contains(fields, "tags") {
+			fmt.Printf("%s\t", strings.Join(bm.Tags, ","))
+		}
+		if strings.Contains(fields, "collections") {
+			fmt.Printf("%s\t", strings.Join(bm.Collections, ","))
+		}
+		if strings.Contains(fields, "created_at") {
+			fmt.Printf("%s\t", bm.CreatedAt)
+		}
+		if strings.Contains(fields, "updated_at") {
+			fmt.Printf("%s\t", bm.UpdatedAt)
+		}
+		if strings.Contains(fields, "url") {
+			fmt.Printf("%s\t", bm.URL)
+		}
+		if strings.Contains(fields, "kind") {
+			fmt.Printf("%s\t", bm.Kind)
+		}
+		if strings.Contains(fields, "health") {
+			fmt.Printf("%s\t", bm.Health)
+		}
+		if strings.Contains(fields, "visits") {
+			fmt.Printf("%d\t", bm.Visits)
+		}
+		if strings.Contains(fields, "frecency") {
+			fmt.Printf("%.2f\t", bm.Frecency)
+		}
+		fmt.Printf("\n")
 	}
-	//TODO; db string from config
-	db, err := storm.Open("data.db")
-	if err != nil {
-		log.Fatal(err)
+}
+
+func reindexHandler(cfg *config.Config) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		db, err := openDB(cfg.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		repo := bookmark.NewStore(db, storeOptions(c)...)
+		return repo.Reindex(context.Background())
 	}
-	defer db.Close()
-	repo := bookmark.NewStore(db)
+}
 
-	fPath := c.Args().First()
-	f, err := os.Open(fPath)
-	if err != nil {
+func checkHandler(cfg *config.Config) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		db, err := openDB(cfg.DB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+		checker := fetch.New(
+			fetch.WithTimeout(c.Duration("timeout")),
+			fetch.WithUserAgent(c.String("user-agent")),
+		)
+		repo := bookmark.NewStore(db, append(storeOptions(c), bookmark.WithLinkChecker(checker))...)
+		report, err := repo.CheckLinks(context.Background(), bookmark.CheckOptions{
+			Concurrency:      c.Int("concurrency"),
+			RewriteRedirects: c.Bool("rewrite-redirects"),
+		})
+		if report != nil {
+			fmt.Printf(
+				"checked: %d, ok: %d, redirected: %d, broken: %d, rewritten: %d\n",
+				report.Checked, report.OK, report.Redirected, report.Broken, report.Rewritten,
+			)
+		}
 		return err
 	}
-	defer f.Close()
-	return repo.ImportCSV(context.Background(), f)
+}
+
+//exportHandler writes bookmarks to the file given as argument, or to the
+//standard output.
+func exportHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		format, err := fileFormat(c.String("format"), c.Args().First())
+		if err != nil {
+			return err
+		}
+		export := client.ExportCSV
+		if format == formatHTML {
+			export = client.ExportHTML
+		}
+
+		if c.NArg() == 0 {
+			return export(client.ctx, os.Stdout)
+		}
+		f, err := os.Create(c.Args().First())
+		if err != nil {
+			return err
+		}
+		if err := export(client.ctx, f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+}
+
+func importHandler(client *backend) func(c *cli.Context) error {
+	return func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("FILE argument required")
+		}
+		fPath := c.Args().First()
+		format, err := fileFormat(c.String("format"), fPath)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Open(fPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		importFile := client.ImportCSV
+		if format == formatHTML {
+			importFile = client.ImportHTML
+		}
+		report, err := importFile(
+			client.ctx,
+			f,
+			bookmark.ImportOptions{
+				Mode:     bookmark.ImportMode(c.String("mode")),
+				Conflict: bookmark.ConflictPolicy(c.String("on-conflict")),
+			},
+		)
+		if report != nil {
+			printImportReport(report)
+		}
+		return err
+	}
+}
+
+//printImportReport prints summary of the import followed by rows which
+//weren't imported.
+func printImportReport(report *bookmark.ImportReport) {
+	fmt.Printf(
+		"mode: %s, committed: %t, inserted: %d, updated: %d, skipped: %d, duplicates: %d, invalid: %d\n",
+		report.Mode, report.Committed, len(report.Inserted), len(report.Updated),
+		len(report.Skipped), len(report.Duplicates), len(report.Invalid),
+	)
+	for _, rows := range []struct {
+		kind string
+		rows []bookmark.ImportRow
+	}{
+		{"skipped", report.Skipped},
+		{"duplicate", report.Duplicates},
+		{"invalid", report.Invalid},
+	} {
+		for _, row := range rows.rows {
+			fmt.Printf("line %d: %s %s: %s\n", row.Line, rows.kind, row.URL, row.Error)
+		}
+	}
+}
+
+//rewriteRedirectsFlag returns flag which enables rewriting URLs of permanently
+//redirected bookmarks.
+func rewriteRedirectsFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "rewrite-redirects",
+		Usage: "replace URL of permanently redirected bookmarks by the redirect target",
+	}
+}
+
+//trackingParamFlag returns flag of query parameters removed from canonical
+//URLs of bookmarks.
+func trackingParamFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:  "tracking-param",
+		Value: cli.NewStringSlice(bookmark.DefaultTrackingParams...),
+		Usage: "query parameter removed from canonical URLs, \"*\" suffix matches prefix, can be repeated",
+	}
+}
+
+func storeOptions(c *cli.Context) []bookmark.StoreOption {
+	return []bookmark.StoreOption{
+		bookmark.WithTrackingParams(c.StringSlice("tracking-param")...),
+	}
+}
+
+const (
+	formatCSV  = "csv"
+	formatHTML = "html"
+)
+
+//fileFormat returns format given by flag, or detected from extension of the
+//file path.
+func fileFormat(flag, fPath string) (string, error) {
+	switch strings.ToLower(flag) {
+	case formatCSV, formatHTML:
+		return strings.ToLower(flag), nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown format %q", flag)
+	}
+	switch strings.ToLower(filepath.Ext(fPath)) {
+	case ".html", ".htm":
+		return formatHTML, nil
+	}
+	return formatCSV, nil
 }
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/akruszewski/librarian/bookmark"
+	"github.com/akruszewski/librarian/config"
+	"github.com/asdine/storm/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_UpdateCanChangeContentAndKind(t *testing.T) {
+	withTestConfig(func(cfg *config.Config) {
+		r := require.New(t)
+
+		run := func(args ...string) error {
+			app, err := NewApp()
+			r.NoError(err)
+			return app.Run(append([]string{"librarian", "--db", cfg.DB, "--backend", backendLocal}, args...))
+		}
+		get := func(id int) *bookmark.Bookmark {
+			db, err := storm.Open(cfg.DB)
+			r.NoError(err)
+			defer db.Close()
+			bm, err := bookmark.NewStore(db).Get(context.Background(), id)
+			r.NoError(err)
+			return bm
+		}
+
+		r.NoError(run("add", "--title", "pods", "--cmd", "kubectl get pods"))
+		r.NoError(run("update", "--cmd", "kubectl get pods -A", "1"))
+		bm := get(1)
+		r.Equal(bookmark.KindCmd, bm.Kind)
+		r.Equal("kubectl get pods -A", bm.Content)
+
+		r.NoError(run("update", "--snippet", "Pods of all namespaces", "1"))
+		bm = get(1)
+		r.Equal(bookmark.KindSnippet, bm.Kind)
+		r.Equal("Pods of all namespaces", bm.Content)
+
+		r.NoError(run("update", "--url", "https://kubernetes.io", "1"))
+		bm = get(1)
+		r.Equal(bookmark.KindURL, bm.Kind)
+		r.Equal("https://kubernetes.io", bm.URL)
+		r.Empty(bm.Content)
+
+		r.NoError(run("update", "--cmd", "kubectl get pods", "1"))
+		bm = get(1)
+		r.Equal(bookmark.KindCmd, bm.Kind)
+		r.Equal("kubectl get pods", bm.Content)
+		r.Empty(bm.URL)
+
+		r.Error(run("update", "--cmd", "ls", "--snippet", "ls", "1"))
+		r.Error(run("update", "--cmd", "ls", "--url", "https://ls.com", "1"))
+		err := run("update", "--cmd", "", "1")
+		var invErr *bookmark.ErrInvalidBookmark
+		r.True(errors.As(err, &invErr), err)
+		r.Equal("kubectl get pods", get(1).Content)
+	})
+}
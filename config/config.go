@@ -0,0 +1,253 @@
+//Package config loads configuration of librarian. Settings are layered:
+//defaults are overridden by the configuration file, then by the selected
+//profile, then by LIBRARIAN_* environment variables. Command line flags are
+//applied on top by the caller.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	//DefaultDB is the default path of the database file.
+	DefaultDB = "data.db"
+	//DefaultListen is the default address of the server.
+	DefaultListen = ":8080"
+	//DefaultServer is the default URL of the bookmark endpoint used by the
+	//client.
+	DefaultServer = "http://127.0.0.1:8080/bookmark"
+	//DefaultTimeout is the default timeout of client requests.
+	DefaultTimeout = 10 * time.Second
+	//DefaultBackend is the default backend of commands.
+	DefaultBackend = "auto"
+	//DefaultLogLevel is the default level of server logs.
+	DefaultLogLevel = "info"
+	//DefaultLogFormat is the default format of server logs.
+	DefaultLogFormat = "text"
+)
+
+//fileName is the name of the configuration file in librarian directory of
+//XDG config directories.
+const fileName = "config.yaml"
+
+//Environment variables overriding the configuration.
+const (
+	EnvConfig  = "LIBRARIAN_CONFIG"
+	EnvProfile = "LIBRARIAN_PROFILE"
+	EnvDB      = "LIBRARIAN_DB"
+	EnvListen  = "LIBRARIAN_LISTEN"
+	EnvServer  = "LIBRARIAN_SERVER"
+	EnvTimeout = "LIBRARIAN_TIMEOUT"
+	EnvBackend = "LIBRARIAN_BACKEND"
+
+	EnvLogLevel  = "LIBRARIAN_LOG_LEVEL"
+	EnvLogFormat = "LIBRARIAN_LOG_FORMAT"
+)
+
+//ErrUnknownProfile is returned when selected profile isn't defined in the
+//configuration file.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+//Config is the configuration of librarian, read from YAML file like:
+//
+//	db: /var/lib/librarian/data.db
+//	listen: :8080
+//	log_level: debug
+//	log_format: json
+//	profile: home
+//	profiles:
+//	  home:
+//	    server: http://127.0.0.1:8080/bookmark
+//	  work:
+//	    server: https://librarian.example.com/bookmark
+//	    timeout: 30s
+type Config struct {
+	//DB is the path of the database file, used by the server and commands
+	//which open the database directly.
+	DB string `yaml:"db"`
+	//Listen is the address the server listens on.
+	Listen string `yaml:"listen"`
+	//Server is the URL of the bookmark endpoint used by the client.
+	Server string `yaml:"server"`
+	//Timeout is the timeout of client requests.
+	Timeout time.Duration `yaml:"timeout"`
+	//Backend of commands is "server", "local" for the database, or "auto"
+	//for the server when it's reachable and the database otherwise.
+	Backend string `yaml:"backend"`
+	//LogLevel is the lowest level of logged server messages, e.g. "debug",
+	//"info" or "warning".
+	LogLevel string `yaml:"log_level"`
+	//LogFormat of server logs is "text" or "json".
+	LogFormat string `yaml:"log_format"`
+	//Profile is the name of the profile used when none is selected by flag
+	//or environment variable.
+	Profile string `yaml:"profile"`
+	//Profiles override client settings, so one client can talk to several
+	//servers.
+	Profiles map[string]Profile `yaml:"profiles"`
+	//File is the path of the loaded configuration file, empty when none was
+	//found.
+	File string `yaml:"-"`
+}
+
+//Profile holds client settings, empty ones are taken from the Config.
+type Profile struct {
+	Server  string        `yaml:"server"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+//Options select configuration file and profile, usually from command line
+//flags. Empty options fall back to environment variables.
+type Options struct {
+	//File is the path of the configuration file. When it's empty, the file
+	//is looked up in XDG config directories, see Find.
+	File string
+	//Profile is the name of the selected profile.
+	Profile string
+}
+
+//Default returns configuration with default settings.
+func Default() *Config {
+	return &Config{
+		DB:        DefaultDB,
+		Listen:    DefaultListen,
+		Server:    DefaultServer,
+		Timeout:   DefaultTimeout,
+		Backend:   DefaultBackend,
+		LogLevel:  DefaultLogLevel,
+		LogFormat: DefaultLogFormat,
+	}
+}
+
+//Load returns default configuration overridden by the configuration file,
+//the selected profile and environment variables.
+func Load(opts Options) (*Config, error) {
+	c := Default()
+	file := opts.File
+	if file == "" {
+		file = os.Getenv(EnvConfig)
+	}
+	if file == "" {
+		file = Find()
+	}
+	if file != "" {
+		if err := c.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	profile := opts.Profile
+	if profile == "" {
+		profile = os.Getenv(EnvProfile)
+	}
+	if profile == "" {
+		profile = c.Profile
+	}
+	if profile != "" {
+		if err := c.apply(profile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.readEnv(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+//Find returns path of the first configuration file found in XDG config
+//directories, $XDG_CONFIG_HOME and $XDG_CONFIG_DIRS, or empty string.
+func Find() string {
+	for _, dir := range configDirs() {
+		path := filepath.Join(dir, "librarian", fileName)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+//configDirs returns XDG config directories in the order of preference.
+func configDirs() []string {
+	dirs := []string{}
+	if home := os.Getenv("XDG_CONFIG_HOME"); home != "" {
+		dirs = append(dirs, home)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config"))
+	}
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	for _, dir := range filepath.SplitList(configDirs) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+//readFile overrides settings with ones set in the file. Unknown keys are
+//reported, so typos don't go unnoticed.
+func (c *Config) readFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("invalid configuration file %s: %v", path, err)
+	}
+	c.File = path
+	return nil
+}
+
+//apply overrides client settings with ones set in the profile.
+func (c *Config) apply(name string) error {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	c.Profile = name
+	if p.Server != "" {
+		c.Server = p.Server
+	}
+	if p.Timeout != 0 {
+		c.Timeout = p.Timeout
+	}
+	return nil
+}
+
+//readEnv overrides settings with environment variables which are set.
+func (c *Config) readEnv() error {
+	for _, v := range []struct {
+		name  string
+		value *string
+	}{
+		{EnvDB, &c.DB},
+		{EnvListen, &c.Listen},
+		{EnvServer, &c.Server},
+		{EnvBackend, &c.Backend},
+		{EnvLogLevel, &c.LogLevel},
+		{EnvLogFormat, &c.LogFormat},
+	} {
+		if s := os.Getenv(v.name); s != "" {
+			*v.value = s
+		}
+	}
+	if s := strings.TrimSpace(os.Getenv(EnvTimeout)); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", EnvTimeout, err)
+		}
+		c.Timeout = d
+	}
+	return nil
+}
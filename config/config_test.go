@@ -0,0 +1,112 @@
+package config_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akruszewski/librarian/config"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+db: /var/lib/librarian/data.db
+server: http://home:8080/bookmark
+log_format: json
+profile: home
+profiles:
+  home:
+    timeout: 5s
+  work:
+    server: https://work/bookmark
+    timeout: 30s
+`
+
+func Test_LoadLayersConfiguration(t *testing.T) {
+	withTestConfigDir(func(dir string) {
+		r := require.New(t)
+
+		c, err := config.Load(config.Options{})
+		r.NoError(err)
+		r.Equal(config.Default(), c)
+
+		path := filepath.Join(dir, "librarian", "config.yaml")
+		r.NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		r.NoError(ioutil.WriteFile(path, []byte(testConfig), 0644))
+
+		c, err = config.Load(config.Options{})
+		r.NoError(err)
+		r.Equal(path, c.File)
+		r.Equal("/var/lib/librarian/data.db", c.DB)
+		r.Equal(config.DefaultListen, c.Listen)
+		r.Equal("http://home:8080/bookmark", c.Server)
+		r.Equal(5*time.Second, c.Timeout)
+		r.Equal(config.DefaultLogLevel, c.LogLevel)
+		r.Equal("json", c.LogFormat)
+
+		c, err = config.Load(config.Options{Profile: "work"})
+		r.NoError(err)
+		r.Equal("work", c.Profile)
+		r.Equal("https://work/bookmark", c.Server)
+		r.Equal(30*time.Second, c.Timeout)
+
+		//Environment variables override the file and the profile.
+		os.Setenv(config.EnvServer, "http://env/bookmark")
+		os.Setenv(config.EnvTimeout, "1m")
+		os.Setenv(config.EnvBackend, "local")
+		os.Setenv(config.EnvLogLevel, "debug")
+		defer os.Unsetenv(config.EnvServer)
+		defer os.Unsetenv(config.EnvTimeout)
+		defer os.Unsetenv(config.EnvBackend)
+		defer os.Unsetenv(config.EnvLogLevel)
+		c, err = config.Load(config.Options{Profile: "work"})
+		r.NoError(err)
+		r.Equal("http://env/bookmark", c.Server)
+		r.Equal(time.Minute, c.Timeout)
+		r.Equal("local", c.Backend)
+		r.Equal("debug", c.LogLevel)
+
+		os.Setenv(config.EnvTimeout, "soon")
+		_, err = config.Load(config.Options{})
+		r.Error(err)
+
+		_, err = config.Load(config.Options{Profile: "missing"})
+		r.True(errors.Is(err, config.ErrUnknownProfile))
+	})
+}
+
+func Test_LoadRejectsUnknownKeys(t *testing.T) {
+	withTestConfigDir(func(dir string) {
+		r := require.New(t)
+
+		path := filepath.Join(dir, "custom.yaml")
+		r.NoError(ioutil.WriteFile(path, []byte("servr: http://typo/bookmark\n"), 0644))
+		_, err := config.Load(config.Options{File: path})
+		r.Error(err)
+
+		_, err = config.Load(config.Options{File: filepath.Join(dir, "missing.yaml")})
+		r.Error(err)
+	})
+}
+
+//withTestConfigDir calls f with empty XDG config home directory.
+func withTestConfigDir(f func(dir string)) {
+	dir, err := ioutil.TempDir("", "librarian_config_*")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, env := range []string{"XDG_CONFIG_HOME", "XDG_CONFIG_DIRS"} {
+		old, ok := os.LookupEnv(env)
+		os.Setenv(env, dir)
+		if ok {
+			defer os.Setenv(env, old)
+		} else {
+			defer os.Unsetenv(env)
+		}
+	}
+	f(dir)
+}
@@ -0,0 +1,165 @@
+package fetch
+
+import (
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//skipped are elements which never contain readable text of the page.
+var skipped = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Nav:      true,
+	atom.Aside:    true,
+	atom.Form:     true,
+	atom.Button:   true,
+	atom.Select:   true,
+	atom.Textarea: true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Embed:    true,
+	atom.Canvas:   true,
+	atom.Svg:      true,
+	atom.Menu:     true,
+}
+
+//skippedRoles are ARIA roles of navigation and other boilerplate.
+var skippedRoles = map[string]bool{
+	"navigation":    true,
+	"banner":        true,
+	"contentinfo":   true,
+	"complementary": true,
+	"search":        true,
+	"menu":          true,
+	"menubar":       true,
+	"dialog":        true,
+}
+
+//blocks are elements which separate paragraphs of the text.
+var blocks = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true,
+	atom.Br: true, atom.Dd: true, atom.Details: true, atom.Div: true,
+	atom.Dl: true, atom.Dt: true, atom.Figcaption: true, atom.Figure: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true,
+	atom.H6: true, atom.Header: true, atom.Footer: true, atom.Hr: true,
+	atom.Li: true, atom.Main: true, atom.Ol: true, atom.P: true,
+	atom.Pre: true, atom.Section: true, atom.Table: true, atom.Td: true,
+	atom.Th: true, atom.Tr: true, atom.Ul: true,
+}
+
+//ExtractText returns readable text of the HTML document, one paragraph per
+//line. When the document has <article> or <main> element, only its text is
+//returned. Scripts, styles, navigation, forms and other boilerplate are
+//skipped, as well as header and footer of the page.
+func ExtractText(r io.Reader) (string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+	root := findContent(doc)
+	e := &extractor{
+		//Header of the article usually holds its title, while header of
+		//the page is a boilerplate.
+		skipHeaders: root.DataAtom != atom.Article && root.DataAtom != atom.Main,
+	}
+	e.walk(root)
+	e.flush()
+	return strings.Join(e.paragraphs, "\n"), nil
+}
+
+//findContent returns the main content element of the document.
+func findContent(doc *html.Node) *html.Node {
+	for _, a := range []atom.Atom{atom.Article, atom.Main} {
+		if n := find(doc, func(n *html.Node) bool { return n.DataAtom == a }); n != nil {
+			return n
+		}
+	}
+	if n := find(doc, func(n *html.Node) bool { return attr(n, "role") == "main" }); n != nil {
+		return n
+	}
+	if n := find(doc, func(n *html.Node) bool { return n.DataAtom == atom.Body }); n != nil {
+		return n
+	}
+	return doc
+}
+
+//find returns the first element matching f in depth-first order.
+func find(n *html.Node, f func(n *html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && f(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, f); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+type extractor struct {
+	skipHeaders bool
+	paragraphs  []string
+	//current is the text of the current paragraph.
+	current strings.Builder
+}
+
+func (e *extractor) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		e.current.WriteString(n.Data)
+		return
+	case html.ElementNode:
+		if e.isBoilerplate(n) {
+			return
+		}
+	}
+	block := n.Type == html.ElementNode && blocks[n.DataAtom]
+	if block {
+		e.flush()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		e.walk(c)
+	}
+	if block {
+		e.flush()
+	}
+}
+
+func (e *extractor) isBoilerplate(n *html.Node) bool {
+	if skipped[n.DataAtom] || skippedRoles[attr(n, "role")] {
+		return true
+	}
+	if e.skipHeaders && (n.DataAtom == atom.Header || n.DataAtom == atom.Footer) {
+		return true
+	}
+	for _, a := range n.Attr {
+		if a.Key == "hidden" || (a.Key == "aria-hidden" && a.Val == "true") {
+			return true
+		}
+	}
+	return false
+}
+
+//flush ends the current paragraph, collapsing its white space.
+func (e *extractor) flush() {
+	p := strings.Join(strings.Fields(e.current.String()), " ")
+	e.current.Reset()
+	if p != "" {
+		e.paragraphs = append(e.paragraphs, p)
+	}
+}
@@ -0,0 +1,216 @@
+//Package fetch downloads bookmarked pages and extracts their readable text.
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/akruszewski/librarian/bookmark"
+	"golang.org/x/net/html/charset"
+)
+
+//Default configuration of Fetcher.
+const (
+	DefaultTimeout   = 30 * time.Second
+	DefaultMaxSize   = 5 << 20
+	DefaultUserAgent = "librarian/0.1 (+https://github.com/akruszewski/librarian)"
+
+	//DefaultMaxResources is the maximum number of resources inlined in HTML
+	//snapshot.
+	DefaultMaxResources = 100
+	//DefaultMaxResourceSize is the maximum size of inlined resource.
+	DefaultMaxResourceSize = 1 << 20
+	//DefaultMaxResourcesSize is the maximum size of all inlined resources.
+	DefaultMaxResourcesSize = 10 << 20
+)
+
+var (
+	//ErrTooLarge is returned when page is bigger than the size limit.
+	ErrTooLarge = errors.New("page is too large")
+	//ErrUnsupportedContentType is returned for pages which aren't HTML or
+	//plain text.
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+)
+
+//Fetcher downloads pages over HTTP, it implements bookmark.Fetcher,
+//bookmark.MetadataResolver, bookmark.LinkChecker and bookmark.Archiver.
+type Fetcher struct {
+	client    *http.Client
+	userAgent string
+	maxSize   int64
+
+	//Limits of resources inlined in HTML snapshots, see WithResourceLimits.
+	maxResources     int
+	maxResourceSize  int64
+	maxResourcesSize int64
+}
+
+//Option configures Fetcher.
+type Option func(*Fetcher)
+
+//WithTimeout sets time limit of the whole download, including redirects.
+func WithTimeout(d time.Duration) Option {
+	return func(f *Fetcher) {
+		f.client.Timeout = d
+	}
+}
+
+//WithMaxSize sets maximum size of the page body in bytes.
+func WithMaxSize(n int64) Option {
+	return func(f *Fetcher) {
+		f.maxSize = n
+	}
+}
+
+//WithResourceLimits sets the maximum number of resources inlined in HTML
+//snapshot, maximum size of each of them and of all of them in bytes.
+//Resources over the limits are referenced by absolute URLs.
+func WithResourceLimits(count int, size, total int64) Option {
+	return func(f *Fetcher) {
+		f.maxResources = count
+		f.maxResourceSize = size
+		f.maxResourcesSize = total
+	}
+}
+
+//WithTransport sets transport of the HTTP client, which makes requests to the
+//web.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(f *Fetcher) {
+		f.client.Transport = rt
+	}
+}
+
+//WithUserAgent sets User-Agent header of requests.
+func WithUserAgent(ua string) Option {
+	return func(f *Fetcher) {
+		f.userAgent = ua
+	}
+}
+
+//New returns Fetcher with default configuration changed by options.
+func New(opts ...Option) *Fetcher {
+	f := &Fetcher{
+		client:    &http.Client{Timeout: DefaultTimeout},
+		userAgent: DefaultUserAgent,
+		maxSize:   DefaultMaxSize,
+
+		maxResources:     DefaultMaxResources,
+		maxResourceSize:  DefaultMaxResourceSize,
+		maxResourcesSize: DefaultMaxResourcesSize,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+//Fetch downloads the page and extracts its readable text.
+func (f *Fetcher) Fetch(ctx context.Context, url string) (*bookmark.Page, error) {
+	resp, err := f.download(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	page := &bookmark.Page{URL: resp.url.String()}
+	r, err := resp.reader()
+	if err != nil {
+		return nil, err
+	}
+	switch resp.mediaType {
+	case "text/html", "application/xhtml+xml":
+		if page.Text, err = ExtractText(r); err != nil {
+			return nil, err
+		}
+	case "text/plain":
+		text, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		page.Text = strings.TrimSpace(string(text))
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedContentType, resp.mediaType)
+	}
+	return page, nil
+}
+
+//response is the downloaded page.
+type response struct {
+	//url of the page after redirects.
+	url *neturl.URL
+	//proto and status form the status line of the response.
+	proto       string
+	status      string
+	header      http.Header
+	contentType string
+	mediaType   string
+	body        []byte
+}
+
+//reader returns body of the page decoded to UTF-8.
+func (r *response) reader() (io.Reader, error) {
+	return charset.NewReader(bytes.NewReader(r.body), r.contentType)
+}
+
+//download gets the page, respecting size limit of the fetcher.
+func (f *Fetcher) download(ctx context.Context, url string) (*response, error) {
+	return f.downloadMax(ctx, url, f.maxSize)
+}
+
+//downloadMax gets the page which isn't bigger than maxSize.
+func (f *Fetcher) downloadMax(ctx context.Context, url string, maxSize int64) (*response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got unexpected status: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil && contentType != "" {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedContentType, contentType)
+	}
+	//Body is read up to the limit, one more byte tells whether it's bigger.
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, ErrTooLarge
+	}
+	if mediaType == "" {
+		contentType = http.DetectContentType(body)
+		mediaType, _, _ = mime.ParseMediaType(contentType)
+	}
+	return &response{
+		url:         resp.Request.URL,
+		proto:       resp.Proto,
+		status:      resp.Status,
+		header:      resp.Header,
+		contentType: contentType,
+		mediaType:   mediaType,
+		body:        body,
+	}, nil
+}
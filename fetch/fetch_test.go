@@ -0,0 +1,376 @@
+package fetch_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akruszewski/librarian/bookmark"
+	"github.com/akruszewski/librarian/fetch"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ExtractTextSkipsBoilerplate(t *testing.T) {
+	r := require.New(t)
+
+	text, err := fetch.ExtractText(strings.NewReader(`<!DOCTYPE html>
+<html>
+<head><title>Title</title><style>p { color: red; }</style></head>
+<body>
+	<header>Site name</header>
+	<nav><a href="/">Home</a></nav>
+	<h1>Heading</h1>
+	<p>First <b>bold</b>
+	paragraph.</p>
+	<script>alert("x")</script>
+	<div role="navigation">Links</div>
+	<p hidden>Hidden</p>
+	<ul><li>one</li><li>two</li></ul>
+	<form><input name="q"><button>Search</button></form>
+	<footer>Copyright</footer>
+</body>
+</html>`))
+	r.NoError(err)
+	r.Equal("Heading\nFirst bold paragraph.\none\ntwo", text)
+}
+
+func Test_ExtractTextPrefersArticle(t *testing.T) {
+	r := require.New(t)
+
+	text, err := fetch.ExtractText(strings.NewReader(`<html><body>
+	<div>Sidebar</div>
+	<article><header><h1>Article</h1></header><p>Content.</p><aside>Ad</aside></article>
+</body></html>`))
+	r.NoError(err)
+	r.Equal("Article\nContent.", text)
+}
+
+func Test_FetchDownloadsPageText(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			if r.Header.Get("User-Agent") != "test-agent" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+			//"Zürich" in ISO-8859-1.
+			fmt.Fprint(w, "<html><body><p>Z\xfcrich</p></body></html>")
+		case "/redirect":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/text":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, "  plain text\n")
+		}
+	}))
+	defer ts.Close()
+
+	r := require.New(t)
+	f := fetch.New(fetch.WithUserAgent("test-agent"))
+
+	page, err := f.Fetch(context.Background(), ts.URL+"/redirect")
+	r.NoError(err)
+	r.Equal(ts.URL+"/page", page.URL)
+	r.Equal("Zürich", page.Text)
+
+	page, err = f.Fetch(context.Background(), ts.URL+"/text")
+	r.NoError(err)
+	r.Equal("plain text", page.Text)
+
+	_, err = fetch.New().Fetch(context.Background(), ts.URL+"/page")
+	r.Error(err)
+	r.Contains(err.Error(), "403")
+}
+
+func Test_FetchFailsOnLimits(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			//Chunked response has no Content-Length, so the size is
+			//checked while reading.
+			w.Header().Set("Content-Type", "text/plain")
+			for i := 0; i < 10; i++ {
+				fmt.Fprint(w, strings.Repeat("x", 100))
+				w.(http.Flusher).Flush()
+			}
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+			fmt.Fprint(w, "slow")
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "\x89PNG")
+		}
+	}))
+	defer ts.Close()
+
+	r := require.New(t)
+	ctx := context.Background()
+
+	_, err := fetch.New(fetch.WithMaxSize(500)).Fetch(ctx, ts.URL+"/large")
+	r.True(errors.Is(err, fetch.ErrTooLarge))
+	_, err = fetch.New(fetch.WithMaxSize(1000)).Fetch(ctx, ts.URL+"/large")
+	r.NoError(err)
+
+	_, err = fetch.New(fetch.WithTimeout(50*time.Millisecond)).Fetch(ctx, ts.URL+"/slow")
+	r.Error(err)
+
+	_, err = fetch.New().Fetch(ctx, ts.URL+"/image")
+	r.True(errors.Is(err, fetch.ErrUnsupportedContentType))
+}
+
+//transport serves responses of an offline web.
+type transport map[string]*http.Response
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, ok := t[req.URL.String()]
+	if !ok {
+		return nil, fmt.Errorf("no route to %s", req.URL)
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+func htmlResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func Test_ResolveMetadata(t *testing.T) {
+	f := fetch.New(fetch.WithTransport(transport{
+		"https://example.com/og": htmlResponse(`<html><head>
+	<title>Plain title</title>
+	<meta property="og:title" content="  OpenGraph
+		title ">
+	<meta name="twitter:title" content="Twitter title">
+	<meta name="description" content="Description.">
+	<meta name="twitter:description" content="Twitter description.">
+	<link rel="canonical" href="/canonical">
+	<link rel="shortcut icon" href="//cdn.example.com/icon.png">
+</head><body><svg><title>Image</title></svg></body></html>`),
+		"https://example.com/plain": htmlResponse(`<html><head>
+	<title>Plain title</title>
+	<meta name="description" content="Description.">
+</head></html>`),
+	}))
+
+	r := require.New(t)
+	ctx := context.Background()
+
+	md, err := f.ResolveMetadata(ctx, "https://example.com/og")
+	r.NoError(err)
+	r.Equal(&bookmark.Metadata{
+		Title:         "OpenGraph title",
+		Description:   "Twitter description.",
+		CanonicalLink: "https://example.com/canonical",
+		FaviconURL:    "https://cdn.example.com/icon.png",
+	}, md)
+
+	md, err = f.ResolveMetadata(ctx, "https://example.com/plain")
+	r.NoError(err)
+	r.Equal(&bookmark.Metadata{
+		Title:       "Plain title",
+		Description: "Description.",
+		FaviconURL:  "https://example.com/favicon.ico",
+	}, md)
+
+	_, err = f.ResolveMetadata(ctx, "https://example.com/missing")
+	r.Error(err)
+}
+
+func Test_CheckLink(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/permanent":
+			http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, "/page", http.StatusPermanentRedirect)
+		case "/temporary":
+			http.Redirect(w, r, "/permanent", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	r := require.New(t)
+	ctx := context.Background()
+	f := fetch.New()
+
+	for _, c := range []struct {
+		path   string
+		status *bookmark.LinkStatus
+	}{
+		{"/page", &bookmark.LinkStatus{StatusCode: 200, URL: ts.URL + "/page"}},
+		{"/no-head", &bookmark.LinkStatus{StatusCode: 200, URL: ts.URL + "/no-head"}},
+		{"/missing", &bookmark.LinkStatus{StatusCode: 404, URL: ts.URL + "/missing"}},
+		{"/permanent", &bookmark.LinkStatus{StatusCode: 200, URL: ts.URL + "/page", Permanent: true}},
+		{"/temporary", &bookmark.LinkStatus{StatusCode: 200, URL: ts.URL + "/page"}},
+	} {
+		status, err := f.CheckLink(ctx, ts.URL+c.path)
+		r.NoError(err, c.path)
+		r.Equal(c.status, status, c.path)
+	}
+
+	_, err := f.CheckLink(ctx, ts.URL+"/loop")
+	r.Equal(fetch.ErrTooManyRedirects, err)
+}
+
+func Test_ArchiveInlinesResources(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+			fmt.Fprint(w, `<html><head>
+	<meta charset="iso-8859-1">
+	<link rel="stylesheet" href="/css/style.css">
+	<link rel="stylesheet" href="/missing.css">
+	<script src="/app.js"></script>
+</head><body>
+	<p>Z`+"\xfc"+`rich</p>
+	<img src="img.png" srcset="img-2x.png 2x">
+	<a href="/other">Other</a>
+</body></html>`)
+		case "/css/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, `body { background: url('bg.png'); }`)
+		case "/img.png", "/css/bg.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	r := require.New(t)
+	ctx := context.Background()
+	f := fetch.New()
+
+	c, err := f.Archive(ctx, ts.URL+"/page", bookmark.SnapshotHTML)
+	r.NoError(err)
+	r.Equal(ts.URL+"/page", c.URL)
+	r.Equal("text/html; charset=utf-8", c.ContentType)
+	body := string(c.Body)
+	r.Contains(body, `<head><meta charset="utf-8"/><base href="`+ts.URL+`/page"/>`)
+	r.Contains(body, "Zürich")
+	r.Contains(body, `<style>body { background: url("data:image/png;base64,UE5H"); }</style>`)
+	r.Contains(body, `<link rel="stylesheet" href="`+ts.URL+`/missing.css"/>`)
+	r.Contains(body, `<img src="data:image/png;base64,UE5H"/>`)
+	r.Contains(body, `<a href="/other">`)
+	r.NotContains(body, "script")
+	r.NotContains(body, "iso-8859-1")
+
+	c, err = f.Archive(ctx, ts.URL+"/css/style.css", bookmark.SnapshotWARC)
+	r.NoError(err)
+	r.Equal("application/warc", c.ContentType)
+	body = string(c.Body)
+	r.True(strings.HasPrefix(body, "WARC/1.0\r\nWARC-Type: response\r\n"))
+	r.Contains(body, "WARC-Target-URI: "+ts.URL+"/css/style.css\r\n")
+	r.Contains(body, "\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 35\r\nContent-Type: text/css\r\n")
+	r.True(strings.HasSuffix(body, "\r\n\r\nbody { background: url('bg.png'); }\r\n\r\n"))
+
+	_, err = f.Archive(ctx, ts.URL+"/page", "pdf")
+	r.True(errors.Is(err, bookmark.ErrInvalidSnapshotFormat))
+}
+
+func Test_ArchiveRemovesActiveContent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/page":
+			fmt.Fprint(w, `<html><head></head><body onload="steal()">
+	<p OnClick="steal()" title="on the page">Text</p>
+	<a href="javascript:steal()">JavaScript</a>
+	<a href=" Java&#x09;Script:steal()">Obfuscated</a>
+	<a href="vbscript:steal()">VBScript</a>
+	<form action="javascript:steal()"><button formaction="javascript:steal()">Go</button></form>
+	<a href="/other">Other</a>
+	<iframe src="/other"></iframe>
+	<object data="/other"></object>
+	<embed src="/other">
+	<svg><a xlink:href="javascript:steal()"><text>SVG</text></a></svg>
+</body></html>`)
+		case "/frames":
+			fmt.Fprint(w, `<html><head></head><frameset><frame src="/other"></frameset></html>`)
+		default:
+			fmt.Fprint(w, `<p>Other</p>`)
+		}
+	}))
+	defer ts.Close()
+
+	r := require.New(t)
+	ctx := context.Background()
+	f := fetch.New()
+
+	c, err := f.Archive(ctx, ts.URL+"/page", bookmark.SnapshotHTML)
+	r.NoError(err)
+	body := strings.ToLower(string(c.Body))
+	r.NotContains(body, "steal")
+	r.NotContains(body, "onload")
+	r.NotContains(body, "onclick")
+	r.Contains(body, `<p title="on the page">text</p>`)
+	r.Contains(body, `<a href="/other">other</a>`)
+	r.NotContains(body, "<iframe")
+	r.NotContains(body, "<object")
+	r.NotContains(body, "<embed")
+
+	c, err = f.Archive(ctx, ts.URL+"/frames", bookmark.SnapshotHTML)
+	r.NoError(err)
+	body = string(c.Body)
+	r.NotContains(body, "<frameset")
+	r.NotContains(body, "<frame")
+}
+
+func Test_ArchiveLimitsInlinedResources(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head></head><body>
+	<img src="/a.png"><img src="/big.png"><img src="/b.png"><img src="/c.png"><img src="/d.png">
+</body></html>`)
+		case "/big.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, strings.Repeat("P", 11))
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNGPNG")
+		}
+	}))
+	defer ts.Close()
+
+	r := require.New(t)
+	ctx := context.Background()
+
+	//Big image is over the limit of single resource, d.png is over the
+	//limit of count of resources.
+	f := fetch.New(fetch.WithResourceLimits(4, 10, 100))
+	c, err := f.Archive(ctx, ts.URL+"/page", bookmark.SnapshotHTML)
+	r.NoError(err)
+	body := string(c.Body)
+	r.Contains(body, `<img src="data:image/png;base64,UE5HUE5H"/><img src="`+ts.URL+`/big.png"/>`)
+	r.Contains(body, `<img src="data:image/png;base64,UE5HUE5H"/><img src="data:image/png;base64,UE5HUE5H"/><img src="`+ts.URL+`/d.png"/>`)
+
+	//c.png is over the limit of size of all resources.
+	f = fetch.New(fetch.WithResourceLimits(10, 10, 15))
+	c, err = f.Archive(ctx, ts.URL+"/page", bookmark.SnapshotHTML)
+	r.NoError(err)
+	body = string(c.Body)
+	r.Contains(body, `<img src="data:image/png;base64,UE5HUE5H"/><img src="`+ts.URL+`/big.png"/><img src="data:image/png;base64,UE5HUE5H"/><img src="`+ts.URL+`/c.png"/><img src="`+ts.URL+`/d.png"/>`)
+}
@@ -0,0 +1,88 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/akruszewski/librarian/bookmark"
+)
+
+//maxRedirects is the number of redirects followed by CheckLink.
+const maxRedirects = 10
+
+//ErrTooManyRedirects is returned by CheckLink when the link is redirected more
+//than 10 times.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+//CheckLink requests the URL with HEAD method and follows redirects. Servers
+//which respond to HEAD with an error are asked again with GET, because many of
+//them don't implement HEAD properly. Body of the page isn't downloaded.
+func (f *Fetcher) CheckLink(ctx context.Context, url string) (*bookmark.LinkStatus, error) {
+	client := *f.client
+	//Redirects are followed by CheckLink to learn whether they are permanent.
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	status := &bookmark.LinkStatus{URL: url, Permanent: true}
+	for i := 0; ; i++ {
+		resp, err := f.probe(ctx, &client, status.URL)
+		if err != nil {
+			return nil, err
+		}
+		status.StatusCode = resp.StatusCode
+		location, err := resp.Location()
+		if !isRedirect(resp.StatusCode) || err != nil {
+			break
+		}
+		if i == maxRedirects {
+			return nil, ErrTooManyRedirects
+		}
+		if resp.StatusCode != http.StatusMovedPermanently && resp.StatusCode != http.StatusPermanentRedirect {
+			status.Permanent = false
+		}
+		status.URL = location.String()
+	}
+	if status.URL == url {
+		status.Permanent = false
+	}
+	return status, nil
+}
+
+//probe requests the URL with HEAD method, falling back to GET when it fails.
+//Returned response has no body.
+func (f *Fetcher) probe(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	resp, err := f.request(ctx, client, http.MethodHead, url)
+	if err == nil && resp.StatusCode < 400 {
+		return resp, nil
+	}
+	return f.request(ctx, client, http.MethodGet, url)
+}
+
+func (f *Fetcher) request(ctx context.Context, client *http.Client, method, url string) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", f.userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	//Small rest of the body is drained, so the connection can be reused.
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4<<10))
+	resp.Body.Close()
+	return resp, nil
+}
+
+func isRedirect(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
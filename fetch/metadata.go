@@ -0,0 +1,116 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/akruszewski/librarian/bookmark"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//ResolveMetadata downloads the page and reads its title, description,
+//canonical link and favicon. OpenGraph and Twitter card tags are preferred
+//over <title> and description meta tag. When the page doesn't declare a
+//favicon, /favicon.ico of its host is assumed.
+func (f *Fetcher) ResolveMetadata(ctx context.Context, url string) (*bookmark.Metadata, error) {
+	resp, err := f.download(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if !isHTML(resp.mediaType) {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedContentType, resp.mediaType)
+	}
+	r, err := resp.reader()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(doc, resp.url), nil
+}
+
+func isHTML(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+func parseMetadata(doc *html.Node, base *url.URL) *bookmark.Metadata {
+	//meta holds content of meta tags by their name or property.
+	meta := map[string]string{}
+	var title, canonical, icon string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Svg:
+				//SVG images have their own titles.
+				return
+			case atom.Title:
+				if title == "" && n.FirstChild != nil {
+					title = n.FirstChild.Data
+				}
+			case atom.Meta:
+				key := attr(n, "property")
+				if key == "" {
+					key = attr(n, "name")
+				}
+				key = strings.ToLower(key)
+				if _, ok := meta[key]; !ok && key != "" {
+					meta[key] = attr(n, "content")
+				}
+			case atom.Link:
+				for _, rel := range strings.Fields(strings.ToLower(attr(n, "rel"))) {
+					switch {
+					case rel == "canonical" && canonical == "":
+						canonical = attr(n, "href")
+					case rel == "icon" && icon == "":
+						icon = attr(n, "href")
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if icon == "" {
+		icon = "/favicon.ico"
+	}
+	return &bookmark.Metadata{
+		Title:         firstNonEmpty(meta["og:title"], meta["twitter:title"], title),
+		Description:   firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"]),
+		CanonicalLink: resolveURL(base, canonical),
+		FaviconURL:    resolveURL(base, icon),
+	}
+}
+
+//firstNonEmpty returns the first value which isn't blank, with white space
+//collapsed.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.Join(strings.Fields(v), " "); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+//resolveURL returns absolute form of the reference, or empty string when it's
+//empty or invalid.
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
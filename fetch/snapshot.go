@@ -0,0 +1,340 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/akruszewski/librarian/bookmark"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//cssURL matches url() references in style sheets.
+var cssURL = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)\s]*))\s*\)`)
+
+//errResourceLimit is returned when the resource is over the limits of
+//inlined resources.
+var errResourceLimit = errors.New("too many resources")
+
+//urlAttrs are attributes whose values are URLs, which can run scripts with
+//javascript: and vbscript: schemes.
+var urlAttrs = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"data":       true,
+	"poster":     true,
+	"background": true,
+	"cite":       true,
+	"longdesc":   true,
+}
+
+//Archive captures the page in bookmark.SnapshotHTML or bookmark.SnapshotWARC
+//format.
+func (f *Fetcher) Archive(ctx context.Context, url, format string) (*bookmark.Capture, error) {
+	if format != bookmark.SnapshotHTML && format != bookmark.SnapshotWARC {
+		return nil, fmt.Errorf("%w %q", bookmark.ErrInvalidSnapshotFormat, format)
+	}
+	resp, err := f.download(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if format == bookmark.SnapshotWARC {
+		return &bookmark.Capture{
+			URL:         resp.url.String(),
+			ContentType: "application/warc",
+			Body:        warcRecord(resp, time.Now().UTC()),
+		}, nil
+	}
+
+	if !isHTML(resp.mediaType) {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedContentType, resp.mediaType)
+	}
+	r, err := resp.reader()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	in := &inliner{fetcher: f, ctx: ctx, base: resp.url, cache: map[string]string{}}
+	in.inline(doc)
+	var b bytes.Buffer
+	if err := html.Render(&b, doc); err != nil {
+		return nil, err
+	}
+	return &bookmark.Capture{
+		URL:         resp.url.String(),
+		ContentType: "text/html; charset=utf-8",
+		Body:        b.Bytes(),
+	}, nil
+}
+
+//inliner makes the HTML document self-contained. Style sheets and images are
+//embedded in the document, scripts, event handlers, script URLs and embedded
+//frames and objects are removed. Resources which can't be downloaded are
+//referenced by absolute URLs, like resources over the limits of the fetcher,
+//see WithResourceLimits.
+type inliner struct {
+	fetcher *Fetcher
+	ctx     context.Context
+	//base is URL against which references of the document are resolved.
+	base *neturl.URL
+	//cache maps URLs of downloaded resources to their data URIs.
+	cache map[string]string
+	//count and size of downloaded resources.
+	count int
+	size  int64
+}
+
+func (in *inliner) inline(doc *html.Node) {
+	head := find(doc, func(n *html.Node) bool { return n.DataAtom == atom.Head })
+	if base := find(doc, func(n *html.Node) bool { return n.DataAtom == atom.Base }); base != nil {
+		if u, err := in.base.Parse(attr(base, "href")); err == nil {
+			in.base = u
+		}
+		base.Parent.RemoveChild(base)
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode && in.element(c) {
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(doc)
+
+	if head != nil {
+		//Links which weren't inlined are resolved against the original page.
+		head.InsertBefore(element(atom.Base, "href", in.base.String()), head.FirstChild)
+		//Document is rendered in UTF-8, regardless of the original encoding.
+		head.InsertBefore(element(atom.Meta, "charset", "utf-8"), head.FirstChild)
+	}
+}
+
+//element inlines resources of the element and reports whether its children
+//should be visited. Element can be replaced or removed.
+func (in *inliner) element(n *html.Node) bool {
+	removeScripts(n)
+	if style := attr(n, "style"); style != "" {
+		setAttr(n, "style", in.css(style, in.base))
+	}
+	switch n.DataAtom {
+	case atom.Script, atom.Iframe, atom.Frame, atom.Frameset, atom.Object, atom.Embed:
+		n.Parent.RemoveChild(n)
+		return false
+	case atom.Meta:
+		if attr(n, "charset") != "" || strings.EqualFold(attr(n, "http-equiv"), "content-type") {
+			n.Parent.RemoveChild(n)
+		}
+	case atom.Style:
+		if n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+			n.FirstChild.Data = in.css(n.FirstChild.Data, in.base)
+		}
+		return false
+	case atom.Link:
+		rel := strings.Fields(strings.ToLower(attr(n, "rel")))
+		for _, r := range rel {
+			switch r {
+			case "stylesheet":
+				in.stylesheet(n)
+				return false
+			case "icon":
+				if href := attr(n, "href"); href != "" {
+					setAttr(n, "href", in.dataURI(href, in.base))
+				}
+				return false
+			}
+		}
+		if href := attr(n, "href"); href != "" {
+			setAttr(n, "href", in.resolve(href, in.base))
+		}
+	case atom.Img:
+		removeAttr(n, "srcset")
+		if src := attr(n, "src"); src != "" {
+			setAttr(n, "src", in.dataURI(src, in.base))
+		}
+	case atom.Source:
+		if n.Parent != nil && n.Parent.DataAtom == atom.Picture {
+			//Picture falls back to its <img> which is inlined.
+			n.Parent.RemoveChild(n)
+		}
+	}
+	return true
+}
+
+//stylesheet replaces the link of the style sheet by <style> element.
+func (in *inliner) stylesheet(n *html.Node) {
+	href := attr(n, "href")
+	u, err := in.base.Parse(href)
+	if err != nil {
+		return
+	}
+	resp, err := in.download(u.String())
+	if err != nil || resp.mediaType != "text/css" {
+		setAttr(n, "href", u.String())
+		return
+	}
+	style := element(atom.Style)
+	if media := attr(n, "media"); media != "" {
+		setAttr(style, "media", media)
+	}
+	style.AppendChild(&html.Node{Type: html.TextNode, Data: in.css(string(resp.body), resp.url)})
+	n.Parent.InsertBefore(style, n)
+	n.Parent.RemoveChild(n)
+}
+
+//css embeds resources referenced by the style sheet, which references are
+//relative to base.
+func (in *inliner) css(css string, base *neturl.URL) string {
+	return cssURL.ReplaceAllStringFunc(css, func(m string) string {
+		sub := cssURL.FindStringSubmatch(m)
+		ref := sub[1] + sub[2] + sub[3]
+		return `url("` + in.dataURI(ref, base) + `")`
+	})
+}
+
+//dataURI returns the resource embedded in data URI, or its absolute URL when
+//it can't be downloaded.
+func (in *inliner) dataURI(ref string, base *neturl.URL) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "data:") || strings.HasPrefix(ref, "#") {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	if uri, ok := in.cache[u.String()]; ok {
+		return uri
+	}
+	uri := u.String()
+	if resp, err := in.download(uri); err == nil {
+		uri = "data:" + resp.mediaType + ";base64," + base64.StdEncoding.EncodeToString(resp.body)
+	}
+	in.cache[u.String()] = uri
+	return uri
+}
+
+//download gets the resource, which is smaller than the limit of single
+//resource and the size left from the limit of all resources.
+func (in *inliner) download(url string) (*response, error) {
+	f := in.fetcher
+	maxSize := f.maxResourceSize
+	if left := f.maxResourcesSize - in.size; left < maxSize {
+		maxSize = left
+	}
+	if in.count >= f.maxResources || maxSize <= 0 {
+		return nil, errResourceLimit
+	}
+	in.count++
+	resp, err := f.downloadMax(in.ctx, url, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	in.size += int64(len(resp.body))
+	return resp, nil
+}
+
+func (in *inliner) resolve(ref string, base *neturl.URL) string {
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+//warcRecord returns WARC record of the HTTP response.
+func warcRecord(resp *response, date time.Time) []byte {
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "%s %s\r\n", resp.proto, resp.status)
+	resp.header.Write(&block)
+	block.WriteString("\r\n")
+	block.Write(resp.body)
+	digest := sha1.Sum(resp.body)
+
+	var b bytes.Buffer
+	b.WriteString("WARC/1.0\r\n")
+	b.WriteString("WARC-Type: response\r\n")
+	fmt.Fprintf(&b, "WARC-Record-ID: <urn:uuid:%s>\r\n", uuid.New())
+	fmt.Fprintf(&b, "WARC-Date: %s\r\n", date.Format(time.RFC3339))
+	fmt.Fprintf(&b, "WARC-Target-URI: %s\r\n", resp.url)
+	fmt.Fprintf(&b, "WARC-Payload-Digest: sha1:%s\r\n", base32.StdEncoding.EncodeToString(digest[:]))
+	b.WriteString("Content-Type: application/http; msgtype=response\r\n")
+	fmt.Fprintf(&b, "Content-Length: %d\r\n", block.Len())
+	b.WriteString("\r\n")
+	b.Write(block.Bytes())
+	b.WriteString("\r\n\r\n")
+	return b.Bytes()
+}
+
+//element returns new element with given attribute names and values.
+func element(a atom.Atom, attrs ...string) *html.Node {
+	n := &html.Node{Type: html.ElementNode, DataAtom: a, Data: a.String()}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		n.Attr = append(n.Attr, html.Attribute{Key: attrs[i], Val: attrs[i+1]})
+	}
+	return n
+}
+
+//removeScripts removes event handlers and script URLs from attributes of the
+//element.
+func removeScripts(n *html.Node) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		if strings.HasPrefix(key, "on") || urlAttrs[key] && isScriptURL(a.Val) {
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	n.Attr = attrs
+}
+
+//isScriptURL reports whether the URL runs a script. Browsers ignore
+//whitespace and control characters in the scheme.
+func isScriptURL(url string) bool {
+	url = strings.ToLower(strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, url))
+	return strings.HasPrefix(url, "javascript:") || strings.HasPrefix(url, "vbscript:")
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func removeAttr(n *html.Node, key string) {
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if a.Key != key {
+			attrs = append(attrs, a)
+		}
+	}
+	n.Attr = attrs
+}
@@ -1,13 +1,11 @@
-/*
-TODO:
- - add proper http response status handling.
-*/
 package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -18,26 +16,56 @@ import (
 	"github.com/akruszewski/librarian/bookmark"
 )
 
+//Client is bookmark.Storager of the remote server. Error responses are
+//returned as *Error, which unwraps to errors of bookmark package.
 type Client struct {
 	url        *url.URL
 	httpClient *http.Client
 }
 
-func (c *Client) Add(nbm *bookmark.NewBookmark) (*bookmark.Bookmark, error) {
-	body, err := json.Marshal(nbm)
+var _ bookmark.Storager = (*Client)(nil)
+
+//Add adds bookmark with optional conflict policy, see bookmark.Store.Add. When
+//bookmark with the same URL exists, *bookmark.ErrDuplicate is returned.
+func (c *Client) Add(ctx context.Context, nbm *bookmark.NewBookmark, policy ...bookmark.ConflictPolicy) (*bookmark.Bookmark, error) {
+	u := *c.url
+	if len(policy) != 0 && policy[0] != "" {
+		u.RawQuery = url.Values{"conflict": []string{string(policy[0])}}.Encode()
+	}
+	bm := &bookmark.Bookmark{}
+	if err := c.sendJSON(ctx, http.MethodPost, u.String(), nbm, bm, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return bm, nil
+}
+
+//Update updates bookmark. If fields are passed, only those fields are updated,
+//see bookmark.Store.Update.
+func (c *Client) Update(ctx context.Context, bm *bookmark.Bookmark, fields ...string) (*bookmark.Bookmark, error) {
+	u := *c.url
+	if len(fields) != 0 {
+		u.RawQuery = url.Values{"fields": fields}.Encode()
+	}
+	updated := &bookmark.Bookmark{}
+	if err := c.sendJSON(ctx, http.MethodPost, buildURL(u, strconv.Itoa(bm.ID)), bm, updated, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+//Patch applies JSON Merge Patch (RFC 7396) to the bookmark with given id. Only
+//fields present in patch are changed, fields set to nil are cleared.
+func (c *Client) Patch(ctx context.Context, id int, patch map[string]interface{}) (*bookmark.Bookmark, error) {
+	body, err := json.Marshal(patch)
 	if err != nil {
 		return nil, err
 	}
-	resp, err := c.httpClient.Post(
-		c.url.String(),
-		"application/json",
-		bytes.NewBuffer(body),
-	)
+	req, err := c.newRequest(ctx, http.MethodPatch, c.bookmarkURL(id, ""), bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	respBody, err := c.do(req, http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
@@ -48,50 +76,354 @@ func (c *Client) Add(nbm *bookmark.NewBookmark) (*bookmark.Bookmark, error) {
 	return bm, nil
 }
 
-func (c *Client) Update(bm *bookmark.Bookmark) (*bookmark.Bookmark, error) {
-	body, err := json.Marshal(bm)
+//Delete moves the bookmark to the trash, see bookmark.Store.Delete.
+func (c *Client) Delete(ctx context.Context, id int) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, c.bookmarkURL(id, ""), nil)
 	if err != nil {
+		return err
+	}
+	_, err = c.do(req, http.StatusOK)
+	return err
+}
+
+//Get returns the bookmark without recording the access, see Visit.
+func (c *Client) Get(ctx context.Context, id int) (*bookmark.Bookmark, error) {
+	u, err := url.Parse(c.bookmarkURL(id, ""))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{"visit": []string{"false"}}.Encode()
+	bm := &bookmark.Bookmark{}
+	if err := c.sendJSON(ctx, http.MethodGet, u.String(), nil, bm, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return bm, nil
+}
+
+//Visit returns the bookmark and records the access, see
+//bookmark.Store.Visit.
+func (c *Client) Visit(ctx context.Context, id int) (*bookmark.Bookmark, error) {
+	bm := &bookmark.Bookmark{}
+	if err := c.sendJSON(ctx, http.MethodGet, c.bookmarkURL(id, ""), nil, bm, http.StatusOK); err != nil {
 		return nil, err
 	}
-	resp, err := c.httpClient.Post(
-		buildURL(*c.url, strconv.Itoa(bm.ID)),
-		"application/json",
-		bytes.NewBuffer(body),
-	)
+	return bm, nil
+}
+
+//GetByURL returns the bookmark with given URL, see bookmark.Store.GetByURL.
+func (c *Client) GetByURL(ctx context.Context, bmURL string) (*bookmark.Bookmark, error) {
+	u, err := url.Parse(buildURL(*c.url, "lookup"))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
+	u.RawQuery = url.Values{"url": []string{bmURL}}.Encode()
+	bm := &bookmark.Bookmark{}
+	if err := c.sendJSON(ctx, http.MethodGet, u.String(), nil, bm, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return bm, nil
+}
+
+//List returns page of bookmarks and cursor of the next page, which is empty
+//on the last page. Server limits page size, when opts.Limit is zero default
+//page size is used.
+func (c *Client) List(ctx context.Context, opts bookmark.ListOptions) ([]*bookmark.BookmarkSummary, string, error) {
+	u := *c.url
+	u.RawQuery = encodeListOptions(opts).Encode()
+	req, err := c.newRequest(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, body, err := c.send(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", responseError(resp.StatusCode, body)
+	}
+	bms := []*bookmark.BookmarkSummary{}
+	if err := json.Unmarshal(body, &bms); err != nil {
+		return nil, "", err
+	}
+	return bms, resp.Header.Get(nextCursorHeader), nil
+}
+
+//Query lists bookmarks matching the query, see bookmark.Store.Query. Query
+//without criteria lists all bookmarks page by page.
+func (c *Client) Query(ctx context.Context, q bookmark.Query) ([]*bookmark.BookmarkSummary, error) {
+	v := encodeQuery(q)
+	if !isQuery(v) {
+		return c.listAll(ctx, q.Kind)
+	}
+	u := *c.url
+	u.RawQuery = v.Encode()
+	bms := []*bookmark.BookmarkSummary{}
+	if err := c.sendJSON(ctx, http.MethodGet, u.String(), nil, &bms, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return bms, nil
+}
+
+//listAll returns all bookmarks of given kind ordered by ID, like Query
+//without criteria.
+func (c *Client) listAll(ctx context.Context, kind string) ([]*bookmark.BookmarkSummary, error) {
+	all := []*bookmark.BookmarkSummary{}
+	opts := bookmark.ListOptions{Limit: maxPageSize, Kind: kind}
+	for {
+		bms, next, err := c.List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, bms...)
+		if next == "" {
+			return all, nil
+		}
+		opts.Cursor = next
+	}
+}
+
+//Search runs full-text query and returns at most limit hits, see
+//bookmark.Store.Search. Search endpoint is expected to be a sibling of the
+//bookmark endpoint.
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]*bookmark.SearchHit, error) {
+	u, err := url.Parse(c.siblingURL("search", ""))
 	if err != nil {
 		return nil, err
 	}
-	bm = &bookmark.Bookmark{}
-	if err := json.Unmarshal(respBody, bm); err != nil {
+	u.RawQuery = url.Values{
+		"q":     {query},
+		"limit": {strconv.Itoa(limit)},
+	}.Encode()
+	hits := []*bookmark.SearchHit{}
+	if err := c.sendJSON(ctx, http.MethodGet, u.String(), nil, &hits, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+//Reindex rebuilds the search index, see bookmark.Store.Reindex.
+func (c *Client) Reindex(ctx context.Context) error {
+	return c.sendJSON(ctx, http.MethodPost, buildURL(*c.url, "reindex"), nil, nil, http.StatusNoContent)
+}
+
+//Refetch downloads page of the bookmark again, see bookmark.Store.Refetch.
+func (c *Client) Refetch(ctx context.Context, id int) (*bookmark.Bookmark, error) {
+	bm := &bookmark.Bookmark{}
+	if err := c.sendJSON(ctx, http.MethodPost, c.bookmarkURL(id, "refetch"), nil, bm, http.StatusOK); err != nil {
 		return nil, err
 	}
 	return bm, nil
 }
 
-func (c *Client) Get(id string) (*bookmark.Bookmark, error) {
-	resp, err := c.httpClient.Get(buildURL(*c.url, id))
+//History returns revisions of the bookmark, see bookmark.Store.History.
+func (c *Client) History(ctx context.Context, id int) ([]*bookmark.Revision, error) {
+	revs := []*bookmark.Revision{}
+	if err := c.sendJSON(ctx, http.MethodGet, c.bookmarkURL(id, "history"), nil, &revs, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return revs, nil
+}
+
+//Restore restores the bookmark to given revision, see bookmark.Store.Restore.
+func (c *Client) Restore(ctx context.Context, id, rev int) (*bookmark.Bookmark, error) {
+	u, err := url.Parse(c.bookmarkURL(id, "restore"))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+	u.RawQuery = url.Values{"rev": []string{strconv.Itoa(rev)}}.Encode()
+	bm := &bookmark.Bookmark{}
+	if err := c.sendJSON(ctx, http.MethodPost, u.String(), nil, bm, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return bm, nil
+}
+
+//Snapshot saves new snapshot of the bookmark in given format, see
+//bookmark.Store.Snapshot.
+func (c *Client) Snapshot(ctx context.Context, id int, format string) (*bookmark.Snapshot, error) {
+	u, err := url.Parse(c.bookmarkURL(id, "snapshot"))
 	if err != nil {
 		return nil, err
 	}
+	u.RawQuery = url.Values{"format": []string{format}}.Encode()
+	s := &bookmark.Snapshot{}
+	if err := c.sendJSON(ctx, http.MethodPost, u.String(), nil, s, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//Snapshots returns snapshots of the bookmark, see bookmark.Store.Snapshots.
+func (c *Client) Snapshots(ctx context.Context, id int) ([]*bookmark.Snapshot, error) {
+	ss := []*bookmark.Snapshot{}
+	if err := c.sendJSON(ctx, http.MethodGet, c.bookmarkURL(id, "snapshot"), nil, &ss, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return ss, nil
+}
+
+//OpenSnapshot returns the snapshot with given version, or the latest one when
+//version is zero, and its content, which has to be closed by the caller.
+func (c *Client) OpenSnapshot(ctx context.Context, id, version int) (*bookmark.Snapshot, io.ReadCloser, error) {
+	v := "latest"
+	if version != 0 {
+		v = strconv.Itoa(version)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, c.bookmarkURL(id, path.Join("snapshot", v)), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, nil, responseError(resp.StatusCode, body)
+	}
+	//Content is served with the version, other details are in the list of
+	//snapshots.
+	if version, err = strconv.Atoi(resp.Header.Get(snapshotVersionHeader)); err != nil {
+		resp.Body.Close()
+		return nil, nil, fmt.Errorf("invalid snapshot version %q", resp.Header.Get(snapshotVersionHeader))
+	}
+	ss, err := c.Snapshots(ctx, id)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	for _, s := range ss {
+		if s.Version == version {
+			return s, resp.Body, nil
+		}
+	}
+	resp.Body.Close()
+	return nil, nil, bookmark.ErrNotFound
+}
+
+//Tags returns all tags with number of their bookmarks, see
+//bookmark.Store.Tags. Tag endpoint is expected to be a sibling of the bookmark
+//endpoint.
+func (c *Client) Tags(ctx context.Context) ([]*bookmark.TagCount, error) {
+	tags := []*bookmark.TagCount{}
+	if err := c.sendJSON(ctx, http.MethodGet, c.siblingURL("tag", ""), nil, &tags, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+//RenameTag renames the tag on all bookmarks and returns their number, see
+//bookmark.Store.RenameTag.
+func (c *Client) RenameTag(ctx context.Context, old, new string) (int, error) {
+	updated := &bookmarksUpdated{}
+	err := c.sendJSON(ctx, http.MethodPost, c.siblingURL("tag", "rename"), &renameTagRequest{Old: old, New: new}, updated, http.StatusOK)
+	return updated.Updated, err
+}
+
+//MergeTags replaces tags with the tag into on all bookmarks and returns their
+//number, see bookmark.Store.MergeTags.
+func (c *Client) MergeTags(ctx context.Context, tags []string, into string) (int, error) {
+	updated := &bookmarksUpdated{}
+	err := c.sendJSON(ctx, http.MethodPost, c.siblingURL("tag", "merge"), &mergeTagsRequest{Tags: tags, Into: into}, updated, http.StatusOK)
+	return updated.Updated, err
+}
+
+//DeleteTag removes the tag from all bookmarks and returns their number.
+func (c *Client) DeleteTag(ctx context.Context, tag string) (int, error) {
+	updated := &bookmarksUpdated{}
+	err := c.sendJSON(ctx, http.MethodDelete, c.siblingURL("tag", tag), nil, updated, http.StatusOK)
+	return updated.Updated, err
+}
+
+//Collections returns all collections, see bookmark.Store.Collections.
+//Collection endpoint is expected to be a sibling of the bookmark endpoint.
+func (c *Client) Collections(ctx context.Context) ([]*bookmark.Collection, error) {
+	cs := []*bookmark.Collection{}
+	if err := c.sendJSON(ctx, http.MethodGet, c.siblingURL("collection", ""), nil, &cs, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+//CreateCollection creates collection with its missing ancestors.
+func (c *Client) CreateCollection(ctx context.Context, path string) (*bookmark.Collection, error) {
+	col := &bookmark.Collection{}
+	if err := c.sendJSON(ctx, http.MethodPost, c.siblingURL("collection", ""), &createCollectionRequest{Path: path}, col, http.StatusCreated); err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+//MoveCollection changes path of the collection, see
+//bookmark.Store.MoveCollection.
+func (c *Client) MoveCollection(ctx context.Context, from, to string) (*bookmark.Collection, error) {
+	col := &bookmark.Collection{}
+	if err := c.sendJSON(ctx, http.MethodPost, c.siblingURL("collection", "move"), &moveCollectionRequest{From: from, To: to}, col, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return col, nil
+}
+
+//DeleteCollection deletes the collection and returns number of its bookmarks,
+//which are deleted or reassigned, see bookmark.Store.DeleteCollection.
+func (c *Client) DeleteCollection(ctx context.Context, path, reassign string) (int, error) {
+	u, err := url.Parse(c.siblingURL("collection", path))
+	if err != nil {
+		return 0, err
+	}
+	if reassign != "" {
+		u.RawQuery = url.Values{"reassign": []string{reassign}}.Encode()
+	}
+	updated := &bookmarksUpdated{}
+	err = c.sendJSON(ctx, http.MethodDelete, u.String(), nil, updated, http.StatusOK)
+	return updated.Updated, err
+}
+
+//Trash returns deleted bookmarks, see bookmark.Store.Trash. Trash endpoint is
+//expected to be a sibling of the bookmark endpoint.
+func (c *Client) Trash(ctx context.Context) ([]*bookmark.Bookmark, error) {
+	bms := []*bookmark.Bookmark{}
+	if err := c.sendJSON(ctx, http.MethodGet, c.siblingURL("trash", ""), nil, &bms, http.StatusOK); err != nil {
+		return nil, err
+	}
+	return bms, nil
+}
+
+//RestoreFromTrash moves the deleted bookmark back from the trash.
+func (c *Client) RestoreFromTrash(ctx context.Context, id int) (*bookmark.Bookmark, error) {
 	bm := &bookmark.Bookmark{}
-	if err := json.Unmarshal(body, bm); err != nil {
+	if err := c.sendJSON(ctx, http.MethodPost, c.siblingURL("trash", path.Join(strconv.Itoa(id), "restore")), nil, bm, http.StatusOK); err != nil {
 		return nil, err
 	}
 	return bm, nil
 }
 
-func (c *Client) Delete(id string) error {
-	req, err := http.NewRequest(http.MethodDelete, buildURL(*c.url, id), nil)
+//EmptyTrash permanently deletes bookmarks, which were deleted before given
+//time, and returns their number, see bookmark.Store.EmptyTrash.
+func (c *Client) EmptyTrash(ctx context.Context, before time.Time) (int, error) {
+	u, err := url.Parse(c.siblingURL("trash", ""))
+	if err != nil {
+		return 0, err
+	}
+	u.RawQuery = url.Values{"before": []string{before.Format(time.RFC3339Nano)}}.Encode()
+	emptied := &trashEmptied{}
+	err = c.sendJSON(ctx, http.MethodDelete, u.String(), nil, emptied, http.StatusOK)
+	return emptied.Purged, err
+}
+
+//ExportCSV writes all bookmarks in CSV format to w.
+func (c *Client) ExportCSV(ctx context.Context, w io.Writer) error {
+	return c.export(ctx, "export.csv", w)
+}
+
+//ExportHTML writes all bookmarks as the Netscape bookmark file to w.
+func (c *Client) ExportHTML(ctx context.Context, w io.Writer) error {
+	return c.export(ctx, "export.html", w)
+}
+
+func (c *Client) export(ctx context.Context, name string, w io.Writer) error {
+	req, err := c.newRequest(ctx, http.MethodGet, buildURL(*c.url, name), nil)
 	if err != nil {
 		return err
 	}
@@ -99,32 +431,144 @@ func (c *Client) Delete(id string) error {
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("got unexpected status: %d", resp.StatusCode)
+		body, _ := ioutil.ReadAll(resp.Body)
+		return responseError(resp.StatusCode, body)
 	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
 
-	return nil
+//ImportCSV imports bookmarks from CSV file, see bookmark.Store.ImportCSV.
+func (c *Client) ImportCSV(ctx context.Context, r io.Reader, opts bookmark.ImportOptions) (*bookmark.ImportReport, error) {
+	return c.importFile(ctx, "import.csv", "text/csv", r, opts)
 }
 
-func (c *Client) List() ([]bookmark.BookmarkSummary, error) {
-	resp, err := c.httpClient.Get(c.url.String())
+//ImportHTML imports bookmarks from browser HTML file, see
+//bookmark.Store.ImportHTML.
+func (c *Client) ImportHTML(ctx context.Context, r io.Reader, opts bookmark.ImportOptions) (*bookmark.ImportReport, error) {
+	return c.importFile(ctx, "import.html", "text/html", r, opts)
+}
+
+//importFile returns report along with bookmark.ErrImportRolledBack when
+//strict import is rolled back.
+func (c *Client) importFile(ctx context.Context, name, contentType string, r io.Reader, opts bookmark.ImportOptions) (*bookmark.ImportReport, error) {
+	u, err := url.Parse(buildURL(*c.url, name))
+	if err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	if opts.Mode != "" {
+		v.Set("mode", string(opts.Mode))
+	}
+	if opts.Conflict != "" {
+		v.Set("conflict", string(opts.Conflict))
+	}
+	u.RawQuery = v.Encode()
+	req, err := c.newRequest(ctx, http.MethodPost, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, body, err := c.send(req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity {
+		return nil, responseError(resp.StatusCode, body)
+	}
+	report := &bookmark.ImportReport{}
+	if err := json.Unmarshal(body, report); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return report, bookmark.ErrImportRolledBack
+	}
+	return report, nil
+}
+
+//bookmarkURL returns URL of path p under the bookmark with given id.
+func (c *Client) bookmarkURL(id int, p string) string {
+	return buildURL(*c.url, path.Join(strconv.Itoa(id), p))
+}
+
+//siblingURL returns URL of path p under endpoint with given name, which is a
+//sibling of the bookmark endpoint.
+func (c *Client) siblingURL(name, p string) string {
+	u := *c.url
+	u.Path = path.Join(path.Dir(u.Path), name) + "/" + p
+	return u.String()
+}
+
+//newRequest returns request bound to ctx, which sends author of changes set
+//by bookmark.WithAuthor in AuthorHeader.
+func (c *Client) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if author := bookmark.Author(ctx); author != "" {
+		req.Header.Set(AuthorHeader, author)
+	}
+	return req, nil
+}
+
+//send sends the request and returns response with its body.
+func (c *Client) send(req *http.Request) (*http.Response, []byte, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	bm := []bookmark.BookmarkSummary{}
-	if err := json.Unmarshal(body, &bm); err != nil {
+	return resp, body, nil
+}
+
+//do sends the request and returns body of the response with expected status,
+//other responses are returned as errors, see responseError.
+func (c *Client) do(req *http.Request, status int) ([]byte, error) {
+	resp, body, err := c.send(req)
+	if err != nil {
 		return nil, err
 	}
-	return bm, nil
+	if resp.StatusCode != status {
+		return nil, responseError(resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+//sendJSON sends reqBody, unless it's nil, and decodes response body with
+//expected status into respBody, unless it's nil.
+func (c *Client) sendJSON(ctx context.Context, method, url string, reqBody, respBody interface{}, status int) error {
+	var body io.Reader
+	if reqBody != nil {
+		data, err := json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := c.newRequest(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	data, err := c.do(req, status)
+	if err != nil || respBody == nil {
+		return err
+	}
+	return json.Unmarshal(data, respBody)
 }
 
-//NewClient instantiate Client. TODO: move args to application configuration
-//structure.
+//NewClient instantiate Client of the bookmark endpoint at URL, with given
+//timeout of requests, see config.Config. Author of changes is taken from
+//context of calls, see bookmark.WithAuthor.
 func NewClient(URL string, timeout time.Duration) (*Client, error) {
 	u, err := url.Parse(URL)
 	if err != nil {
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/akruszewski/librarian/bookmark"
+	log "github.com/sirupsen/logrus"
+)
+
+//createCollectionRequest is the body of collection create request.
+type createCollectionRequest struct {
+	Path string `json:"path"`
+}
+
+//moveCollectionRequest is the body of collection move request.
+type moveCollectionRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+//CollectionHandler returns handler of collections. Collections are listed on
+//GET / and created on POST /, POST /move changes path of the collection and
+///DELETE /<path> deletes the collection with its descendants. Bookmarks of
+//deleted collections are deleted too, unless reassign parameter names the
+//collection they are moved to.
+func CollectionHandler(ctx context.Context, repo bookmark.Storager, log *log.Entry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := withAuthor(ctx, r)
+		var (
+			data interface{}
+			err  error
+		)
+		status := http.StatusOK
+		switch {
+		case r.URL.Path == "/" && r.Method == http.MethodGet:
+			data, err = repo.Collections(ctx)
+		case r.URL.Path == "/" && r.Method == http.MethodPost:
+			req := &createCollectionRequest{}
+			if err = decodeJSON(r, req); err == nil {
+				data, err = repo.CreateCollection(ctx, req.Path)
+				status = http.StatusCreated
+			}
+		case r.URL.Path == "/move" && r.Method == http.MethodPost:
+			req := &moveCollectionRequest{}
+			if err = decodeJSON(r, req); err == nil {
+				data, err = repo.MoveCollection(ctx, req.From, req.To)
+			}
+		case r.URL.Path != "/" && r.Method == http.MethodDelete:
+			var n int
+			n, err = repo.DeleteCollection(ctx, strings.TrimPrefix(r.URL.Path, "/"), r.URL.Query().Get("reassign"))
+			data = &bookmarksUpdated{Updated: n}
+		case r.URL.Path == "/":
+			notAllowed(w, log, http.MethodGet, http.MethodPost)
+			return
+		case r.URL.Path == "/move":
+			notAllowed(w, log, http.MethodPost, http.MethodDelete)
+			return
+		default:
+			notAllowed(w, log, http.MethodDelete)
+			return
+		}
+		if err != nil {
+			log.Errorf("Error handling collections: %v", err)
+			writeError(w, log, err)
+			return
+		}
+
+		body, err := json.Marshal(data)
+		if err != nil {
+			log.Errorf("Error marshaling collections: %v", err)
+			writeError(w, log, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if _, err = w.Write(body); err != nil {
+			log.Errorf("Error writing data: %v", err)
+			return
+		}
+		log.WithField("Path", r.URL.Path).Info("Collections handled.")
+	}
+}
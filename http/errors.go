@@ -0,0 +1,225 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/akruszewski/librarian/bookmark"
+	log "github.com/sirupsen/logrus"
+)
+
+//Codes of API errors.
+const (
+	CodeInternal         = "internal"
+	CodeInvalidRequest   = "invalid_request"
+	CodeRouteNotFound    = "route_not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeInvalidBookmark  = "invalid_bookmark"
+	CodeDuplicate        = "duplicate"
+	CodeInvalidPatch     = "invalid_patch"
+	CodePatchTestFailed  = "patch_test_failed"
+
+	CodeNotFound              = "not_found"
+	CodeRevisionNotFound      = "revision_not_found"
+	CodeTagNotFound           = "tag_not_found"
+	CodeCollectionNotFound    = "collection_not_found"
+	CodeUnknownField          = "unknown_field"
+	CodeInvalidConflictPolicy = "invalid_conflict_policy"
+	CodeInvalidCursor         = "invalid_cursor"
+	CodeInvalidSort           = "invalid_sort"
+	CodeNotURL                = "not_url"
+	CodeInvalidSnapshotFormat = "invalid_snapshot_format"
+	CodeInvalidCSV            = "invalid_csv"
+	CodeInvalidImportMode     = "invalid_import_mode"
+	CodeInvalidTag            = "invalid_tag"
+	CodeInvalidCollection     = "invalid_collection"
+	CodeTagExists             = "tag_exists"
+	CodeCollectionExists      = "collection_exists"
+	CodeNoFetcher             = "no_fetcher"
+	CodeNoArchiver            = "no_archiver"
+	CodeCaptureFailed         = "capture_failed"
+)
+
+//errorCodes maps errors to status and code of the response. Client maps
+//codes back to the errors.
+var errorCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{bookmark.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{bookmark.ErrRevisionNotFound, http.StatusNotFound, CodeRevisionNotFound},
+	{bookmark.ErrTagNotFound, http.StatusNotFound, CodeTagNotFound},
+	{bookmark.ErrCollectionNotFound, http.StatusNotFound, CodeCollectionNotFound},
+	{bookmark.ErrUnknownField, http.StatusBadRequest, CodeUnknownField},
+	{bookmark.ErrInvalidConflictPolicy, http.StatusBadRequest, CodeInvalidConflictPolicy},
+	{bookmark.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor},
+	{bookmark.ErrInvalidSort, http.StatusBadRequest, CodeInvalidSort},
+	{bookmark.ErrNotURL, http.StatusBadRequest, CodeNotURL},
+	{bookmark.ErrInvalidSnapshotFormat, http.StatusBadRequest, CodeInvalidSnapshotFormat},
+	{bookmark.ErrInvalidCSV, http.StatusBadRequest, CodeInvalidCSV},
+	{bookmark.ErrInvalidImportMode, http.StatusBadRequest, CodeInvalidImportMode},
+	{bookmark.ErrInvalidTag, http.StatusBadRequest, CodeInvalidTag},
+	{bookmark.ErrInvalidCollection, http.StatusBadRequest, CodeInvalidCollection},
+	{bookmark.ErrTagExists, http.StatusConflict, CodeTagExists},
+	{bookmark.ErrCollectionExists, http.StatusConflict, CodeCollectionExists},
+	{bookmark.ErrNoFetcher, http.StatusNotImplemented, CodeNoFetcher},
+	{bookmark.ErrNoArchiver, http.StatusNotImplemented, CodeNoArchiver},
+	{bookmark.ErrCaptureFailed, http.StatusBadGateway, CodeCaptureFailed},
+	{errInvalidBody, http.StatusBadRequest, CodeInvalidRequest},
+	{errInvalidPatch, http.StatusBadRequest, CodeInvalidPatch},
+	{errPathNotFound, http.StatusBadRequest, CodeInvalidPatch},
+	{errPatchTestFailed, http.StatusConflict, CodePatchTestFailed},
+}
+
+//Error is the error of the API. It's sent in the body of error responses:
+//
+//	{"error": {"code": "invalid_bookmark", "message": "...", "fields": [...]}}
+//
+//Client returns it for error responses, it unwraps to the error of bookmark
+//package, like bookmark.ErrNotFound, when there is one for its code.
+type Error struct {
+	//Status is the status of the response.
+	Status int `json:"-"`
+	//Code identifies the error, see Code constants.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	//Fields lists fields which failed validation, for CodeInvalidBookmark.
+	Fields []bookmark.FieldError `json:"fields,omitempty"`
+	//ID, Field and Location describe the stored bookmark with the same URL
+	//or title, for CodeDuplicate.
+	ID       int    `json:"id,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Location string `json:"location,omitempty"`
+
+	err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+//errorEnvelope is the body of error responses.
+type errorEnvelope struct {
+	Error *Error `json:"error"`
+}
+
+//newError returns Error of err. Errors of bookmark package get status and
+//code from errorCodes, unknown errors are internal and their message isn't
+//exposed.
+func newError(err error) *Error {
+	var (
+		e      *Error
+		dupErr *bookmark.ErrDuplicate
+		invErr *bookmark.ErrInvalidBookmark
+	)
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.As(err, &dupErr):
+		return &Error{
+			Status:  http.StatusConflict,
+			Code:    CodeDuplicate,
+			Message: dupErr.Error(),
+			ID:      dupErr.ID,
+			Field:   dupErr.Field,
+			err:     dupErr,
+		}
+	case errors.As(err, &invErr):
+		return &Error{
+			Status:  http.StatusBadRequest,
+			Code:    CodeInvalidBookmark,
+			Message: invErr.Error(),
+			Fields:  invErr.Fields,
+			err:     invErr,
+		}
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return &Error{Status: c.status, Code: c.code, Message: err.Error(), err: err}
+		}
+	}
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal error", err: err}
+}
+
+//badRequest returns Error of invalid request parameters.
+func badRequest(format string, args ...interface{}) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+//writeError responds with err in the error envelope, see newError.
+func writeError(w http.ResponseWriter, log *log.Entry, err error) {
+	e := newError(err)
+	data, err := json.Marshal(&errorEnvelope{Error: e})
+	if err != nil {
+		log.Errorf("Error marshaling error: %v", err)
+		data = []byte(`{"error":{"code":"internal","message":"internal error"}}`)
+		e.Status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	if _, err = w.Write(data); err != nil {
+		log.Errorf("Error writing data: %v", err)
+	}
+}
+
+//notAllowed responds with 405 Method Not Allowed and Allow header listing
+//methods of the path, or with 404 Not Found when the path has none.
+func notAllowed(w http.ResponseWriter, log *log.Entry, methods ...string) {
+	if len(methods) == 0 {
+		writeError(w, log, &Error{Status: http.StatusNotFound, Code: CodeRouteNotFound, Message: "not found"})
+		return
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, log, &Error{
+		Status:  http.StatusMethodNotAllowed,
+		Code:    CodeMethodNotAllowed,
+		Message: "method not allowed, use " + strings.Join(methods, " or "),
+	})
+}
+
+//allow reports whether the request uses one of methods, otherwise it
+//responds with 405 Method Not Allowed.
+func allow(w http.ResponseWriter, r *http.Request, log *log.Entry, methods ...string) bool {
+	for _, m := range methods {
+		if r.Method == m {
+			return true
+		}
+	}
+	notAllowed(w, log, methods...)
+	return false
+}
+
+//responseError returns Error decoded from the error response, which unwraps
+//to the error of bookmark package of its code. Responses without the
+//envelope, e.g. from proxies, get generic error.
+func responseError(status int, body []byte) error {
+	env := &errorEnvelope{}
+	if err := json.Unmarshal(body, env); err != nil || env.Error == nil || env.Error.Code == "" {
+		return fmt.Errorf("got unexpected status: %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	e := env.Error
+	e.Status = status
+	switch e.Code {
+	case CodeDuplicate:
+		e.err = &bookmark.ErrDuplicate{ID: e.ID, Field: e.Field}
+	case CodeInvalidBookmark:
+		e.err = &bookmark.ErrInvalidBookmark{Fields: e.Fields}
+	default:
+		for _, c := range errorCodes {
+			if c.code == e.Code {
+				e.err = c.err
+				break
+			}
+		}
+	}
+	return e
+}
@@ -4,14 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/akruszewski/librarian/bookmark"
+	"github.com/akruszewski/librarian/bookmark/storagertest"
 	librarianHttp "github.com/akruszewski/librarian/http"
 	"github.com/asdine/storm/v3"
 	"github.com/google/uuid"
@@ -61,6 +66,50 @@ func Test_AddBookmarkReturnsStatusBadRequestWhenRequiredFieldsAreMissing(t *test
 	})
 }
 
+func Test_AddBookmarkReturnsStatusConflictWhenURLExists(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		stored, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+
+		handler := http.HandlerFunc(librarianHttp.Handler(repo))
+		body := `{"title": "Other", "url": "http://test.com", "tags": ["new"]}`
+
+		req := httptest.NewRequest(http.MethodPost, "/bookmark/", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		location := fmt.Sprintf("/bookmark/%d", stored.ID)
+		r.Equal(http.StatusConflict, rr.Code)
+		r.Equal(location, rr.Header().Get("Location"))
+		resp := struct {
+			Error *librarianHttp.Error `json:"error"`
+		}{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), &resp))
+		r.Equal(librarianHttp.CodeDuplicate, resp.Error.Code)
+		r.Equal(stored.ID, resp.Error.ID)
+		r.Equal("url", resp.Error.Field)
+		r.Equal(location, resp.Error.Location)
+
+		req = httptest.NewRequest(http.MethodPost, "/bookmark/?conflict=merge-tags", strings.NewReader(body))
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+		bm := &bookmark.Bookmark{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), bm))
+		r.Equal(stored.ID, bm.ID)
+		r.Equal([]string{"new"}, bm.Tags)
+
+		req = httptest.NewRequest(http.MethodPost, "/bookmark/?conflict=unknown", strings.NewReader(body))
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusBadRequest, rr.Code)
+	})
+}
+
 func Test_CanGetBookmark(t *testing.T) {
 	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
 		r := require.New(t)
@@ -196,6 +245,296 @@ func Test_CannotUpdateBookmarkWhichDoesntExist(t *testing.T) {
 	})
 }
 
+func Test_CanUpdateOnlyGivenFieldsOfBookmark(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		nbm := bookmark.NewBookmark{Title: "Test", URL: "http://test.com", Notes: "note"}
+
+		bm, err := repo.Add(ctx, &nbm)
+		r.NotNil(bm)
+		r.NoError(err)
+
+		data, err := json.Marshal(bookmark.Bookmark{Title: "Test test"})
+		r.NoError(err)
+
+		req, err := http.NewRequest(
+			http.MethodPost,
+			fmt.Sprintf("/%d?fields=Title", bm.ID),
+			bytes.NewReader(data),
+		)
+		r.NoError(err)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+
+		bm, err = repo.Get(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal("Test test", bm.Title)
+		r.Equal(nbm.URL, bm.URL)
+		r.Equal(nbm.Notes, bm.Notes)
+	})
+}
+
+func Test_UpdateBookmarkReturnsStatusBadRequestWhenUnknownFieldIsPassed(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		nbm := bookmark.NewBookmark{Title: "Test", URL: "http://test.com"}
+
+		bm, err := repo.Add(ctx, &nbm)
+		r.NotNil(bm)
+		r.NoError(err)
+
+		req, err := http.NewRequest(
+			http.MethodPost,
+			fmt.Sprintf("/%d?fields=ID", bm.ID),
+			bytes.NewReader([]byte("{}")),
+		)
+		r.NoError(err)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusBadRequest, rr.Code)
+	})
+}
+
+func Test_CanPatchBookmarkWithMergePatch(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		nbm := bookmark.NewBookmark{
+			Title: "Test",
+			URL:   "http://test.com",
+			Tags:  []string{"tag"},
+			Notes: "note",
+		}
+
+		bm, err := repo.Add(ctx, &nbm)
+		r.NotNil(bm)
+		r.NoError(err)
+
+		req, err := http.NewRequest(
+			http.MethodPatch,
+			fmt.Sprintf("/%d", bm.ID),
+			bytes.NewReader([]byte(`{"title": "Test test", "notes": null}`)),
+		)
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+
+		patched := &bookmark.Bookmark{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), patched))
+		r.Equal("Test test", patched.Title)
+		r.Equal(nbm.URL, patched.URL)
+		r.Equal(nbm.Tags, patched.Tags)
+		r.Empty(patched.Notes)
+
+		bm, err = repo.Get(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal(patched.Title, bm.Title)
+		r.Empty(bm.Notes)
+	})
+}
+
+func Test_CanPatchBookmarkWithJSONPatch(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		nbm := bookmark.NewBookmark{
+			Title: "Test",
+			URL:   "http://test.com",
+			Tags:  []string{"tag"},
+		}
+
+		bm, err := repo.Add(ctx, &nbm)
+		r.NotNil(bm)
+		r.NoError(err)
+
+		patch := `[
+			{"op": "test", "path": "/title", "value": "Test"},
+			{"op": "add", "path": "/tags/-", "value": "tag2"},
+			{"op": "replace", "path": "/notes", "value": "note"}
+		]`
+		req, err := http.NewRequest(
+			http.MethodPatch,
+			fmt.Sprintf("/%d", bm.ID),
+			bytes.NewReader([]byte(patch)),
+		)
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json-patch+json")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+
+		bm, err = repo.Get(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal(nbm.Title, bm.Title)
+		r.Equal([]string{"tag", "tag2"}, bm.Tags)
+		r.Equal("note", bm.Notes)
+	})
+}
+
+func Test_CanPatchContentAndKindOfBookmark(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		snippet, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Greeting", Kind: bookmark.KindSnippet, Content: "Hello"})
+		r.NoError(err)
+		page, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+		patch := func(id int, contentType, body string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(http.MethodPatch, fmt.Sprintf("/%d", id), strings.NewReader(body))
+			r.NoError(err)
+			req.Header.Set("Content-Type", contentType)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			return rr
+		}
+
+		rr := patch(snippet.ID, "application/merge-patch+json", `{"content": "Hello, World"}`)
+		r.Equal(http.StatusOK, rr.Code, rr.Body.String())
+		bm, err := repo.Get(ctx, snippet.ID)
+		r.NoError(err)
+		r.Equal("Hello, World", bm.Content)
+
+		rr = patch(snippet.ID, "application/json-patch+json", `[{"op": "replace", "path": "/kind", "value": "cmd"}]`)
+		r.Equal(http.StatusOK, rr.Code, rr.Body.String())
+		bm, err = repo.Get(ctx, snippet.ID)
+		r.NoError(err)
+		r.Equal(bookmark.KindCmd, bm.Kind)
+
+		rr = patch(page.ID, "application/merge-patch+json", `{"kind": "snippet", "url": null, "content": "Test"}`)
+		r.Equal(http.StatusOK, rr.Code, rr.Body.String())
+		bm, err = repo.Get(ctx, page.ID)
+		r.NoError(err)
+		r.Equal(bookmark.KindSnippet, bm.Kind)
+		r.Empty(bm.URL)
+		r.Equal("Test", bm.Content)
+
+		//Fields have to be valid for the kind being saved.
+		for _, c := range []struct {
+			body   string
+			fields []bookmark.FieldError
+		}{
+			{`{"kind": "url"}`, []bookmark.FieldError{{Field: "URL", Tag: "required"}, {Field: "Content", Tag: "isdefault"}}},
+			{`{"url": "http://test.com"}`, []bookmark.FieldError{{Field: "URL", Tag: "isdefault"}}},
+			{`{"content": null}`, []bookmark.FieldError{{Field: "Content", Tag: "required"}}},
+		} {
+			rr = patch(snippet.ID, "application/merge-patch+json", c.body)
+			r.Equal(http.StatusBadRequest, rr.Code, c.body)
+			resp := struct {
+				Error *librarianHttp.Error `json:"error"`
+			}{}
+			r.NoError(json.Unmarshal(rr.Body.Bytes(), &resp))
+			r.Equal(c.fields, resp.Error.Fields, c.body)
+		}
+		bm, err = repo.Get(ctx, snippet.ID)
+		r.NoError(err)
+		r.Equal(bookmark.KindCmd, bm.Kind)
+		r.Equal("Hello, World", bm.Content)
+	})
+}
+
+func Test_PatchBookmarkReturnsStatusConflictWhenTestOperationFails(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		nbm := bookmark.NewBookmark{Title: "Test", URL: "http://test.com"}
+
+		bm, err := repo.Add(ctx, &nbm)
+		r.NotNil(bm)
+		r.NoError(err)
+
+		patch := `[
+			{"op": "test", "path": "/title", "value": "Other"},
+			{"op": "replace", "path": "/title", "value": "Test test"}
+		]`
+		req, err := http.NewRequest(
+			http.MethodPatch,
+			fmt.Sprintf("/%d", bm.ID),
+			bytes.NewReader([]byte(patch)),
+		)
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json-patch+json")
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusConflict, rr.Code)
+
+		bm, err = repo.Get(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal(nbm.Title, bm.Title)
+	})
+}
+
+func Test_PatchBookmarkReturnsStatusBadRequestWhenInvalidDataIsPassed(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		nbm := bookmark.NewBookmark{Title: "Test", URL: "http://test.com"}
+
+		bm, err := repo.Add(ctx, &nbm)
+		r.NotNil(bm)
+		r.NoError(err)
+
+		for _, patch := range []string{`{"title": null}`, `{"id": 2}`, `[]`} {
+			req, err := http.NewRequest(
+				http.MethodPatch,
+				fmt.Sprintf("/%d", bm.ID),
+				bytes.NewReader([]byte(patch)),
+			)
+			r.NoError(err)
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+			handler.ServeHTTP(rr, req)
+
+			r.Equal(http.StatusBadRequest, rr.Code, patch)
+		}
+	})
+}
+
+func Test_CannotPatchBookmarkWhichDoesntExist(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		req, err := http.NewRequest(http.MethodPatch, "/1", bytes.NewReader([]byte(`{"title": "Test"}`)))
+		r.NoError(err)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusNotFound, rr.Code)
+	})
+}
+
 func Test_CanDeleteBookmark(t *testing.T) {
 	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
 		r := require.New(t)
@@ -262,28 +601,904 @@ func Test_CanListBookmark(t *testing.T) {
 	})
 }
 
-func withTestRepositoryLogAndContext(f func(ctx context.Context, repo bookmark.Storager, log *log.Entry)) {
-	dbFile, err := ioutil.TempFile("", "librarian_*.db")
-	if err != nil {
-		log.Fatalf("cannot create temp database file: %s", err)
-	}
-	dbPath := dbFile.Name()
-	if err := dbFile.Close(); err != nil {
-		log.Fatalf("cannot close temp database file: %s", err)
-	}
+func Test_CanQueryBookmarks(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
 
-	db, err := storm.Open(dbPath)
-	if err != nil {
-		log.Fatalf("cannot open temp database: %s", err)
-	}
-	defer db.Close()
-	defer os.Remove(dbPath)
+		for _, nbm := range []*bookmark.NewBookmark{
+			{Title: "Test", URL: "http://test.com", Tags: []string{"a", "b"}},
+			{Title: "Other", URL: "http://other.com", Tags: []string{"a"}},
+		} {
+			_, err := repo.Add(ctx, nbm)
+			r.NoError(err)
+		}
 
-	//Add unique request id to context
-	reqID := uuid.New()
-	ctx := context.WithValue(context.Background(), "ReqID", reqID)
-	log := log.New().WithFields(log.Fields{"ReqID": reqID})
+		req, err := http.NewRequest(http.MethodGet, "/?tag=a&tag=b&since=2000-01-01", nil)
+		r.NoError(err)
 
-	repo := bookmark.NewStore(db)
-	f(ctx, repo, log)
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+
+		bms := []bookmark.BookmarkSummary{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), &bms))
+		r.Len(bms, 1)
+		r.Equal("Test", bms[0].Title)
+	})
+}
+
+func Test_QueryBookmarksReturnsStatusBadRequestWhenInvalidTimeIsPassed(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		req, err := http.NewRequest(http.MethodGet, "/?since=yesterday", nil)
+		r.NoError(err)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusBadRequest, rr.Code)
+	})
+}
+
+func Test_CanQueryBookmarksByHealth(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+		for _, c := range []struct {
+			health string
+			code   int
+			count  int
+		}{
+			{"unchecked", http.StatusOK, 1},
+			{"broken", http.StatusOK, 0},
+			{"dead", http.StatusBadRequest, 0},
+		} {
+			req, err := http.NewRequest(http.MethodGet, "/?health="+c.health, nil)
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(c.code, rr.Code, c.health)
+			if c.code != http.StatusOK {
+				continue
+			}
+			bms := []bookmark.BookmarkSummary{}
+			r.NoError(json.Unmarshal(rr.Body.Bytes(), &bms))
+			r.Len(bms, c.count, c.health)
+		}
+	})
+}
+
+func Test_CanListBookmarksByKind(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+		req, err := http.NewRequest(http.MethodPost, "/", strings.NewReader(`{"kind": "cmd", "content": "ls -la"}`))
+		r.NoError(err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		r.Equal(http.StatusOK, rr.Code)
+
+		for _, query := range []string{"kind=cmd", "kind=cmd&q=ls"} {
+			req, err := http.NewRequest(http.MethodGet, "/?"+query, nil)
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(http.StatusOK, rr.Code, query)
+			bms := []bookmark.BookmarkSummary{}
+			r.NoError(json.Unmarshal(rr.Body.Bytes(), &bms))
+			r.Len(bms, 1, query)
+			r.Equal("ls -la", bms[0].Title)
+			r.Equal(bookmark.KindCmd, bms[0].Kind)
+		}
+
+		req, err = http.NewRequest(http.MethodGet, "/?kind=file", nil)
+		r.NoError(err)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		r.Equal(http.StatusBadRequest, rr.Code)
+	})
+}
+
+func Test_CanSearchBookmarks(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		for _, nbm := range []*bookmark.NewBookmark{
+			{Title: "Go blog", URL: "http://blog.golang.org"},
+			{Title: "Rust blog", URL: "http://blog.rust-lang.org"},
+		} {
+			_, err := repo.Add(ctx, nbm)
+			r.NoError(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/search?q=title:go&limit=10", nil)
+		r.NoError(err)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.Handler(repo))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+
+		hits := []bookmark.SearchHit{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), &hits))
+		r.Len(hits, 1)
+		r.Equal("Go blog", hits[0].Bookmark.Title)
+		r.Equal("<mark>Go</mark> blog", hits[0].Highlights["title"])
+	})
+}
+
+func Test_CanListBookmarksPageByPage(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		for i := 0; i < 3; i++ {
+			_, err := repo.Add(ctx, &bookmark.NewBookmark{
+				Title: fmt.Sprintf("Test %d", i),
+				URL:   fmt.Sprintf("http://test.com/%d", i),
+			})
+			r.NoError(err)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/bookmark/?limit=2&sort=title&order=desc", nil)
+		r.NoError(err)
+		req.RequestURI = req.URL.RequestURI()
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.Handler(repo))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+		bms := []bookmark.BookmarkSummary{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), &bms))
+		r.Len(bms, 2)
+		r.Equal("Test 2", bms[0].Title)
+		r.Equal("Test 1", bms[1].Title)
+
+		next := rr.Header().Get("X-Next-Cursor")
+		r.NotEmpty(next)
+		nextURL := fmt.Sprintf("/bookmark/?cursor=%s&limit=2&order=desc&sort=title", next)
+		r.Equal(fmt.Sprintf("<%s>; rel=\"next\"", nextURL), rr.Header().Get("Link"))
+
+		req, err = http.NewRequest(http.MethodGet, nextURL, nil)
+		r.NoError(err)
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), &bms))
+		r.Len(bms, 1)
+		r.Equal("Test 0", bms[0].Title)
+		r.Empty(rr.Header().Get("X-Next-Cursor"))
+		r.Empty(rr.Header().Get("Link"))
+	})
+}
+
+func Test_ListBookmarksReturnsStatusBadRequestWhenInvalidOptionsArePassed(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		for _, query := range []string{"limit=0", "limit=x", "cursor=x", "sort=notes", "order=up"} {
+			req, err := http.NewRequest(http.MethodGet, "/?"+query, nil)
+			r.NoError(err)
+
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+			handler.ServeHTTP(rr, req)
+
+			r.Equal(http.StatusBadRequest, rr.Code, query)
+		}
+	})
+}
+
+func Test_CanExportBookmarksToCSV(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+
+		req, err := http.NewRequest(http.MethodGet, "/export.csv", nil)
+		r.NoError(err)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+		r.Equal("text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+		r.Contains(rr.Body.String(), "title|url|tags|notes|document|created_at|updated_at|kind|content|collections\nTest|http://test.com|")
+	})
+}
+
+func Test_CanExportBookmarksToHTML(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+
+		req, err := http.NewRequest(http.MethodGet, "/export.html", nil)
+		r.NoError(err)
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		handler.ServeHTTP(rr, req)
+
+		r.Equal(http.StatusOK, rr.Code)
+		r.Equal("text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+		r.Contains(rr.Body.String(), `<DT><A HREF="http://test.com" `)
+	})
+}
+
+func Test_CanImportBookmarksFromCSV(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		testCSV := `title|url|tags|notes|document|created_at|updated_at
+test title|https://test.com|tag|test Note||2020-03-04T18:23:43Z|2020-03-04T18:23:43Z
+invalid|https://invalid.com||||yesterday|2020-03-04T18:23:43Z
+`
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+		cases := []struct {
+			mode      string
+			status    int
+			committed bool
+		}{
+			{"", http.StatusUnprocessableEntity, false},
+			{"dry-run", http.StatusOK, false},
+			{"unknown", http.StatusBadRequest, false},
+			{"lenient", http.StatusOK, true},
+		}
+		for _, c := range cases {
+			req, err := http.NewRequest(http.MethodPost, "/import.csv?mode="+c.mode, strings.NewReader(testCSV))
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(c.status, rr.Code, c.mode)
+			if c.status == http.StatusBadRequest {
+				continue
+			}
+
+			report := &bookmark.ImportReport{}
+			r.NoError(json.Unmarshal(rr.Body.Bytes(), report))
+			r.Equal(c.committed, report.Committed, c.mode)
+			r.Len(report.Inserted, 1, c.mode)
+			r.Len(report.Invalid, 1, c.mode)
+			r.Equal(3, report.Invalid[0].Line, c.mode)
+		}
+
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+		r.Len(bms, 1)
+	})
+}
+
+func Test_RefetchBookmarkReturnsStatusNotImplementedWithoutFetcher(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/%d/refetch", bm.ID), nil)
+		r.NoError(err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		r.Equal(http.StatusNotImplemented, rr.Code)
+	})
+}
+
+func Test_SnapshotReturnsStatusNotImplementedWithoutArchiver(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+		for _, c := range []struct {
+			method, path string
+			code         int
+		}{
+			{http.MethodPost, fmt.Sprintf("/%d/snapshot", bm.ID), http.StatusNotImplemented},
+			{http.MethodGet, fmt.Sprintf("/%d/snapshot/latest", bm.ID), http.StatusNotImplemented},
+			{http.MethodGet, fmt.Sprintf("/%d/snapshot/first", bm.ID), http.StatusBadRequest},
+			{http.MethodGet, fmt.Sprintf("/%d/snapshot", bm.ID+1), http.StatusNotFound},
+		} {
+			req, err := http.NewRequest(c.method, c.path, nil)
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(c.code, rr.Code, c.path)
+		}
+	})
+}
+
+//snapshotStorager serves content of every snapshot from its map of formats.
+type snapshotStorager struct {
+	bookmark.Storager
+	contents map[string]string
+}
+
+func (s *snapshotStorager) OpenSnapshot(ctx context.Context, id, version int) (*bookmark.Snapshot, io.ReadCloser, error) {
+	format := bookmark.SnapshotHTML
+	if version == 2 {
+		format = bookmark.SnapshotWARC
+	}
+	content := s.contents[format]
+	return &bookmark.Snapshot{
+		BookmarkID:  id,
+		Version:     version,
+		Format:      format,
+		ContentType: "text/html; charset=utf-8",
+		Size:        int64(len(content)),
+	}, ioutil.NopCloser(strings.NewReader(content)), nil
+}
+
+func Test_SnapshotContentIsSandboxed(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		repo = &snapshotStorager{Storager: repo, contents: map[string]string{
+			bookmark.SnapshotHTML: `<p onclick="fetch('/bookmark/1', {method: 'DELETE'})">page</p>`,
+			bookmark.SnapshotWARC: "WARC/1.0\r\n",
+		}}
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+		for _, version := range []string{"1", "2"} {
+			req, err := http.NewRequest(http.MethodGet, "/1/snapshot/"+version, nil)
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(http.StatusOK, rr.Code)
+			r.Equal("sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline' data:; font-src data:",
+				rr.Header().Get("Content-Security-Policy"))
+			r.Equal("nosniff", rr.Header().Get("X-Content-Type-Options"))
+		}
+	})
+}
+
+func Test_VisitBookmarkRedirectsToPage(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+		cmd, err := repo.Add(ctx, &bookmark.NewBookmark{Kind: bookmark.KindCmd, Content: "ls"})
+		r.NoError(err)
+
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+		for _, c := range []struct {
+			path string
+			code int
+		}{
+			{fmt.Sprintf("/%d/visit", bm.ID), http.StatusFound},
+			{fmt.Sprintf("/%d", bm.ID), http.StatusOK},
+			{fmt.Sprintf("/%d/visit", cmd.ID), http.StatusBadRequest},
+			{fmt.Sprintf("/%d/visit", cmd.ID+1), http.StatusNotFound},
+		} {
+			req, err := http.NewRequest(http.MethodGet, c.path, nil)
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(c.code, rr.Code, c.path)
+			if c.code == http.StatusFound {
+				r.Equal("http://test.com", rr.Header().Get("Location"))
+			}
+		}
+
+		bm, err = repo.Get(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal(2, bm.Visits)
+	})
+}
+
+func Test_CanManageTags(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com", Tags: []string{"golang", "c/c++"}})
+		r.NoError(err)
+
+		handler := http.HandlerFunc(librarianHttp.TagHandler(ctx, repo, log))
+		for _, c := range []struct {
+			method, path, body string
+			code               int
+			response           string
+		}{
+			{http.MethodGet, "/", "", http.StatusOK, `[{"name":"c/c++","count":1},{"name":"golang","count":1}]`},
+			{http.MethodPost, "/rename", `{"old":"golang","new":"go"}`, http.StatusOK, `{"updated":1}`},
+			{http.MethodPost, "/rename", `{"old":"golang","new":"go"}`, http.StatusNotFound, ""},
+			{http.MethodPost, "/rename", `{"old":"c/c++","new":"go"}`, http.StatusConflict, ""},
+			{http.MethodPost, "/merge", `{"tags":["c/c++"],"into":""}`, http.StatusBadRequest, ""},
+			{http.MethodPost, "/merge", `{"tags":"c/c++"}`, http.StatusBadRequest, ""},
+			{http.MethodDelete, "/c/c++", "", http.StatusOK, `{"updated":1}`},
+			{http.MethodGet, "/", "", http.StatusOK, `[{"name":"go","count":1}]`},
+		} {
+			req, err := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(c.code, rr.Code, c.body)
+			if c.response != "" {
+				r.JSONEq(c.response, rr.Body.String())
+			}
+		}
+	})
+}
+
+func Test_CanManageCollections(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		_, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com", Collections: []string{"work/infra"}})
+		r.NoError(err)
+
+		handler := http.HandlerFunc(librarianHttp.CollectionHandler(ctx, repo, log))
+		for _, c := range []struct {
+			method, path, body string
+			code               int
+		}{
+			{http.MethodPost, "/", `{"path":"reading/go"}`, http.StatusCreated},
+			{http.MethodPost, "/", `{"path":"reading"}`, http.StatusConflict},
+			{http.MethodPost, "/", `{"path":" / "}`, http.StatusBadRequest},
+			{http.MethodPost, "/move", `{"from":"work/infra","to":"ops"}`, http.StatusOK},
+			{http.MethodPost, "/move", `{"from":"work/infra","to":"ops"}`, http.StatusNotFound},
+			{http.MethodDelete, "/reading/go?reassign=ops", "", http.StatusOK},
+			{http.MethodDelete, "/work?reassign=missing", "", http.StatusNotFound},
+			{http.MethodDelete, "/work", "", http.StatusOK},
+		} {
+			req, err := http.NewRequest(c.method, c.path, strings.NewReader(c.body))
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(c.code, rr.Code, c.method+" "+c.path+" "+c.body)
+		}
+
+		req, err := http.NewRequest(http.MethodGet, "/", nil)
+		r.NoError(err)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		r.Equal(http.StatusOK, rr.Code)
+		cs := []bookmark.Collection{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), &cs))
+		r.Len(cs, 2)
+		r.Equal("ops", cs[0].Path)
+		r.Equal("reading", cs[1].Path)
+
+		req, err = http.NewRequest(http.MethodGet, "/?collection=ops", nil)
+		r.NoError(err)
+		rr = httptest.NewRecorder()
+		http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log)).ServeHTTP(rr, req)
+		r.Equal(http.StatusOK, rr.Code)
+		bms := []bookmark.BookmarkSummary{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), &bms))
+		r.Len(bms, 1)
+		r.Equal([]string{"ops"}, bms[0].Collections)
+	})
+}
+
+func withTestRepositoryLogAndContext(f func(ctx context.Context, repo bookmark.Storager, log *log.Entry)) {
+	dbFile, err := ioutil.TempFile("", "librarian_*.db")
+	if err != nil {
+		log.Fatalf("cannot create temp database file: %s", err)
+	}
+	dbPath := dbFile.Name()
+	if err := dbFile.Close(); err != nil {
+		log.Fatalf("cannot close temp database file: %s", err)
+	}
+
+	db, err := storm.Open(dbPath)
+	if err != nil {
+		log.Fatalf("cannot open temp database: %s", err)
+	}
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	//Add unique request id to context
+	reqID := uuid.New().String()
+	ctx := librarianHttp.WithRequestID(context.Background(), reqID)
+	log := log.New().WithFields(log.Fields{"ReqID": reqID})
+
+	repo := bookmark.NewStore(db)
+	f(ctx, repo, log)
+}
+
+func Test_CanGetHistoryAndRestoreBookmark(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+
+		handler := http.HandlerFunc(librarianHttp.BookmarkHandler(ctx, repo, log))
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/%d?fields=Title", bm.ID), strings.NewReader(`{"title":"Changed"}`))
+		r.NoError(err)
+		req.Header.Set(librarianHttp.AuthorHeader, "alice")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		r.Equal(http.StatusOK, rr.Code, rr.Body.String())
+
+		req, err = http.NewRequest(http.MethodGet, fmt.Sprintf("/%d/history", bm.ID), nil)
+		r.NoError(err)
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		r.Equal(http.StatusOK, rr.Code)
+		revs := []bookmark.Revision{}
+		r.NoError(json.Unmarshal(rr.Body.Bytes(), &revs))
+		r.Len(revs, 2)
+		r.Equal("alice", revs[1].Author)
+		r.Equal([]bookmark.FieldChange{{Field: "Title", Old: "Test", New: "Changed"}}, revs[1].Changes)
+
+		for _, c := range []struct {
+			method, path string
+			code         int
+		}{
+			{http.MethodPost, fmt.Sprintf("/%d/restore?rev=x", bm.ID), http.StatusBadRequest},
+			{http.MethodPost, fmt.Sprintf("/%d/restore?rev=5", bm.ID), http.StatusNotFound},
+			{http.MethodGet, fmt.Sprintf("/%d/history", bm.ID+1), http.StatusNotFound},
+			{http.MethodPost, fmt.Sprintf("/%d/restore?rev=1", bm.ID), http.StatusOK},
+		} {
+			req, err := http.NewRequest(c.method, c.path, nil)
+			r.NoError(err)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(c.code, rr.Code, c.path)
+		}
+		bm, err = repo.Get(ctx, bm.ID)
+		r.NoError(err)
+		r.Equal("Test", bm.Title)
+	})
+}
+
+func Test_CanManageTrash(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		bm, err := repo.Add(ctx, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.NoError(err)
+		r.NoError(repo.Delete(ctx, bm.ID))
+
+		handler := http.HandlerFunc(librarianHttp.Handler(repo))
+		for _, c := range []struct {
+			method, path string
+			code         int
+			response     string
+		}{
+			{http.MethodPost, "/trash/x/restore", http.StatusBadRequest, ""},
+			{http.MethodPost, fmt.Sprintf("/trash/%d/restore", bm.ID+1), http.StatusNotFound, ""},
+			{http.MethodPost, fmt.Sprintf("/trash/%d/restore", bm.ID), http.StatusOK, ""},
+			{http.MethodGet, "/trash/", http.StatusOK, "[]"},
+			{http.MethodDelete, fmt.Sprintf("/bookmark/%d", bm.ID), http.StatusOK, ""},
+			{http.MethodDelete, "/trash/", http.StatusOK, `{"purged":1}`},
+			{http.MethodGet, fmt.Sprintf("/bookmark/%d", bm.ID), http.StatusNotFound, ""},
+		} {
+			req := httptest.NewRequest(c.method, c.path, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			r.Equal(c.code, rr.Code, c.path)
+			if c.response != "" {
+				r.JSONEq(c.response, rr.Body.String())
+			}
+		}
+	})
+}
+
+//withTestClient calls f with Client of the test server, which serves the
+//test repository.
+func withTestClient(f func(ctx context.Context, client *librarianHttp.Client, repo bookmark.Storager)) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		srv := httptest.NewServer(librarianHttp.Handler(repo))
+		defer srv.Close()
+		client, err := librarianHttp.NewClient(srv.URL+"/bookmark", 10*time.Second)
+		if err != nil {
+			log.Fatalf("cannot create client: %s", err)
+		}
+		f(ctx, client, repo)
+	})
+}
+
+func Test_ClientConformsToStorager(t *testing.T) {
+	storagertest.Run(t, func(f func(s bookmark.Storager)) {
+		withTestClient(func(ctx context.Context, client *librarianHttp.Client, repo bookmark.Storager) {
+			f(client)
+		})
+	})
+}
+
+func Test_ClientHonorsContext(t *testing.T) {
+	withTestClient(func(ctx context.Context, client *librarianHttp.Client, repo bookmark.Storager) {
+		r := require.New(t)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := client.Add(canceled, &bookmark.NewBookmark{Title: "Test", URL: "http://test.com"})
+		r.True(errors.Is(err, context.Canceled), err)
+		bms, _, err := repo.List(ctx, bookmark.ListOptions{})
+		r.NoError(err)
+		r.Empty(bms)
+
+		expired, cancel := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+		defer cancel()
+		_, err = client.Tags(expired)
+		r.True(errors.Is(err, context.DeadlineExceeded), err)
+	})
+}
+
+func Test_ErrorResponsesUseJSONEnvelope(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		handler := http.HandlerFunc(librarianHttp.Handler(repo))
+		for _, test := range []struct {
+			method, target, body string
+			status               int
+			code                 string
+		}{
+			{http.MethodPost, "/bookmark/", `{"kind": "invalid", "url": "http://test.com"}`, http.StatusBadRequest, librarianHttp.CodeInvalidBookmark},
+			{http.MethodPost, "/bookmark/", `{"url": `, http.StatusBadRequest, librarianHttp.CodeInvalidRequest},
+			{http.MethodGet, "/bookmark/1", "", http.StatusNotFound, librarianHttp.CodeNotFound},
+			{http.MethodGet, "/bookmark/x", "", http.StatusBadRequest, librarianHttp.CodeInvalidRequest},
+			{http.MethodGet, "/bookmark/?sort=notes", "", http.StatusBadRequest, librarianHttp.CodeInvalidSort},
+			{http.MethodGet, "/bookmark/1/unknown", "", http.StatusNotFound, librarianHttp.CodeRouteNotFound},
+			{http.MethodGet, "/unknown", "", http.StatusNotFound, librarianHttp.CodeRouteNotFound},
+			{http.MethodPost, "/tag/rename", `{"old": "missing", "new": "other"}`, http.StatusNotFound, librarianHttp.CodeTagNotFound},
+		} {
+			req := httptest.NewRequest(test.method, test.target, strings.NewReader(test.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			r.Equal(test.status, rr.Code, test.target)
+			r.Equal("application/json", rr.Header().Get("Content-Type"), test.target)
+			resp := struct {
+				Error *librarianHttp.Error `json:"error"`
+			}{}
+			r.NoError(json.Unmarshal(rr.Body.Bytes(), &resp), rr.Body.String())
+			r.NotNil(resp.Error, rr.Body.String())
+			r.Equal(test.code, resp.Error.Code, test.target)
+			r.NotEmpty(resp.Error.Message, test.target)
+			if test.code == librarianHttp.CodeInvalidBookmark {
+				r.Equal([]bookmark.FieldError{{Field: "Kind", Tag: "oneof", Param: "url cmd snippet"}}, resp.Error.Fields)
+			}
+		}
+	})
+}
+
+func Test_UnsupportedMethodReturnsStatusMethodNotAllowed(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		handler := http.HandlerFunc(librarianHttp.Handler(repo))
+		for _, test := range []struct {
+			method, target, allow string
+		}{
+			{http.MethodDelete, "/bookmark/", "GET, POST"},
+			{http.MethodPut, "/bookmark/1", "GET, POST, PATCH, DELETE"},
+			{http.MethodGet, "/bookmark/1/refetch", "POST"},
+			{http.MethodPost, "/bookmark/export.csv", "GET"},
+			{http.MethodDelete, "/bookmark/1/snapshot/", "GET, POST"},
+			{http.MethodPost, "/search", "GET"},
+			{http.MethodGet, "/tag/rename", "POST, DELETE"},
+			{http.MethodPut, "/collection/", "GET, POST"},
+			{http.MethodGet, "/trash/1/restore", "POST"},
+		} {
+			req := httptest.NewRequest(test.method, test.target, nil)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			r.Equal(http.StatusMethodNotAllowed, rr.Code, test.target)
+			r.Equal(test.allow, rr.Header().Get("Allow"), test.target)
+			r.Contains(rr.Body.String(), librarianHttp.CodeMethodNotAllowed, test.target)
+		}
+	})
+}
+
+func Test_ClientReturnsErrorOfResponse(t *testing.T) {
+	withTestClient(func(ctx context.Context, client *librarianHttp.Client, repo bookmark.Storager) {
+		r := require.New(t)
+
+		_, err := client.Get(ctx, 1)
+		var apiErr *librarianHttp.Error
+		r.True(errors.As(err, &apiErr), err)
+		r.Equal(http.StatusNotFound, apiErr.Status)
+		r.Equal(librarianHttp.CodeNotFound, apiErr.Code)
+		r.True(errors.Is(err, bookmark.ErrNotFound), err)
+
+		_, err = client.Add(ctx, &bookmark.NewBookmark{Kind: "invalid", URL: "http://test.com"})
+		r.True(errors.As(err, &apiErr), err)
+		r.Equal(http.StatusBadRequest, apiErr.Status)
+		r.Equal(librarianHttp.CodeInvalidBookmark, apiErr.Code)
+		var invErr *bookmark.ErrInvalidBookmark
+		r.True(errors.As(err, &invErr), err)
+		r.Equal(apiErr.Fields, invErr.Fields)
+	})
+}
+
+func Test_HandlerSetsRequestID(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, log *log.Entry) {
+		r := require.New(t)
+
+		handler := http.HandlerFunc(librarianHttp.Handler(repo))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/bookmark/", nil))
+		r.Equal(http.StatusOK, rr.Code)
+		_, err := uuid.Parse(rr.Header().Get(librarianHttp.RequestIDHeader))
+		r.NoError(err)
+
+		req := httptest.NewRequest(http.MethodGet, "/bookmark/", nil)
+		req.Header.Set(librarianHttp.RequestIDHeader, "client-id")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		r.Equal("client-id", rr.Header().Get(librarianHttp.RequestIDHeader))
+	})
+}
+
+func Test_HandlerLogsRequests(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, _ *log.Entry) {
+		r := require.New(t)
+
+		out := &bytes.Buffer{}
+		logger := log.New()
+		logger.SetOutput(out)
+		logger.SetFormatter(&log.JSONFormatter{})
+		handler := http.HandlerFunc(librarianHttp.Handler(repo, librarianHttp.WithLogger(logger)))
+
+		req := httptest.NewRequest(http.MethodGet, "/bookmark/1", nil)
+		req.Header.Set(librarianHttp.RequestIDHeader, "client-id")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		r.Equal(http.StatusNotFound, rr.Code)
+
+		var entries []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			entry := map[string]interface{}{}
+			r.NoError(json.Unmarshal([]byte(line), &entry), line)
+			r.Equal("client-id", entry["ReqID"], line)
+			entries = append(entries, entry)
+		}
+		r.Len(entries, 2)
+		r.Equal("error", entries[0]["level"])
+		access := entries[1]
+		r.Equal("Request handled.", access["msg"])
+		r.Equal(http.MethodGet, access["Method"])
+		r.Equal("/bookmark/1", access["Path"])
+		r.Equal(float64(http.StatusNotFound), access["Status"])
+		r.Equal(float64(rr.Body.Len()), access["Bytes"])
+		r.Contains(access, "Latency")
+
+		out.Reset()
+		logger.SetLevel(log.WarnLevel)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bookmark/", nil))
+		r.Empty(out.String())
+	})
+}
+
+func Test_HandlerRecoversFromPanic(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, _ *log.Entry) {
+		r := require.New(t)
+
+		out := &bytes.Buffer{}
+		logger := log.New()
+		logger.SetOutput(out)
+		panicking := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			})
+		}
+		handler := http.HandlerFunc(librarianHttp.Handler(repo,
+			librarianHttp.WithLogger(logger),
+			librarianHttp.WithMiddleware(panicking),
+		))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/bookmark/", nil))
+		r.Equal(http.StatusInternalServerError, rr.Code)
+		r.Contains(rr.Body.String(), librarianHttp.CodeInternal)
+		r.NotEmpty(rr.Header().Get(librarianHttp.RequestIDHeader))
+		r.Contains(out.String(), "boom")
+		r.Contains(out.String(), "Status=500")
+	})
+}
+
+func Test_HandlerKeepsRequestIDsOfConcurrentRequests(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, _ *log.Entry) {
+		r := require.New(t)
+
+		logger := log.New()
+		logger.SetOutput(ioutil.Discard)
+		seen := make(chan [2]string, 20)
+		record := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r)
+				seen <- [2]string{r.Header.Get(librarianHttp.RequestIDHeader), librarianHttp.RequestID(r.Context())}
+			})
+		}
+		srv := httptest.NewServer(librarianHttp.Handler(repo,
+			librarianHttp.WithLogger(logger),
+			librarianHttp.WithMiddleware(record),
+		))
+		defer srv.Close()
+
+		errs := make(chan error, cap(seen))
+		for i := 0; i < cap(seen); i++ {
+			go func(i int) {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/bookmark/", nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				id := fmt.Sprintf("request-%d", i)
+				req.Header.Set(librarianHttp.RequestIDHeader, id)
+				resp, err := http.DefaultClient.Do(req)
+				if err != nil {
+					errs <- err
+					return
+				}
+				resp.Body.Close()
+				if got := resp.Header.Get(librarianHttp.RequestIDHeader); got != id {
+					err = fmt.Errorf("got request ID %q, expected %q", got, id)
+				}
+				errs <- err
+			}(i)
+		}
+		for i := 0; i < cap(seen); i++ {
+			r.NoError(<-errs)
+			ids := <-seen
+			r.Equal(ids[0], ids[1])
+		}
+	})
+}
+
+//contextRecorder records context of Get calls.
+type contextRecorder struct {
+	bookmark.Storager
+	ctx context.Context
+}
+
+func (s *contextRecorder) Get(ctx context.Context, id int) (*bookmark.Bookmark, error) {
+	s.ctx = ctx
+	return s.Storager.Get(ctx, id)
+}
+
+func Test_HandlerUsesContextOfRequest(t *testing.T) {
+	withTestRepositoryLogAndContext(func(ctx context.Context, repo bookmark.Storager, _ *log.Entry) {
+		r := require.New(t)
+
+		logger := log.New()
+		logger.SetOutput(ioutil.Discard)
+		recorder := &contextRecorder{Storager: repo}
+		handler := http.HandlerFunc(librarianHttp.Handler(recorder, librarianHttp.WithLogger(logger)))
+
+		type key struct{}
+		reqCtx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+		req := httptest.NewRequest(http.MethodGet, "/bookmark/1?visit=false", nil).WithContext(reqCtx)
+		req.Header.Set(librarianHttp.RequestIDHeader, "client-id")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		r.NotNil(recorder.ctx)
+		r.Equal("value", recorder.ctx.Value(key{}))
+		r.Equal("client-id", librarianHttp.RequestID(recorder.ctx))
+		r.NoError(recorder.ctx.Err())
+		cancel()
+		r.Equal(context.Canceled, recorder.ctx.Err())
+	})
 }
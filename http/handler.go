@@ -1,7 +1,3 @@
-/*
-TODO:
- - add proper http status handling.
-*/
 package http
 
 import (
@@ -9,57 +5,186 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
 	"path"
 	"strconv"
 	"strings"
 
 	"github.com/akruszewski/librarian/bookmark"
-	validator "github.com/go-playground/validator/v10"
-	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
+//AuthorHeader is the request header with the author of changes, who is
+//recorded in bookmark revisions.
+const AuthorHeader = "X-Author"
+
+//snapshotVersionHeader is the response header with version of the served
+//snapshot content.
+const snapshotVersionHeader = "X-Snapshot-Version"
+
+//snapshotPolicy is the Content-Security-Policy of snapshot content. Captured
+//pages are untrusted, so they are sandboxed and can't load anything but
+//embedded resources, which keeps their scripts away from the API.
+const snapshotPolicy = "sandbox; default-src 'none'; img-src data:; style-src 'unsafe-inline' data:; font-src data:"
+
 type bookmarkHandler struct {
 	repo bookmark.Storager
 	log  *log.Entry
+	//path of the bookmark collection, used to link bookmarks in responses.
+	path string
 }
 
-func Handler(ctx context.Context, repo bookmark.Storager) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		//Add unique request id to context
-		reqID := uuid.New()
-		ctx = context.WithValue(ctx, "ReqID", reqID)
-		log := log.New().WithFields(log.Fields{"ReqID": reqID})
+//HandlerOption configures Handler.
+type HandlerOption func(*handlerOptions)
+
+type handlerOptions struct {
+	logger      *log.Logger
+	middlewares []Middleware
+}
+
+//WithLogger sets logger of requests, by default the standard logger of
+//logrus is used.
+func WithLogger(logger *log.Logger) HandlerOption {
+	return func(o *handlerOptions) {
+		o.logger = logger
+	}
+}
+
+//WithMiddleware adds middlewares, which run after the built-in ones in the
+//given order, see Chain.
+func WithMiddleware(middlewares ...Middleware) HandlerOption {
+	return func(o *handlerOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+//Handler returns handler of the API. Every request gets ID (see RequestIDs),
+//is logged (see AccessLog) and panics are recovered (see Recover), before
+//it's passed to middlewares added by WithMiddleware and routed. Requests are
+//handled in their own context, which is canceled when the client goes away.
+//Servers which cancel requests on shutdown set http.Server.BaseContext.
+func Handler(repo bookmark.Storager, opts ...HandlerOption) http.HandlerFunc {
+	o := &handlerOptions{logger: log.StandardLogger()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		log := logEntry(ctx)
 		var head string
 		head, r.URL.Path = ShiftPath(r.URL.Path)
-		if head == "bookmark" {
+		switch head {
+		case "bookmark":
 			BookmarkHandler(ctx, repo, log)(w, r)
 			return
+		case "search":
+			SearchHandler(ctx, repo, log)(w, r)
+			return
+		case "tag":
+			TagHandler(ctx, repo, log)(w, r)
+			return
+		case "collection":
+			CollectionHandler(ctx, repo, log)(w, r)
+			return
+		case "trash":
+			TrashHandler(ctx, repo, log)(w, r)
+			return
 		}
-		http.Error(w, "Not Found", http.StatusNotFound)
-	}
+		notAllowed(w, log)
+	})
+	middlewares := append([]Middleware{RequestIDs(), AccessLog(o.logger), Recover()}, o.middlewares...)
+	return Chain(router, middlewares...).ServeHTTP
 }
 
 //NewBookmarkRouter returns bookmark router
 func BookmarkHandler(ctx context.Context, repo bookmark.Storager, log *log.Entry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		bh := bookmarkHandler{repo: repo, log: log}
+		ctx := withAuthor(ctx, r)
+		bh := bookmarkHandler{repo: repo, log: log, path: collectionPath(r)}
 		if r.URL.Path == "/" {
 			switch r.Method {
 			case http.MethodGet:
 				bh.listBookmarkHandler(ctx, w, r)
 			case http.MethodPost:
 				bh.createBookmarkHandler(ctx, w, r)
+			default:
+				notAllowed(w, log, http.MethodGet, http.MethodPost)
 			}
 			return
 		}
 		var head string
 		head, r.URL.Path = ShiftPath(r.URL.Path)
+		if r.URL.Path == "/" {
+			switch head {
+			case "export.csv":
+				if allow(w, r, log, http.MethodGet) {
+					bh.exportHandler(ctx, w, r, "text/csv", "bookmarks.csv", bh.repo.ExportCSV)
+				}
+				return
+			case "export.html":
+				if allow(w, r, log, http.MethodGet) {
+					bh.exportHandler(ctx, w, r, "text/html", "bookmarks.html", bh.repo.ExportHTML)
+				}
+				return
+			case "import.csv":
+				if allow(w, r, log, http.MethodPost) {
+					bh.importHandler(ctx, w, r, bh.repo.ImportCSV)
+				}
+				return
+			case "import.html":
+				if allow(w, r, log, http.MethodPost) {
+					bh.importHandler(ctx, w, r, bh.repo.ImportHTML)
+				}
+				return
+			case "lookup":
+				if allow(w, r, log, http.MethodGet) {
+					bh.lookupBookmarkHandler(ctx, w, r)
+				}
+				return
+			case "reindex":
+				if allow(w, r, log, http.MethodPost) {
+					bh.reindexHandler(ctx, w, r)
+				}
+				return
+			}
+		}
 		id, err := strconv.Atoi(head)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid user id %q", head), http.StatusBadRequest)
+			writeError(w, log, badRequest("invalid bookmark id %q", head))
+			return
+		}
+		switch r.URL.Path {
+		case "/refetch":
+			if allow(w, r, log, http.MethodPost) {
+				bh.refetchBookmarkHandler(ctx, w, r, id)
+			}
+			return
+		case "/visit":
+			if allow(w, r, log, http.MethodGet) {
+				bh.visitBookmarkHandler(ctx, w, r, id)
+			}
+			return
+		case "/history":
+			if allow(w, r, log, http.MethodGet) {
+				bh.historyHandler(ctx, w, r, id)
+			}
+			return
+		case "/restore":
+			if allow(w, r, log, http.MethodPost) {
+				bh.restoreHandler(ctx, w, r, id)
+			}
+			return
+		}
+		if head, rest := ShiftPath(r.URL.Path); head == "snapshot" {
+			bh.snapshotHandler(ctx, w, r, id, rest)
+			return
+		}
+		if r.URL.Path != "/" {
+			notAllowed(w, log)
 			return
 		}
 		switch r.Method {
@@ -69,10 +194,109 @@ func BookmarkHandler(ctx context.Context, repo bookmark.Storager, log *log.Entry
 			bh.deleteBookmarkHandler(ctx, w, r, id)
 		case http.MethodPost:
 			bh.updateBookmarkHandler(ctx, w, r, id)
+		case http.MethodPatch:
+			bh.patchBookmarkHandler(ctx, w, r, id)
+		default:
+			notAllowed(w, log, http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete)
 		}
 	}
 }
 
+//withAuthor returns context with the author given in AuthorHeader of the
+//request.
+func withAuthor(ctx context.Context, r *http.Request) context.Context {
+	return bookmark.WithAuthor(ctx, r.Header.Get(AuthorHeader))
+}
+
+//collectionPath returns the part of the original request path, which was
+//consumed by routers before the request got to the handler.
+func collectionPath(r *http.Request) string {
+	if r.RequestURI == "" {
+		return ""
+	}
+	ru, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(
+		strings.TrimSuffix(ru.Path, "/"),
+		strings.TrimSuffix(r.URL.Path, "/"),
+	)
+}
+
+//respondError responds with err in the error envelope. Conflict with the
+//duplicate bookmark gets its location, also in Location header.
+func (bh *bookmarkHandler) respondError(w http.ResponseWriter, err error) {
+	e := newError(err)
+	if e.Code == CodeDuplicate {
+		e.Location = fmt.Sprintf("%s/%d", bh.path, e.ID)
+		w.Header().Set("Location", e.Location)
+	}
+	writeError(w, bh.log, e)
+}
+
+//contentType returns media type of the request body without parameters.
+func contentType(r *http.Request) string {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+//SearchHandler returns handler of full-text search. It accepts query in q
+//parameter and optional limit of returned hits.
+func SearchHandler(ctx context.Context, repo bookmark.Storager, log *log.Entry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allow(w, r, log, http.MethodGet) {
+			return
+		}
+		limit := 0
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+				writeError(w, log, badRequest("invalid limit %q", l))
+				return
+			}
+		}
+		hits, err := repo.Search(ctx, r.URL.Query().Get("q"), limit)
+		if err != nil {
+			log.Errorf("Error searching bookmarks: %v", err)
+			writeError(w, log, err)
+			return
+		}
+
+		data, err := json.Marshal(hits)
+		if err != nil {
+			log.Errorf("Error marshaling search hits: %v", err)
+			writeError(w, log, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err = w.Write(data); err != nil {
+			log.Errorf("Error writing data: %v", err)
+			return
+		}
+		log.WithField("Hits", len(hits)).Info("Bookmarks searched.")
+	}
+}
+
+//nextPageURL returns URL of the request with cursor parameter set to next.
+func nextPageURL(r *http.Request, next string) string {
+	u := *r.URL
+	if r.RequestURI != "" {
+		//Path of r.URL is shifted by routers, while RequestURI holds the
+		//original one.
+		if ru, err := url.ParseRequestURI(r.RequestURI); err == nil {
+			u = *ru
+		}
+	}
+	v := u.Query()
+	v.Set("cursor", next)
+	u.RawQuery = v.Encode()
+	return u.String()
+}
+
 // ShiftPath splits off the first component of p, which will be cleaned of
 // relative components before processing. head will never contain a slash and
 // tail will always be a rooted path without trailing slash.
@@ -86,145 +310,470 @@ func ShiftPath(p string) (head, tail string) {
 }
 
 func (bh *bookmarkHandler) createBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
+	nbm := &bookmark.NewBookmark{}
+	if err := decodeJSON(r, nbm); err != nil {
 		bh.log.Errorf("Error reading body: %v", err)
-		http.Error(w, "can't read body", http.StatusBadRequest)
+		bh.respondError(w, err)
+		return
+	}
+	policy := bookmark.ConflictPolicy(r.URL.Query().Get("conflict"))
+	bm, err := bh.repo.Add(ctx, nbm, policy)
+	if err != nil {
+		bh.log.Errorf("Error adding bookmark: %v", err)
+		bh.respondError(w, err)
 		return
 	}
+	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID}).Info("Bookmark added to repository")
+	data, err := json.Marshal(bm)
+	if err != nil {
+		bh.log.Errorf("Error marshaling bookmark: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(data); err != nil {
+		bh.log.Errorf("Error writing data: %v", err)
+		return
+	}
+}
 
-	nbm := &bookmark.NewBookmark{}
-	if err := json.Unmarshal(body, nbm); err != nil {
-		bh.log.Errorf("Error unmarshaling body: %v", err)
-		http.Error(w, "can't read body", http.StatusBadRequest)
+func (bh *bookmarkHandler) updateBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	bm := &bookmark.Bookmark{}
+	if err := decodeJSON(r, bm); err != nil {
+		bh.log.Errorf("Error reading body: %v", err)
+		bh.respondError(w, err)
 		return
 	}
-	bm, err := bh.repo.Add(ctx, nbm)
+	//TODO: hmhm...
+	bm.ID = id
+
+	bm, err := bh.repo.Update(ctx, bm, r.URL.Query()["fields"]...)
 	if err != nil {
 		bh.log.Errorf("Error adding bookmark: %v", err)
-		var ve validator.ValidationErrors
-		if errors.As(err, &ve) {
-			http.Error(w, "internal error", http.StatusBadRequest)
-		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.respondError(w, err)
 		return
 	}
-	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID}).Info("Bookmark added to repository")
+	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID}).Info("Bookmark updated.")
+
 	data, err := json.Marshal(bm)
 	if err != nil {
 		bh.log.Errorf("Error marshaling bookmark: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.respondError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if _, err = w.Write(data); err != nil {
 		bh.log.Errorf("Error writing data: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 }
 
-func (bh *bookmarkHandler) updateBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+//patchBookmarkHandler applies JSON Merge Patch (RFC 7396) or, when request has
+//application/json-patch+json content type, JSON Patch (RFC 6902) to the
+//bookmark. Only fields listed in the patch are updated.
+func (bh *bookmarkHandler) patchBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		bh.log.Errorf("Error reading body: %v", err)
-		http.Error(w, "can't read body", http.StatusBadRequest)
+		bh.respondError(w, errInvalidBody)
 		return
 	}
 
-	bm := &bookmark.Bookmark{}
-	if err := json.Unmarshal(body, bm); err != nil {
-		bh.log.Errorf("Error unmarshaling body: %v", err)
-		http.Error(w, "can't read body", http.StatusBadRequest)
+	bm, err := bh.repo.Get(ctx, id)
+	if err != nil {
+		bh.log.Errorf("Error retrieving bookmark: %v", err)
+		bh.respondError(w, err)
 		return
 	}
-	//TODO: hmhm...
-	bm.ID = id
 
-	bm, err = bh.repo.Update(ctx, bm)
+	var fields []string
+	switch contentType(r) {
+	case jsonPatchContentType:
+		bm, fields, err = applyJSONPatch(bm, body)
+	case mergePatchContentType, "application/json", "":
+		bm, fields, err = applyMergePatch(bm, body)
+	default:
+		bh.respondError(w, &Error{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    CodeUnsupportedMedia,
+			Message: fmt.Sprintf("unsupported patch format %q", contentType(r)),
+		})
+		return
+	}
 	if err != nil {
-		bh.log.Errorf("Error adding bookmark: %v", err)
-		if err == bookmark.ErrNotFound {
-			http.Error(w, "{\"message\": \"bookmark not found\"}", http.StatusNotFound)
+		bh.log.Errorf("Error applying patch: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	bm.ID = id
+
+	if len(fields) != 0 {
+		bm, err = bh.repo.Update(ctx, bm, fields...)
+		if err != nil {
+			bh.log.Errorf("Error patching bookmark: %v", err)
+			bh.respondError(w, err)
 			return
 		}
-		var ve validator.ValidationErrors
-		if errors.As(err, &ve) {
-			http.Error(w, "internal error", http.StatusBadRequest)
-		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.log.WithFields(log.Fields{"BookmarkID": bm.ID}).Info("Bookmark patched.")
+	}
+
+	data, err := json.Marshal(bm)
+	if err != nil {
+		bh.log.Errorf("Error marshaling bookmark: %v", err)
+		bh.respondError(w, err)
 		return
 	}
-	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID}).Info("Bookmark updated.")
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(data); err != nil {
+		bh.log.Errorf("Error writing data: %v", err)
+		return
+	}
+}
+
+//refetchBookmarkHandler downloads page of the bookmark again and responds with
+//the bookmark, failure of the download is reported in its fetch status.
+func (bh *bookmarkHandler) refetchBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	bm, err := bh.repo.Refetch(ctx, id)
+	if err != nil {
+		bh.log.Errorf("Error refetching bookmark: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID, "FetchStatus": bm.FetchStatus}).Info("Bookmark refetched.")
 
 	data, err := json.Marshal(bm)
 	if err != nil {
 		bh.log.Errorf("Error marshaling bookmark: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.respondError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if _, err = w.Write(data); err != nil {
 		bh.log.Errorf("Error writing data: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+//historyHandler responds with revisions of the bookmark, see
+//bookmark.Store.History.
+func (bh *bookmarkHandler) historyHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	revs, err := bh.repo.History(ctx, id)
+	if err != nil {
+		bh.log.Errorf("Error retrieving history: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(revs)
+	if err != nil {
+		bh.log.Errorf("Error marshaling history: %v", err)
+		bh.respondError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(data); err != nil {
+		bh.log.Errorf("Error writing data: %v", err)
+		return
+	}
+	bh.log.WithFields(log.Fields{"BookmarkID": id, "Revisions": len(revs)}).Info("History retrieved.")
+}
+
+//restoreHandler restores the bookmark to the revision given by rev parameter
+//and responds with the bookmark, see bookmark.Store.Restore.
+func (bh *bookmarkHandler) restoreHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	rev, err := strconv.Atoi(r.URL.Query().Get("rev"))
+	if err != nil {
+		bh.respondError(w, badRequest("invalid revision %q", r.URL.Query().Get("rev")))
+		return
+	}
+	bm, err := bh.repo.Restore(ctx, id, rev)
+	if err != nil {
+		bh.log.Errorf("Error restoring bookmark: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID, "Revision": rev}).Info("Bookmark restored.")
+
+	data, err := json.Marshal(bm)
+	if err != nil {
+		bh.log.Errorf("Error marshaling bookmark: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(data); err != nil {
+		bh.log.Errorf("Error writing data: %v", err)
+	}
+}
+
+//snapshotHandler lists snapshots of the bookmark on GET and takes new one on
+//POST. Content of the snapshot is served at snapshot/<version> path of the
+//bookmark, where version can be "latest".
+func (bh *bookmarkHandler) snapshotHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int, rest string) {
+	var (
+		data interface{}
+		err  error
+	)
+	status := http.StatusOK
+	switch {
+	case rest == "/" && r.Method == http.MethodGet:
+		data, err = bh.repo.Snapshots(ctx, id)
+	case rest == "/" && r.Method == http.MethodPost:
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = bookmark.SnapshotHTML
+		}
+		data, err = bh.repo.Snapshot(ctx, id, format)
+		status = http.StatusCreated
+	case rest != "/" && r.Method == http.MethodGet:
+		bh.snapshotContentHandler(ctx, w, r, id, strings.TrimPrefix(rest, "/"))
+		return
+	case rest == "/":
+		notAllowed(w, bh.log, http.MethodGet, http.MethodPost)
+		return
+	default:
+		notAllowed(w, bh.log, http.MethodGet)
+		return
+	}
+	if err != nil {
+		bh.log.Errorf("Error handling snapshot: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		bh.log.Errorf("Error marshaling snapshot: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(body); err != nil {
+		bh.log.Errorf("Error writing data: %v", err)
+	}
+}
+
+func (bh *bookmarkHandler) snapshotContentHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int, v string) {
+	version := 0
+	if v != "latest" {
+		var err error
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			bh.respondError(w, badRequest("invalid snapshot version %q", v))
+			return
+		}
+	}
+	s, rc, err := bh.repo.OpenSnapshot(ctx, id, version)
+	if err != nil {
+		bh.log.Errorf("Error opening snapshot: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", s.ContentType)
+	w.Header().Set("Content-Security-Policy", snapshotPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.FormatInt(s.Size, 10))
+	w.Header().Set(snapshotVersionHeader, strconv.Itoa(s.Version))
+	if s.Format == bookmark.SnapshotWARC {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="bookmark-%d-%d.warc"`, id, s.Version))
+	}
+	if _, err := io.Copy(w, rc); err != nil {
+		bh.log.Errorf("Error writing snapshot: %v", err)
+	}
 }
 
 func (bh *bookmarkHandler) deleteBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
 	if err := bh.repo.Delete(ctx, id); err != nil {
 		bh.log.Errorf("Couldn't delete bookmark: %v", err)
-		if err == bookmark.ErrNotFound {
-			http.Error(w, "{\"message\": \"bookmark not found\"}", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.respondError(w, err)
 		return
 	}
 	bh.log.WithFields(log.Fields{"BookmarkID": id}).Info("Bookmark deleted.")
 }
 
+//getBookmarkHandler responds with the bookmark and records the access, see
+//bookmark.Store.Visit. Access isn't recorded when visit parameter is false.
 func (bh *bookmarkHandler) getBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
-	bm, err := bh.repo.Get(ctx, id)
+	get := bh.repo.Visit
+	if r.URL.Query().Get("visit") == "false" {
+		get = bh.repo.Get
+	}
+	bm, err := get(ctx, id)
 	if err != nil {
 		bh.log.Errorf("Error retrieving bookmark: %v", err)
-		if err == bookmark.ErrNotFound {
-			http.Error(w, "{\"message\": \"bookmark not found\"}", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.respondError(w, err)
 		return
 	}
 
 	data, err := json.Marshal(bm)
 	if err != nil {
 		bh.log.Errorf("Error marshaling bookmark: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.respondError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if _, err = w.Write(data); err != nil {
 		bh.log.Errorf("Error writing data: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID}).Info("Bookmark retrieved.")
 }
 
+//lookupBookmarkHandler responds with the bookmark which has URL given by url
+//parameter, see bookmark.Store.GetByURL.
+func (bh *bookmarkHandler) lookupBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	bm, err := bh.repo.GetByURL(ctx, r.URL.Query().Get("url"))
+	if err != nil {
+		bh.log.Errorf("Error looking up bookmark: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+
+	data, err := json.Marshal(bm)
+	if err != nil {
+		bh.log.Errorf("Error marshaling bookmark: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err = w.Write(data); err != nil {
+		bh.log.Errorf("Error writing data: %v", err)
+		return
+	}
+	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID}).Info("Bookmark looked up.")
+}
+
+//reindexHandler rebuilds the search index, see bookmark.Store.Reindex.
+func (bh *bookmarkHandler) reindexHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if err := bh.repo.Reindex(ctx); err != nil {
+		bh.log.Errorf("Error reindexing bookmarks: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+	bh.log.Info("Bookmarks reindexed.")
+}
+
+//visitBookmarkHandler records the access to the web page and redirects to it.
+func (bh *bookmarkHandler) visitBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, id int) {
+	bm, err := bh.repo.Get(ctx, id)
+	if err == nil && bm.URL == "" {
+		err = bookmark.ErrNotURL
+	}
+	if err == nil {
+		bm, err = bh.repo.Visit(ctx, id)
+	}
+	if err != nil {
+		bh.log.Errorf("Error visiting bookmark: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	bh.log.WithFields(log.Fields{"BookmarkID": bm.ID, "Visits": bm.Visits}).Info("Bookmark visited.")
+	http.Redirect(w, r, bm.URL, http.StatusFound)
+}
+
+//exportHandler streams all bookmarks in the format written by export, as
+//a file attachment.
+func (bh *bookmarkHandler) exportHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, contentType, filename string, export func(context.Context, io.Writer) error) {
+	w.Header().Set("Content-Type", contentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := export(ctx, w); err != nil {
+		//Part of the body could be already sent, so status can't be
+		//changed anymore.
+		bh.log.Errorf("Error exporting bookmarks: %v", err)
+		return
+	}
+	bh.log.WithFields(log.Fields{"File": filename}).Info("Bookmarks exported.")
+}
+
+//importHandler imports bookmarks from the request body in the mode given by
+//mode URL parameter, with conflict policy given by conflict parameter, and
+//responds with the import report. When strict import
+//is rolled back, report is sent with 422 Unprocessable Entity status.
+func (bh *bookmarkHandler) importHandler(ctx context.Context, w http.ResponseWriter, r *http.Request, importFunc func(context.Context, io.Reader, bookmark.ImportOptions) (*bookmark.ImportReport, error)) {
+	opts := bookmark.ImportOptions{
+		Mode:     bookmark.ImportMode(r.URL.Query().Get("mode")),
+		Conflict: bookmark.ConflictPolicy(r.URL.Query().Get("conflict")),
+	}
+	report, err := importFunc(ctx, r.Body, opts)
+	status := http.StatusOK
+	if err != nil {
+		if !errors.Is(err, bookmark.ErrImportRolledBack) {
+			bh.log.Errorf("Error importing bookmarks: %v", err)
+			bh.respondError(w, err)
+			return
+		}
+		status = http.StatusUnprocessableEntity
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		bh.log.Errorf("Error marshaling import report: %v", err)
+		bh.respondError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err = w.Write(data); err != nil {
+		bh.log.Errorf("Error writing data: %v", err)
+		return
+	}
+	bh.log.WithFields(log.Fields{
+		"Mode":       report.Mode,
+		"Committed":  report.Committed,
+		"Inserted":   len(report.Inserted),
+		"Updated":    len(report.Updated),
+		"Skipped":    len(report.Skipped),
+		"Duplicates": len(report.Duplicates),
+		"Invalid":    len(report.Invalid),
+	}).Info("Bookmarks imported.")
+}
+
+//listBookmarkHandler lists page of bookmarks (see parseListOptions), or when
+//query parameters are passed, all bookmarks matching them (see parseQuery).
+//Cursor of the next page is returned in X-Next-Cursor and Link headers.
 func (bh *bookmarkHandler) listBookmarkHandler(ctx context.Context, w http.ResponseWriter, r *http.Request) {
-	bms, err := bh.repo.List(ctx)
+	var bms []*bookmark.BookmarkSummary
+	var err error
+	if isQuery(r.URL.Query()) {
+		var q bookmark.Query
+		q, err = parseQuery(r.URL.Query())
+		if err != nil {
+			bh.log.Errorf("Error parsing query: %v", err)
+			bh.respondError(w, err)
+			return
+		}
+		bms, err = bh.repo.Query(ctx, q)
+	} else {
+		var opts bookmark.ListOptions
+		opts, err = parseListOptions(r.URL.Query())
+		if err != nil {
+			bh.log.Errorf("Error parsing list options: %v", err)
+			bh.respondError(w, err)
+			return
+		}
+		var next string
+		bms, next, err = bh.repo.List(ctx, opts)
+		if next != "" {
+			w.Header().Set(nextCursorHeader, next)
+			w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextPageURL(r, next)))
+		}
+	}
 	if err != nil {
 		bh.log.Errorf("Error retrieving bookmarks: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.respondError(w, err)
 		return
 	}
 
 	data, err := json.Marshal(bms)
 	if err != nil {
 		bh.log.Errorf("Error marshaling bookmark: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		bh.respondError(w, err)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
 	if _, err = w.Write(data); err != nil {
 		bh.log.Errorf("Error writing data: %v", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	bh.log.Info("Bookmarks Listed.")
@@ -0,0 +1,159 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+//RequestIDHeader is the header with ID of the request. ID sent by the client
+//is kept, otherwise new one is generated. It's echoed back in the response.
+const RequestIDHeader = "X-Request-ID"
+
+//maxRequestIDLength limits IDs sent by clients, longer ones are replaced.
+const maxRequestIDLength = 128
+
+//Middleware wraps the handler with behavior shared by all requests.
+type Middleware func(http.Handler) http.Handler
+
+//Chain wraps h with middlewares, the first one is the outermost.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+type requestIDKey struct{}
+
+type logKey struct{}
+
+//WithRequestID returns context of the request with given ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+//RequestID returns ID of the request from ctx, or empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+//withLog returns context with the log entry of the request.
+func withLog(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, logKey{}, entry)
+}
+
+//logEntry returns the log entry of the request, see AccessLog. Without one
+//the standard logger is used.
+func logEntry(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(logKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger()).WithField("ReqID", RequestID(ctx))
+}
+
+//RequestIDs sets ID of every request, see RequestIDHeader and RequestID.
+func RequestIDs() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if id == "" || len(id) > maxRequestIDLength {
+				id = uuid.New().String()
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+//AccessLog logs every request with its method, path, response status, size
+//and latency. Handlers log to the entry of the request, with its ID.
+func AccessLog(logger *log.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			entry := logger.WithField("ReqID", RequestID(r.Context()))
+			rw := &responseRecorder{ResponseWriter: w}
+			//Path is shifted by routers, so it's taken before the request
+			//is handled.
+			path := r.URL.Path
+			next.ServeHTTP(rw, r.WithContext(withLog(r.Context(), entry)))
+			entry.WithFields(log.Fields{
+				"Method":  r.Method,
+				"Path":    path,
+				"Status":  rw.status(),
+				"Bytes":   rw.bytes,
+				"Latency": time.Since(start),
+			}).Info("Request handled.")
+		})
+	}
+}
+
+//Recover responds with 500 Internal Server Error when the handler panics,
+//instead of dropping the connection. Panic is logged with the stack.
+func Recover() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &responseRecorder{ResponseWriter: w}
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				entry := logEntry(r.Context())
+				entry.WithField("Stack", string(debug.Stack())).Errorf("Panic handling request: %v", p)
+				if rw.code == 0 {
+					writeError(rw, entry, &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal error"})
+				}
+			}()
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+//responseRecorder records status and size of the response.
+type responseRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	if rw.code == 0 {
+		rw.code = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.code == 0 {
+		rw.code = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+//Flush sends buffered data, so streamed exports aren't held back.
+func (rw *responseRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//status returns status of the response, handlers which don't write anything
+//respond with 200 OK.
+func (rw *responseRecorder) status() int {
+	if rw.code == 0 {
+		return http.StatusOK
+	}
+	return rw.code
+}
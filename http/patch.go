@@ -0,0 +1,387 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/akruszewski/librarian/bookmark"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	errInvalidPatch    = errors.New("invalid patch")
+	errPathNotFound    = errors.New("patch path not found")
+	errPatchTestFailed = errors.New("patch test operation failed")
+)
+
+//patchableFields maps JSON names of bookmark fields which can be patched to
+//field names accepted by bookmark.Storager.Update. Kind decides whether URL or
+//Content is required, so the whole patched bookmark is validated on update.
+var patchableFields = map[string]string{
+	"kind":        "Kind",
+	"title":       "Title",
+	"url":         "URL",
+	"content":     "Content",
+	"tags":        "Tags",
+	"collections": "Collections",
+	"notes":       "Notes",
+	"document":    "Document",
+}
+
+type jsonPatchOperation struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	From  string           `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+//applyMergePatch applies RFC 7396 JSON Merge Patch to the bookmark. It returns
+//patched copy of the bookmark and names of the fields which were listed in the
+//patch.
+func applyMergePatch(bm *bookmark.Bookmark, patch []byte) (*bookmark.Bookmark, []string, error) {
+	var p map[string]interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	fields := []string{}
+	for name := range p {
+		field, ok := patchableFields[name]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: field %q can't be patched", errInvalidPatch, name)
+		}
+		fields = append(fields, field)
+	}
+	doc, err := toDocument(bm)
+	if err != nil {
+		return nil, nil, err
+	}
+	patched, err := fromDocument(mergePatch(doc, p))
+	if err != nil {
+		return nil, nil, err
+	}
+	return patched, fields, nil
+}
+
+//applyJSONPatch applies RFC 6902 JSON Patch to the bookmark. It returns patched
+//copy of the bookmark and names of the fields touched by patch operations.
+func applyJSONPatch(bm *bookmark.Bookmark, patch []byte) (*bookmark.Bookmark, []string, error) {
+	ops := []jsonPatchOperation{}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	doc, err := toDocument(bm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	touched := map[string]bool{}
+	fields := []string{}
+	touch := func(pointer string) error {
+		path, err := parsePointer(pointer)
+		if err != nil {
+			return err
+		}
+		if len(path) == 0 {
+			return fmt.Errorf("%w: whole bookmark can't be patched", errInvalidPatch)
+		}
+		field, ok := patchableFields[path[0]]
+		if !ok {
+			return fmt.Errorf("%w: field %q can't be patched", errInvalidPatch, path[0])
+		}
+		if !touched[field] {
+			touched[field] = true
+			fields = append(fields, field)
+		}
+		return nil
+	}
+
+	for _, op := range ops {
+		path, err := parsePointer(op.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		var value interface{}
+		if op.Value != nil {
+			if err := json.Unmarshal(*op.Value, &value); err != nil {
+				return nil, nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+			}
+		}
+
+		switch op.Op {
+		case "add", "replace", "remove":
+			if op.Op != "remove" && op.Value == nil {
+				return nil, nil, fmt.Errorf("%w: %s operation requires value", errInvalidPatch, op.Op)
+			}
+			if err := touch(op.Path); err != nil {
+				return nil, nil, err
+			}
+			switch op.Op {
+			case "add":
+				doc, err = addValue(doc, path, value)
+			case "replace":
+				doc, _, err = removeValue(doc, path)
+				if err == nil {
+					doc, err = addValue(doc, path, value)
+				}
+			case "remove":
+				doc, _, err = removeValue(doc, path)
+			}
+		case "move", "copy":
+			from, err := parsePointer(op.From)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := touch(op.Path); err != nil {
+				return nil, nil, err
+			}
+			var v interface{}
+			if op.Op == "move" {
+				if err := touch(op.From); err != nil {
+					return nil, nil, err
+				}
+				doc, v, err = removeValue(doc, from)
+			} else {
+				v, err = getValue(doc, from)
+				v = deepCopy(v)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			if doc, err = addValue(doc, path, v); err != nil {
+				return nil, nil, err
+			}
+		case "test":
+			v, err := getValue(doc, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !reflect.DeepEqual(v, value) {
+				return nil, nil, fmt.Errorf("%w: %s", errPatchTestFailed, op.Path)
+			}
+		default:
+			return nil, nil, fmt.Errorf("%w: unknown operation %q", errInvalidPatch, op.Op)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	patched, err := fromDocument(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return patched, fields, nil
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+//parsePointer splits RFC 6901 JSON Pointer into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid pointer %q", errInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+//updateAt walks doc along path and calls leaf with the container holding the
+//last path token. Value returned by leaf replaces that container.
+func updateAt(doc interface{}, path []string, leaf func(container interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return leaf(doc, path[0])
+	}
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", errPathNotFound, path[0])
+		}
+		v, err := updateAt(child, path[1:], leaf)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = v
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(node, path[0], false)
+		if err != nil {
+			return nil, err
+		}
+		v, err := updateAt(node[i], path[1:], leaf)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = v
+		return node, nil
+	}
+	return nil, fmt.Errorf("%w: %s", errPathNotFound, path[0])
+}
+
+func addValue(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateAt(doc, path, func(container interface{}, key string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			node[key] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(node, key, true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		case nil:
+			//Empty JSON arrays, like bookmark without tags, are decoded
+			//as null.
+			if key == "-" || key == "0" {
+				return []interface{}{value}, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: %s", errPathNotFound, key)
+	})
+}
+
+func removeValue(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: can't remove whole document", errInvalidPatch)
+	}
+	var removed interface{}
+	doc, err := updateAt(doc, path, func(container interface{}, key string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", errPathNotFound, key)
+			}
+			removed = v
+			delete(node, key)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(node, key, false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %s", errPathNotFound, key)
+	})
+	return doc, removed, err
+}
+
+func getValue(doc interface{}, path []string) (interface{}, error) {
+	for _, key := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", errPathNotFound, key)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(node, key, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %s", errPathNotFound, key)
+		}
+	}
+	return doc, nil
+}
+
+//arrayIndex parses array index token. When insert is true, index equal to the
+//array length (or "-") is allowed.
+func arrayIndex(arr []interface{}, key string, insert bool) (int, error) {
+	if insert && key == "-" {
+		return len(arr), nil
+	}
+	i, err := strconv.Atoi(key)
+	max := len(arr) - 1
+	if insert {
+		max = len(arr)
+	}
+	if err != nil || i < 0 || i > max || (key != "0" && strings.HasPrefix(key, "0")) {
+		return 0, fmt.Errorf("%w: invalid array index %q", errPathNotFound, key)
+	}
+	return i, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for k, v := range node {
+			m[k] = deepCopy(v)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(node))
+		for i, v := range node {
+			a[i] = deepCopy(v)
+		}
+		return a
+	}
+	return v
+}
+
+func toDocument(bm *bookmark.Bookmark) (interface{}, error) {
+	data, err := json.Marshal(bm)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func fromDocument(doc interface{}) (*bookmark.Bookmark, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	bm := &bookmark.Bookmark{}
+	if err := json.Unmarshal(data, bm); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	return bm, nil
+}
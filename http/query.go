@@ -0,0 +1,182 @@
+package http
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/akruszewski/librarian/bookmark"
+)
+
+const dateLayout = "2006-01-02"
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+//queryParams lists URL query parameters which are translated to bookmark.Query.
+var queryParams = []string{
+	"tag", "any_tag", "since", "until", "updated_since", "updated_until",
+	"host", "prefix", "q", "health", "collection",
+}
+
+//isQuery reports whether URL values contain any of bookmark query parameters.
+func isQuery(v url.Values) bool {
+	for _, p := range queryParams {
+		if _, ok := v[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+//parseQuery builds bookmark.Query from URL values. Every "tag" has to be
+//present on the bookmark, while "any_tag" requires at least one of them.
+//"collection" matches also its descendants. Time values are accepted in RFC
+//3339 or YYYY-MM-DD format.
+func parseQuery(v url.Values) (bookmark.Query, error) {
+	q := bookmark.Query{
+		AllTags:    v["tag"],
+		AnyTags:    v["any_tag"],
+		Host:       v.Get("host"),
+		URLPrefix:  v.Get("prefix"),
+		Text:       v.Get("q"),
+		Health:     v.Get("health"),
+		Kind:       v.Get("kind"),
+		Collection: v.Get("collection"),
+	}
+	switch q.Health {
+	case "", bookmark.HealthOK, bookmark.HealthRedirected, bookmark.HealthBroken, bookmark.HealthUnchecked:
+	default:
+		return q, badRequest("invalid health parameter %q", q.Health)
+	}
+	if err := validateKind(q.Kind); err != nil {
+		return q, err
+	}
+	times := []struct {
+		param string
+		dst   *time.Time
+	}{
+		{"since", &q.CreatedAfter},
+		{"until", &q.CreatedBefore},
+		{"updated_since", &q.UpdatedAfter},
+		{"updated_until", &q.UpdatedBefore},
+	}
+	for _, t := range times {
+		s := v.Get(t.param)
+		if s == "" {
+			continue
+		}
+		parsed, err := ParseTime(s)
+		if err != nil {
+			return q, badRequest("invalid %s parameter: %v", t.param, err)
+		}
+		*t.dst = parsed
+	}
+	return q, nil
+}
+
+//encodeQuery is the inverse of parseQuery.
+func encodeQuery(q bookmark.Query) url.Values {
+	v := url.Values{}
+	for _, t := range q.AllTags {
+		v.Add("tag", t)
+	}
+	for _, t := range q.AnyTags {
+		v.Add("any_tag", t)
+	}
+	times := map[string]time.Time{
+		"since":         q.CreatedAfter,
+		"until":         q.CreatedBefore,
+		"updated_since": q.UpdatedAfter,
+		"updated_until": q.UpdatedBefore,
+	}
+	for p, t := range times {
+		if !t.IsZero() {
+			v.Set(p, t.Format(time.RFC3339Nano))
+		}
+	}
+	if q.Host != "" {
+		v.Set("host", q.Host)
+	}
+	if q.URLPrefix != "" {
+		v.Set("prefix", q.URLPrefix)
+	}
+	if q.Text != "" {
+		v.Set("q", q.Text)
+	}
+	if q.Health != "" {
+		v.Set("health", q.Health)
+	}
+	if q.Kind != "" {
+		v.Set("kind", q.Kind)
+	}
+	if q.Collection != "" {
+		v.Set("collection", q.Collection)
+	}
+	return v
+}
+
+//parseListOptions builds bookmark.ListOptions from limit, cursor, sort, order
+//and kind URL parameters. Page has defaultPageSize bookmarks when limit is not
+//given and can't be bigger than maxPageSize.
+func parseListOptions(v url.Values) (bookmark.ListOptions, error) {
+	opts := bookmark.ListOptions{
+		Limit:  defaultPageSize,
+		Cursor: v.Get("cursor"),
+		Sort:   v.Get("sort"),
+		Order:  v.Get("order"),
+		Kind:   v.Get("kind"),
+	}
+	if err := validateKind(opts.Kind); err != nil {
+		return opts, err
+	}
+	if l := v.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return opts, badRequest("invalid limit %q, it has to be between 1 and %d", l, maxPageSize)
+		}
+		opts.Limit = limit
+	}
+	return opts, nil
+}
+
+//encodeListOptions is the inverse of parseListOptions.
+func encodeListOptions(opts bookmark.ListOptions) url.Values {
+	v := url.Values{}
+	if opts.Limit > 0 {
+		v.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		v.Set("cursor", opts.Cursor)
+	}
+	if opts.Sort != "" {
+		v.Set("sort", opts.Sort)
+	}
+	if opts.Order != "" {
+		v.Set("order", opts.Order)
+	}
+	if opts.Kind != "" {
+		v.Set("kind", opts.Kind)
+	}
+	return v
+}
+
+func validateKind(kind string) error {
+	switch kind {
+	case "", bookmark.KindURL, bookmark.KindCmd, bookmark.KindSnippet:
+		return nil
+	}
+	return badRequest("invalid kind parameter %q", kind)
+}
+
+//ParseTime parses time in RFC 3339 or YYYY-MM-DD format.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(dateLayout, s)
+}
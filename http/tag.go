@@ -0,0 +1,111 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/akruszewski/librarian/bookmark"
+	log "github.com/sirupsen/logrus"
+)
+
+//errInvalidBody is returned when request body isn't valid JSON of expected
+//structure.
+var errInvalidBody = errors.New("invalid request body")
+
+//renameTagRequest is the body of tag rename request.
+type renameTagRequest struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+//mergeTagsRequest is the body of tags merge request.
+type mergeTagsRequest struct {
+	Tags []string `json:"tags"`
+	Into string   `json:"into"`
+}
+
+//bookmarksUpdated is the response of requests changing tags or collections
+//of bookmarks.
+type bookmarksUpdated struct {
+	Updated int `json:"updated"`
+}
+
+//TagHandler returns handler of tags. Tags with bookmark counts are listed on
+//GET /, POST /rename and POST /merge change them on all bookmarks and DELETE
+///<tag> removes the tag. Tag is the rest of the path, so it can contain
+//slashes.
+func TagHandler(ctx context.Context, repo bookmark.Storager, log *log.Entry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := withAuthor(ctx, r)
+		var (
+			data interface{}
+			err  error
+		)
+		switch {
+		case r.URL.Path == "/" && r.Method == http.MethodGet:
+			data, err = repo.Tags(ctx)
+		case r.URL.Path == "/rename" && r.Method == http.MethodPost:
+			req := &renameTagRequest{}
+			if err = decodeJSON(r, req); err == nil {
+				var n int
+				n, err = repo.RenameTag(ctx, req.Old, req.New)
+				data = &bookmarksUpdated{Updated: n}
+			}
+		case r.URL.Path == "/merge" && r.Method == http.MethodPost:
+			req := &mergeTagsRequest{}
+			if err = decodeJSON(r, req); err == nil {
+				var n int
+				n, err = repo.MergeTags(ctx, req.Tags, req.Into)
+				data = &bookmarksUpdated{Updated: n}
+			}
+		case r.URL.Path != "/" && r.Method == http.MethodDelete:
+			var n int
+			n, err = repo.DeleteTag(ctx, strings.TrimPrefix(r.URL.Path, "/"))
+			data = &bookmarksUpdated{Updated: n}
+		case r.URL.Path == "/":
+			notAllowed(w, log, http.MethodGet)
+			return
+		case r.URL.Path == "/rename", r.URL.Path == "/merge":
+			notAllowed(w, log, http.MethodPost, http.MethodDelete)
+			return
+		default:
+			notAllowed(w, log, http.MethodDelete)
+			return
+		}
+		if err != nil {
+			log.Errorf("Error handling tags: %v", err)
+			writeError(w, log, err)
+			return
+		}
+
+		body, err := json.Marshal(data)
+		if err != nil {
+			log.Errorf("Error marshaling tags: %v", err)
+			writeError(w, log, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err = w.Write(body); err != nil {
+			log.Errorf("Error writing data: %v", err)
+			return
+		}
+		log.WithField("Path", r.URL.Path).Info("Tags handled.")
+	}
+}
+
+//decodeJSON reads JSON body of the request into v.
+func decodeJSON(r *http.Request, v interface{}) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidBody, err)
+	}
+	return nil
+}
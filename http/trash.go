@@ -0,0 +1,86 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/akruszewski/librarian/bookmark"
+	log "github.com/sirupsen/logrus"
+)
+
+//trashEmptied is the response of the request emptying the trash.
+type trashEmptied struct {
+	Purged int `json:"purged"`
+}
+
+//TrashHandler returns handler of deleted bookmarks. The trash is listed on
+//GET /, POST /<id>/restore moves the bookmark back and DELETE / purges all
+//bookmarks in the trash, or only ones deleted before time given by before
+//parameter in RFC 3339 format.
+func TrashHandler(ctx context.Context, repo bookmark.Storager, log *log.Entry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := withAuthor(ctx, r)
+		var (
+			data interface{}
+			err  error
+		)
+		head, rest := ShiftPath(r.URL.Path)
+		switch {
+		case r.URL.Path == "/" && r.Method == http.MethodGet:
+			data, err = repo.Trash(ctx)
+		case r.URL.Path == "/" && r.Method == http.MethodDelete:
+			before := time.Now()
+			if b := r.URL.Query().Get("before"); b != "" {
+				var parseErr error
+				if before, parseErr = time.Parse(time.RFC3339Nano, b); parseErr != nil {
+					writeError(w, log, badRequest("invalid time %q", b))
+					return
+				}
+			}
+			var n int
+			n, err = repo.EmptyTrash(ctx, before)
+			data = &trashEmptied{Purged: n}
+		case rest == "/restore" && r.Method == http.MethodPost:
+			id, convErr := strconv.Atoi(head)
+			if convErr != nil {
+				writeError(w, log, badRequest("invalid bookmark id %q", head))
+				return
+			}
+			data, err = repo.RestoreFromTrash(ctx, id)
+		case r.URL.Path == "/":
+			notAllowed(w, log, http.MethodGet, http.MethodDelete)
+			return
+		case rest == "/restore":
+			notAllowed(w, log, http.MethodPost)
+			return
+		default:
+			notAllowed(w, log)
+			return
+		}
+		if err != nil {
+			log.Errorf("Error handling trash: %v", err)
+			//Bookmark which caused a conflict is in the bookmark collection,
+			//the sibling of the trash.
+			bh := bookmarkHandler{log: log, path: path.Join(path.Dir(collectionPath(r)), "bookmark")}
+			bh.respondError(w, err)
+			return
+		}
+
+		body, err := json.Marshal(data)
+		if err != nil {
+			log.Errorf("Error marshaling trash: %v", err)
+			writeError(w, log, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err = w.Write(body); err != nil {
+			log.Errorf("Error writing data: %v", err)
+			return
+		}
+		log.WithField("Path", r.URL.Path).Info("Trash handled.")
+	}
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Token is a single analyzed term of the text.
+type Token struct {
+	//Term is normalized (lower cased and stemmed) form of the word.
+	Term string
+	//Position is the index of the word in the text. Stop words are not
+	//emitted, but they are counted, so phrases keep their word distances.
+	Position int
+	//Start and End are byte offsets of the word in the original text.
+	Start, End int
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+//Analyze splits text into words made of letters and digits, lower cases and
+//stems them and drops stop words.
+func Analyze(text string) []Token {
+	tokens := []Token{}
+	position := 0
+	start := -1
+	emit := func(end int) {
+		word := strings.ToLower(text[start:end])
+		if !stopWords[word] {
+			tokens = append(tokens, Token{
+				Term:     Stem(word),
+				Position: position,
+				Start:    start,
+				End:      end,
+			})
+		}
+		position++
+		start = -1
+	}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+		} else if start >= 0 {
+			emit(i)
+		}
+		i += size
+	}
+	if start >= 0 {
+		emit(len(text))
+	}
+	return tokens
+}
+
+//Terms returns terms of analyzed text.
+func Terms(text string) []string {
+	terms := []string{}
+	for _, t := range Analyze(text) {
+		terms = append(terms, t.Term)
+	}
+	return terms
+}
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+	ellipsis       = "…"
+)
+
+//Highlight returns fragment of the text, around the first word matching one
+//of the terms, not longer than size bytes (not counting markup). Matching words
+//are wrapped in <mark> tags and the rest of the text is HTML escaped. Empty
+//string is returned when no word matches.
+func Highlight(text string, terms []string, size int) string {
+	wanted := map[string]bool{}
+	for _, t := range terms {
+		wanted[t] = true
+	}
+	matches := []Token{}
+	for _, t := range Analyze(text) {
+		if wanted[t.Term] {
+			matches = append(matches, t)
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+
+	start, end := 0, len(text)
+	if len(text) > size {
+		//Put first match in the first third of the fragment.
+		start = matches[0].Start - size/3
+		if start < 0 {
+			start = 0
+		}
+		end = start + size
+		if end > len(text) {
+			end = len(text)
+			start = end - size
+		}
+		start, end = shrinkToWords(text, start, end)
+	}
+
+	sb := strings.Builder{}
+	if start > 0 {
+		sb.WriteString(ellipsis)
+	}
+	pos := start
+	for _, m := range matches {
+		if m.Start < start || m.End > end {
+			continue
+		}
+		sb.WriteString(html.EscapeString(text[pos:m.Start]))
+		sb.WriteString(highlightStart)
+		sb.WriteString(html.EscapeString(text[m.Start:m.End]))
+		sb.WriteString(highlightEnd)
+		pos = m.End
+	}
+	sb.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		sb.WriteString(ellipsis)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+//shrinkToWords moves start forward and end backward to the nearest
+//whitespace, so words at fragment edges are not cut in half. Text without
+//whitespace is cut at rune boundaries.
+func shrinkToWords(text string, start, end int) (int, int) {
+	s := start
+	for s > 0 && s < end && !isSpace(text[s-1]) {
+		s++
+	}
+	e := end
+	for e < len(text) && e > s && !isSpace(text[e]) {
+		e--
+	}
+	if e <= s {
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+		for end < len(text) && end > start && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		return start, end
+	}
+	return s, e
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
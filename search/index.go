@@ -0,0 +1,363 @@
+//Package search implements full-text search engine. Documents are split into
+//terms (see Analyze) and stored in an inverted index persisted in storm, hits
+//are ranked with BM25.
+package search
+
+import (
+	"math"
+	"sort"
+
+	"github.com/asdine/storm/v3"
+	bolt "go.etcd.io/bbolt"
+)
+
+//BM25 parameters.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+const statsID = "stats"
+
+//Document is a unit of indexing. Fields maps field name to its text.
+type Document struct {
+	ID     int
+	Fields map[string]string
+}
+
+//Hit is a single search result.
+type Hit struct {
+	ID    int
+	Score float64
+	//Terms are query terms matched by the document, they can be passed to
+	//Highlight.
+	Terms []string
+}
+
+//docRecord keeps length of document fields and its terms, so document can be
+//removed from posting lists.
+type docRecord struct {
+	ID      int `storm:"id"`
+	Lengths map[string]int
+	Terms   []string
+}
+
+//postingRecord maps IDs of documents containing term to term positions in
+//document fields.
+type postingRecord struct {
+	Term string `storm:"id"`
+	Docs map[int]map[string][]int
+}
+
+//statsRecord holds number of indexed documents and total length of each
+//field, which are needed to compute BM25.
+type statsRecord struct {
+	ID      string `storm:"id"`
+	Docs    int
+	Lengths map[string]int
+}
+
+//Index is an inverted index stored in storm node. Index doesn't keep any
+//state in memory, so it can be created on storm transaction to update index
+//together with indexed data.
+type Index struct {
+	node    storm.Node
+	weights map[string]float64
+}
+
+//New creates index stored in given node. Weights maps names of indexed fields
+//to their boost in ranking, fields which are not listed are not indexed.
+func New(node storm.Node, weights map[string]float64) *Index {
+	return &Index{node: node, weights: weights}
+}
+
+//Add adds document to the index, replacing previously indexed document with
+//the same ID.
+func (ix *Index) Add(doc Document) error {
+	if err := ix.Remove(doc.ID); err != nil {
+		return err
+	}
+	rec := &docRecord{ID: doc.ID, Lengths: map[string]int{}, Terms: []string{}}
+	positions := map[string]map[string][]int{}
+	for field, text := range doc.Fields {
+		if _, ok := ix.weights[field]; !ok {
+			continue
+		}
+		tokens := Analyze(text)
+		rec.Lengths[field] = len(tokens)
+		for _, t := range tokens {
+			if positions[t.Term] == nil {
+				positions[t.Term] = map[string][]int{}
+			}
+			positions[t.Term][field] = append(positions[t.Term][field], t.Position)
+		}
+	}
+	for term, fields := range positions {
+		p, err := ix.posting(term)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			p = &postingRecord{Term: term, Docs: map[int]map[string][]int{}}
+		}
+		p.Docs[doc.ID] = fields
+		if err := ix.node.Save(p); err != nil {
+			return err
+		}
+		rec.Terms = append(rec.Terms, term)
+	}
+	sort.Strings(rec.Terms)
+	if err := ix.node.Save(rec); err != nil {
+		return err
+	}
+	return ix.updateStats(rec, 1)
+}
+
+//Remove removes document from the index. Removing document which isn't
+//indexed is not an error.
+func (ix *Index) Remove(id int) error {
+	rec := &docRecord{}
+	if err := ix.node.One("ID", id, rec); err != nil {
+		if err == storm.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	for _, term := range rec.Terms {
+		p, err := ix.posting(term)
+		if err != nil {
+			return err
+		}
+		if p == nil {
+			continue
+		}
+		delete(p.Docs, id)
+		if len(p.Docs) == 0 {
+			err = ix.node.DeleteStruct(p)
+		} else {
+			err = ix.node.Save(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := ix.node.DeleteStruct(rec); err != nil {
+		return err
+	}
+	return ix.updateStats(rec, -1)
+}
+
+//Reset removes all documents from the index.
+func (ix *Index) Reset() error {
+	for _, bucket := range []interface{}{&docRecord{}, &postingRecord{}, &statsRecord{}} {
+		if err := ix.node.Drop(bucket); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+//Search returns documents matching the query, ordered by score. Document
+//matches the query when it matches all query clauses (see parseQuery). Limit
+//lower than one means no limit.
+func (ix *Index) Search(query string, limit int) ([]Hit, error) {
+	clauses := parseQuery(query, ix.weights)
+	stats, err := ix.stats()
+	if err != nil {
+		return nil, err
+	}
+	if len(clauses) == 0 || stats.Docs == 0 {
+		return []Hit{}, nil
+	}
+
+	s := &scorer{ix: ix, stats: stats, postings: map[string]*postingRecord{}, docs: map[int]*docRecord{}}
+	var scores map[int]float64
+	terms := []string{}
+	for i, c := range clauses {
+		clauseScores, err := s.score(c)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			scores = clauseScores
+		} else {
+			for id := range scores {
+				if cs, ok := clauseScores[id]; ok {
+					scores[id] += cs
+				} else {
+					delete(scores, id)
+				}
+			}
+		}
+		for _, t := range c.tokens {
+			terms = append(terms, t.Term)
+		}
+	}
+
+	hits := []Hit{}
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score, Terms: terms})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func (ix *Index) posting(term string) (*postingRecord, error) {
+	p := &postingRecord{}
+	if err := ix.node.One("Term", term, p); err != nil {
+		if err == storm.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return p, nil
+}
+
+func (ix *Index) stats() (*statsRecord, error) {
+	stats := &statsRecord{}
+	if err := ix.node.One("ID", statsID, stats); err != nil {
+		if err == storm.ErrNotFound {
+			return &statsRecord{ID: statsID, Lengths: map[string]int{}}, nil
+		}
+		return nil, err
+	}
+	if stats.Lengths == nil {
+		stats.Lengths = map[string]int{}
+	}
+	return stats, nil
+}
+
+//updateStats adds (sign 1) or subtracts (sign -1) document from statistics.
+func (ix *Index) updateStats(rec *docRecord, sign int) error {
+	stats, err := ix.stats()
+	if err != nil {
+		return err
+	}
+	stats.Docs += sign
+	for field, l := range rec.Lengths {
+		stats.Lengths[field] += sign * l
+	}
+	return ix.node.Save(stats)
+}
+
+//scorer computes BM25 scores of clauses, caching loaded records.
+type scorer struct {
+	ix       *Index
+	stats    *statsRecord
+	postings map[string]*postingRecord
+	docs     map[int]*docRecord
+}
+
+//score returns scores of documents matching the clause. Phrase is scored as
+//a single term which frequency is the number of phrase occurrences and which
+//IDF is the sum of IDFs of phrase terms.
+func (s *scorer) score(c clause) (map[int]float64, error) {
+	scores := map[int]float64{}
+	ps := make([]*postingRecord, len(c.tokens))
+	idf := 0.0
+	for i, t := range c.tokens {
+		p, err := s.posting(t.Term)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return scores, nil
+		}
+		ps[i] = p
+		df := float64(len(p.Docs))
+		n := float64(s.stats.Docs)
+		idf += math.Log(1 + (n-df+0.5)/(df+0.5))
+	}
+
+	fields := []string{}
+	if c.field != "" {
+		fields = append(fields, c.field)
+	} else {
+		for f := range s.ix.weights {
+			fields = append(fields, f)
+		}
+	}
+
+	for id := range ps[0].Docs {
+		for _, field := range fields {
+			tf := float64(phraseFrequency(ps, c.tokens, id, field))
+			if tf == 0 {
+				continue
+			}
+			doc, err := s.doc(id)
+			if err != nil {
+				return nil, err
+			}
+			dl := float64(doc.Lengths[field])
+			avg := float64(s.stats.Lengths[field]) / float64(s.stats.Docs)
+			if avg == 0 {
+				avg = 1
+			}
+			norm := tf + k1*(1-b+b*dl/avg)
+			scores[id] += s.ix.weights[field] * idf * tf * (k1 + 1) / norm
+		}
+	}
+	return scores, nil
+}
+
+func (s *scorer) posting(term string) (*postingRecord, error) {
+	if p, ok := s.postings[term]; ok {
+		return p, nil
+	}
+	p, err := s.ix.posting(term)
+	if err != nil {
+		return nil, err
+	}
+	s.postings[term] = p
+	return p, nil
+}
+
+func (s *scorer) doc(id int) (*docRecord, error) {
+	if d, ok := s.docs[id]; ok {
+		return d, nil
+	}
+	d := &docRecord{}
+	if err := s.ix.node.One("ID", id, d); err != nil {
+		return nil, err
+	}
+	s.docs[id] = d
+	return d, nil
+}
+
+//phraseFrequency returns number of occurrences of tokens in document field,
+//keeping tokens relative positions.
+func phraseFrequency(ps []*postingRecord, tokens []Token, id int, field string) int {
+	first := ps[0].Docs[id][field]
+	if len(ps) == 1 {
+		return len(first)
+	}
+	n := 0
+	for _, pos := range first {
+		found := true
+		for i := 1; i < len(ps) && found; i++ {
+			want := pos + tokens[i].Position - tokens[0].Position
+			found = containsInt(ps[i].Docs[id][field], want)
+		}
+		if found {
+			n++
+		}
+	}
+	return n
+}
+
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
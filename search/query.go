@@ -0,0 +1,54 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+//clause is a single part of the query. Clause with more than one token is a
+//phrase, its tokens have to appear next to each other (keeping their relative
+//positions). Empty field means that clause can match any field.
+type clause struct {
+	field  string
+	tokens []Token
+}
+
+//parseQuery splits query into clauses. Query consists of whitespace separated
+//terms and "quoted phrases", both can be scoped to a single field with
+//field: prefix, like title:go or notes:"error handling". Prefixes which are
+//not names of known fields are treated as part of the term.
+func parseQuery(query string, fields map[string]float64) []clause {
+	clauses := []clause{}
+	for query = strings.TrimSpace(query); query != ""; query = strings.TrimSpace(query) {
+		field := ""
+		if i := strings.IndexAny(query, ": \t\n\""); i > 0 && query[i] == ':' {
+			if _, ok := fields[strings.ToLower(query[:i])]; ok {
+				field = strings.ToLower(query[:i])
+				query = query[i+1:]
+			}
+		}
+
+		var text string
+		if strings.HasPrefix(query, "\"") {
+			end := strings.Index(query[1:], "\"")
+			if end < 0 {
+				text, query = query[1:], ""
+			} else {
+				text, query = query[1:end+1], query[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(query, unicode.IsSpace)
+			if end < 0 {
+				end = len(query)
+			}
+			text, query = query[:end], query[end:]
+		}
+
+		tokens := Analyze(text)
+		if len(tokens) == 0 {
+			continue
+		}
+		clauses = append(clauses, clause{field: field, tokens: tokens})
+	}
+	return clauses
+}
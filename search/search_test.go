@@ -0,0 +1,179 @@
+package search_test
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/akruszewski/librarian/search"
+	"github.com/asdine/storm/v3"
+	"github.com/stretchr/testify/require"
+)
+
+var testWeights = map[string]float64{"title": 2, "body": 1}
+
+func Test_StemReducesWordsToStems(t *testing.T) {
+	r := require.New(t)
+	words := map[string]string{
+		"caresses":       "caress",
+		"ponies":         "poni",
+		"cats":           "cat",
+		"feed":           "feed",
+		"agreed":         "agre",
+		"plastered":      "plaster",
+		"motoring":       "motor",
+		"sing":           "sing",
+		"conflated":      "conflat",
+		"hopping":        "hop",
+		"falling":        "fall",
+		"filing":         "file",
+		"happy":          "happi",
+		"relational":     "relat",
+		"generalization": "gener",
+		"connection":     "connect",
+		"running":        "run",
+		"go":             "go",
+		"zürich":         "zürich",
+	}
+	for word, stem := range words {
+		r.Equal(stem, search.Stem(word), word)
+	}
+}
+
+func Test_AnalyzeSkipsStopWordsKeepingPositions(t *testing.T) {
+	r := require.New(t)
+
+	tokens := search.Analyze("The State of the Art, running!")
+	r.Equal([]search.Token{
+		{Term: "state", Position: 1, Start: 4, End: 9},
+		{Term: "art", Position: 4, Start: 17, End: 20},
+		{Term: "run", Position: 5, Start: 22, End: 29},
+	}, tokens)
+}
+
+func Test_CanSearchIndexedDocuments(t *testing.T) {
+	withTestIndex(func(ix *search.Index) {
+		r := require.New(t)
+
+		r.NoError(ix.Add(search.Document{ID: 1, Fields: map[string]string{
+			"title": "Error handling in Go",
+			"body":  "Errors are values.",
+		}}))
+		r.NoError(ix.Add(search.Document{ID: 2, Fields: map[string]string{
+			"title": "Go databases",
+			"body":  "Storing data with bolt, handling errors of transactions.",
+		}}))
+		r.NoError(ix.Add(search.Document{ID: 3, Fields: map[string]string{
+			"title": "Rust",
+			"body":  "Ownership and borrowing.",
+		}}))
+
+		cases := []struct {
+			query    string
+			expected []int
+		}{
+			{"go", []int{1, 2}},
+			{"errors handled", []int{1, 2}},
+			{"title:error", []int{1}},
+			{"title:databases", []int{2}},
+			{"body:go", []int{}},
+			{`"handling errors"`, []int{2}},
+			{`"error handling"`, []int{1}},
+			{"go rust", []int{}},
+			{"the", []int{}},
+			{"unknown:go", []int{}},
+		}
+		for _, c := range cases {
+			hits, err := ix.Search(c.query, 0)
+			r.NoError(err, c.query)
+			ids := []int{}
+			for _, h := range hits {
+				ids = append(ids, h.ID)
+			}
+			r.ElementsMatch(c.expected, ids, c.query)
+		}
+	})
+}
+
+func Test_SearchRanksTitleMatchesHigher(t *testing.T) {
+	withTestIndex(func(ix *search.Index) {
+		r := require.New(t)
+
+		r.NoError(ix.Add(search.Document{ID: 1, Fields: map[string]string{
+			"title": "Cooking",
+			"body":  "How to cook pasta.",
+		}}))
+		r.NoError(ix.Add(search.Document{ID: 2, Fields: map[string]string{
+			"title": "Pasta",
+			"body":  "Recipes.",
+		}}))
+
+		hits, err := ix.Search("pasta", 1)
+		r.NoError(err)
+		r.Len(hits, 1)
+		r.Equal(2, hits[0].ID)
+		r.Equal([]string{"pasta"}, hits[0].Terms)
+	})
+}
+
+func Test_CanRemoveAndReplaceDocuments(t *testing.T) {
+	withTestIndex(func(ix *search.Index) {
+		r := require.New(t)
+
+		r.NoError(ix.Add(search.Document{ID: 1, Fields: map[string]string{"title": "Go"}}))
+		r.NoError(ix.Add(search.Document{ID: 1, Fields: map[string]string{"title": "Rust"}}))
+
+		hits, err := ix.Search("go", 0)
+		r.NoError(err)
+		r.Empty(hits)
+		hits, err = ix.Search("rust", 0)
+		r.NoError(err)
+		r.Len(hits, 1)
+
+		r.NoError(ix.Remove(1))
+		r.NoError(ix.Remove(1))
+		hits, err = ix.Search("rust", 0)
+		r.NoError(err)
+		r.Empty(hits)
+
+		r.NoError(ix.Add(search.Document{ID: 2, Fields: map[string]string{"title": "Go"}}))
+		r.NoError(ix.Reset())
+		hits, err = ix.Search("go", 0)
+		r.NoError(err)
+		r.Empty(hits)
+	})
+}
+
+func Test_HighlightMarksMatchedWords(t *testing.T) {
+	r := require.New(t)
+
+	r.Equal(
+		"<mark>Handling</mark> errors &amp; <mark>handled</mark> panics",
+		search.Highlight("Handling errors & handled panics", []string{"handl"}, 100),
+	)
+	r.Equal("", search.Highlight("nothing here", []string{"handl"}, 100))
+
+	text := "one two three four five six seven eight nine ten eleven twelve"
+	r.Equal("…six <mark>seven</mark> eight nine…", search.Highlight(text, []string{"seven"}, 25))
+}
+
+func withTestIndex(f func(ix *search.Index)) {
+	dbFile, err := ioutil.TempFile("", "librarian_*.db")
+	if err != nil {
+		log.Fatalf("cannot create temp database file: %s", err)
+	}
+	dbPath := dbFile.Name()
+	if err := dbFile.Close(); err != nil {
+		log.Fatalf("cannot close temp database file: %s", err)
+	}
+
+	db, err := storm.Open(dbPath)
+	if err != nil {
+		log.Fatalf("cannot open temp database: %s", err)
+	}
+	defer db.Close()
+	defer os.Remove(dbPath)
+
+	f(search.New(db.From("search"), testWeights))
+}
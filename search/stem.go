@@ -0,0 +1,307 @@
+package search
+
+//Stem reduces English word to its stem with Porter stemming algorithm
+//(https://tartarus.org/martin/PorterStemmer/). Word is expected to be lower
+//case, words containing characters other than a-z are returned unchanged.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	z := &stemmer{b: []byte(word), k: len(word) - 1}
+	z.step1ab()
+	if z.k > 0 {
+		z.step1c()
+		z.step2()
+		z.step3()
+		z.step4()
+		z.step5()
+	}
+	return string(z.b[:z.k+1])
+}
+
+//stemmer holds word being stemmed in b[0:k+1], j is a general offset set by
+//ends.
+type stemmer struct {
+	b    []byte
+	k, j int
+}
+
+//cons reports whether b[i] is a consonant.
+func (z *stemmer) cons(i int) bool {
+	switch z.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		if i == 0 {
+			return true
+		}
+		return !z.cons(i - 1)
+	}
+	return true
+}
+
+//m measures the number of consonant sequences in b[0:j+1]. With <c> being
+//consonant sequence and <v> vowel sequence:
+//	<c><v>       gives 0
+//	<c>vc<v>     gives 1
+//	<c>vcvc<v>   gives 2
+func (z *stemmer) m() int {
+	n := 0
+	i := 0
+	for {
+		if i > z.j {
+			return n
+		}
+		if !z.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > z.j {
+				return n
+			}
+			if z.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > z.j {
+				return n
+			}
+			if !z.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+//vowelInStem reports whether b[0:j+1] contains a vowel.
+func (z *stemmer) vowelInStem() bool {
+	for i := 0; i <= z.j; i++ {
+		if !z.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+//doubleC reports whether b[i-1:i+1] is a double consonant.
+func (z *stemmer) doubleC(i int) bool {
+	if i < 1 || z.b[i] != z.b[i-1] {
+		return false
+	}
+	return z.cons(i)
+}
+
+//cvc reports whether b[i-2:i+1] has the form consonant-vowel-consonant and
+//the second consonant is not w, x or y.
+func (z *stemmer) cvc(i int) bool {
+	if i < 2 || !z.cons(i) || z.cons(i-1) || !z.cons(i-2) {
+		return false
+	}
+	switch z.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+//ends reports whether b[0:k+1] ends with s and sets j to the end of the rest.
+func (z *stemmer) ends(s string) bool {
+	l := len(s)
+	if l > z.k+1 {
+		return false
+	}
+	if string(z.b[z.k-l+1:z.k+1]) != s {
+		return false
+	}
+	z.j = z.k - l
+	return true
+}
+
+//setTo replaces b[j+1:k+1] with s.
+func (z *stemmer) setTo(s string) {
+	z.b = append(z.b[:z.j+1], s...)
+	z.k = z.j + len(s)
+}
+
+func (z *stemmer) r(s string) {
+	if z.m() > 0 {
+		z.setTo(s)
+	}
+}
+
+//step1ab removes plurals and -ed or -ing.
+func (z *stemmer) step1ab() {
+	if z.b[z.k] == 's' {
+		switch {
+		case z.ends("sses"):
+			z.k -= 2
+		case z.ends("ies"):
+			z.setTo("i")
+		case z.b[z.k-1] != 's':
+			z.k--
+		}
+	}
+	if z.ends("eed") {
+		if z.m() > 0 {
+			z.k--
+		}
+	} else if (z.ends("ed") || z.ends("ing")) && z.vowelInStem() {
+		z.k = z.j
+		switch {
+		case z.ends("at"):
+			z.setTo("ate")
+		case z.ends("bl"):
+			z.setTo("ble")
+		case z.ends("iz"):
+			z.setTo("ize")
+		case z.doubleC(z.k):
+			z.k--
+			switch z.b[z.k] {
+			case 'l', 's', 'z':
+				z.k++
+			}
+		case z.m() == 1 && z.cvc(z.k):
+			z.setTo("e")
+		}
+	}
+}
+
+//step1c turns terminal y to i when there is another vowel in the stem.
+func (z *stemmer) step1c() {
+	if z.ends("y") && z.vowelInStem() {
+		z.b[z.k] = 'i'
+	}
+}
+
+type suffix struct {
+	from, to string
+}
+
+func (z *stemmer) replaceFirst(suffixes []suffix) {
+	for _, s := range suffixes {
+		if z.ends(s.from) {
+			z.r(s.to)
+			return
+		}
+	}
+}
+
+//step2 maps double suffixes to single ones.
+func (z *stemmer) step2() {
+	switch z.b[z.k-1] {
+	case 'a':
+		z.replaceFirst([]suffix{{"ational", "ate"}, {"tional", "tion"}})
+	case 'c':
+		z.replaceFirst([]suffix{{"enci", "ence"}, {"anci", "ance"}})
+	case 'e':
+		z.replaceFirst([]suffix{{"izer", "ize"}})
+	case 'l':
+		z.replaceFirst([]suffix{
+			{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"},
+		})
+	case 'o':
+		z.replaceFirst([]suffix{{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}})
+	case 's':
+		z.replaceFirst([]suffix{
+			{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"},
+		})
+	case 't':
+		z.replaceFirst([]suffix{{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}})
+	case 'g':
+		z.replaceFirst([]suffix{{"logi", "log"}})
+	}
+}
+
+//step3 deals with -ic-, -full, -ness etc.
+func (z *stemmer) step3() {
+	switch z.b[z.k] {
+	case 'e':
+		z.replaceFirst([]suffix{{"icate", "ic"}, {"ative", ""}, {"alize", "al"}})
+	case 'i':
+		z.replaceFirst([]suffix{{"iciti", "ic"}})
+	case 'l':
+		z.replaceFirst([]suffix{{"ical", "ic"}, {"ful", ""}})
+	case 's':
+		z.replaceFirst([]suffix{{"ness", ""}})
+	}
+}
+
+//step4 removes -ant, -ence etc. in context <c>vcvc<v>.
+func (z *stemmer) step4() {
+	var suffixes []string
+	switch z.b[z.k-1] {
+	case 'a':
+		suffixes = []string{"al"}
+	case 'c':
+		suffixes = []string{"ance", "ence"}
+	case 'e':
+		suffixes = []string{"er"}
+	case 'i':
+		suffixes = []string{"ic"}
+	case 'l':
+		suffixes = []string{"able", "ible"}
+	case 'n':
+		suffixes = []string{"ant", "ement", "ment", "ent"}
+	case 'o':
+		if z.ends("ion") && z.j >= 0 && (z.b[z.j] == 's' || z.b[z.j] == 't') {
+			break
+		}
+		suffixes = []string{"ou"}
+	case 's':
+		suffixes = []string{"ism"}
+	case 't':
+		suffixes = []string{"ate", "iti"}
+	case 'u':
+		suffixes = []string{"ous"}
+	case 'v':
+		suffixes = []string{"ive"}
+	case 'z':
+		suffixes = []string{"ize"}
+	default:
+		return
+	}
+	if suffixes != nil {
+		found := false
+		for _, s := range suffixes {
+			if z.ends(s) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return
+		}
+	}
+	if z.m() > 1 {
+		z.k = z.j
+	}
+}
+
+//step5 removes final -e if m() > 1 and changes -ll to -l if m() > 1.
+func (z *stemmer) step5() {
+	z.j = z.k
+	if z.b[z.k] == 'e' {
+		a := z.m()
+		if a > 1 || a == 1 && !z.cvc(z.k-1) {
+			z.k--
+		}
+	}
+	if z.b[z.k] == 'l' && z.doubleC(z.k) && z.m() > 1 {
+		z.k--
+	}
+}